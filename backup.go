@@ -0,0 +1,704 @@
+package rosedb
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/index"
+	"github.com/rosedblabs/wal"
+)
+
+// backupFile is a file of the database to be copied into a backup.
+// Only the first size bytes of the file belong to the backup,
+// the data appended after the backup starts will be ignored.
+type backupFile struct {
+	name string
+	file *os.File
+	size int64
+}
+
+// backupManifestFileName is the name of the manifest in the archive created by BackupSince,
+// and the name of the manifest file in the restored directory.
+const backupManifestFileName = "BACKUP.MANIFEST"
+
+// restoreDirSuffixName is the suffix of the temporary directory used by RestoreInPlace.
+const restoreDirSuffixName = "-restore"
+
+// restoreOldDirSuffixName is the suffix of the directory where RestoreInPlace keeps the replaced files
+// until the restored ones are opened.
+const restoreOldDirSuffixName = "-restore-old"
+
+// BackupManifest describes a backup created by BackupSince.
+// It should be persisted by the caller, and passed to the next BackupSince
+// to create an incremental backup based on it.
+// The manifest is also written into the archive, so Restore can chain the backups together.
+type BackupManifest struct {
+	// Id is the unique id of the backup.
+	Id uint64 `json:"id"`
+	// ParentId is the id of the previous backup which this backup is based on,
+	// it is 0 if the backup is a full backup.
+	ParentId uint64 `json:"parent_id"`
+	// Full indicates whether the backup is a full backup.
+	// A full backup can be restored into an empty directory directly,
+	// and an incremental backup can only be restored on top of its parent.
+	Full bool `json:"full"`
+	// MergeFinSegmentId is the merge finished segment id of the database when the backup is created.
+	// The segments will be renumbered by a merge, so if it changes, the next backup must be a full one.
+	MergeFinSegmentId uint32 `json:"merge_fin_segment_id"`
+	// MaxSegmentId is the max id of the sealed segments included by the backup chain.
+	MaxSegmentId uint32 `json:"max_segment_id"`
+	// Segments are the ids of the segment files copied into this backup.
+	Segments []uint32 `json:"segments"`
+	// CreatedAt is the time when the backup is created.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Backup writes a consistent archive of the database to w,
+// which contains all the segment files, the hint file and the merge finished file.
+// The archive is in tar format, and can be restored by calling Restore.
+//
+// It does not stop the writes, only the data written before Backup is called will be included.
+// It is also safe to run Backup concurrently with Merge,
+// a merge which completes during the backup will not affect the archive.
+//
+// A replica can be backed up too, but a database opened at a recovery target can not,
+// because its data files contain the batches after the target, ErrDBReadOnly is returned, use ExportTo instead.
+func (db *DB) Backup(w io.Writer) error {
+	if db.recoveryTarget != nil {
+		return ErrDBReadOnly
+	}
+	files, err := db.openBackupFiles()
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	return writeBackupArchive(w, nil, files)
+}
+
+// BackupSince writes a backup archive of the database to w, and returns the manifest of it.
+//
+// The active segment will be sealed first, and only the sealed segments are included.
+// If prev is nil, a full backup is created, which contains all the segment files,
+// the hint file and the merge finished file.
+// Otherwise, an incremental backup is created, which only contains the segment files
+// sealed after prev was created, since the sealed segment files never change.
+//
+// If the database has been merged after prev was created, the segments are renumbered,
+// so a full backup will be created instead, and the Full field of the manifest will be true.
+//
+// The archive can be restored by calling Restore, a full backup must be restored first,
+// and then the incremental backups in the order they were created.
+//
+// The active segment of a replica is not sealed, since its segments must be the same as the primary's,
+// so the backup of a replica only contains the segments sealed by the primary.
+func (db *DB) BackupSince(prev *BackupManifest, w io.Writer) (*BackupManifest, error) {
+	if db.recoveryTarget != nil {
+		return nil, ErrDBReadOnly
+	}
+	manifest, files, err := db.openIncrementalBackupFiles(prev)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBackupFiles(files)
+
+	if err = writeBackupArchive(w, manifest, files); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// BackupToDir copies a consistent backup of the database to the specified directory,
+// the directory can be opened as a database directly.
+// If the directory exists, it must be empty.
+//
+// It has the same semantics as Backup.
+func (db *DB) BackupToDir(dirPath string) error {
+	if db.recoveryTarget != nil {
+		return ErrDBReadOnly
+	}
+	if err := prepareRestoreDir(dirPath); err != nil {
+		return err
+	}
+	files, err := db.openBackupFiles()
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	for _, f := range files {
+		if err = copyFileTo(filepath.Join(dirPath, f.name), io.NewSectionReader(f.file, 0, f.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checkpoint creates a local copy of the database in the specified directory,
+// which can be opened as an independent database.
+// If the directory exists, it must be empty.
+//
+// The active segment will be sealed first, then all the immutable files
+// (the sealed segment files, the hint file and the merge finished file)
+// will be hard linked into the directory, so it is very fast and barely uses extra disk space.
+// If the hard link fails, for example, the directory is on another filesystem,
+// the file will be copied instead.
+// The active segment of a replica is copied instead of being sealed.
+func (db *DB) Checkpoint(dirPath string) error {
+	if db.recoveryTarget != nil {
+		return ErrDBReadOnly
+	}
+	if err := prepareRestoreDir(dirPath); err != nil {
+		return err
+	}
+	files, err := db.linkCheckpointFiles(dirPath)
+	if err != nil {
+		return err
+	}
+	defer closeBackupFiles(files)
+
+	// copy the files which can not be hard linked.
+	for _, f := range files {
+		if err = copyFileTo(filepath.Join(dirPath, f.name), io.NewSectionReader(f.file, 0, f.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkCheckpointFiles seals the active segment, and hard links all the immutable files into the directory.
+// It returns the opened files which can not be hard linked, they should be copied by the caller.
+func (db *DB) linkCheckpointFiles(dirPath string) ([]*backupFile, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	// the segments of a replica must be the same as the primary's, see Replica.
+	replica := db.readOnly
+	if !replica {
+		if err := db.sealActiveSegment(); err != nil {
+			return nil, err
+		}
+	}
+	activeSegId := db.dataFiles.ActiveSegmentID()
+	segIds, err := listSegmentIds(db.options.DirPath, dataFileNameSuffix)
+	if err != nil {
+		return nil, err
+	}
+	sealedSegIds := make([]wal.SegmentID, 0, len(segIds))
+	for _, segId := range segIds {
+		if segId < activeSegId {
+			sealedSegIds = append(sealedSegIds, segId)
+		}
+	}
+
+	var copyPaths []string
+	for _, path := range db.backupFilePaths(sealedSegIds, true) {
+		if err = os.Link(path, filepath.Join(dirPath, filepath.Base(path))); err != nil {
+			copyPaths = append(copyPaths, path)
+		}
+	}
+
+	// The active segment of a replica is still being written, so it is copied with its current size.
+	if replica {
+		copyPaths = append(copyPaths, wal.SegmentFileName(db.options.DirPath, dataFileNameSuffix, activeSegId))
+		return openFilesForBackup(copyPaths)
+	}
+	// The last sealed segment would be the active segment of the new database,
+	// and the writes to it would modify the file shared with this database.
+	// So we create a new empty active segment file for the new database.
+	if len(sealedSegIds) > 0 {
+		activeSegPath := wal.SegmentFileName(dirPath, dataFileNameSuffix, activeSegId)
+		if err = copyFileTo(activeSegPath, bytes.NewReader(nil)); err != nil {
+			return nil, err
+		}
+	}
+	return openFilesForBackup(copyPaths)
+}
+
+// Restore rebuilds a database in the specified directory from the archive created by Backup or BackupSince.
+// Then the directory can be opened by Open.
+//
+// If the archive is created by Backup, or is a full backup created by BackupSince,
+// the directory must be empty if it exists.
+// If the archive is an incremental backup created by BackupSince,
+// the directory must be restored from its parent backup,
+// and the database in it should not be opened for writing before all the backups are restored.
+func Restore(r io.Reader, dirPath string) error {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// the manifest is always the first entry of the archive if exists.
+	var manifest *BackupManifest
+	if header != nil && header.Name == backupManifestFileName {
+		manifest = new(BackupManifest)
+		if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+			return ErrInvalidBackup
+		}
+		if header, err = tr.Next(); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	if manifest == nil || manifest.Full {
+		if err = prepareRestoreDir(dirPath); err != nil {
+			return err
+		}
+	} else {
+		parent, err := readBackupManifest(dirPath)
+		if err != nil {
+			return err
+		}
+		if parent == nil || parent.Id != manifest.ParentId {
+			return ErrBackupParentMismatch
+		}
+	}
+
+	for header != nil {
+		if header.Typeflag != tar.TypeReg || !isBackupFileName(header.Name) {
+			return ErrInvalidBackup
+		}
+		if err = copyFileTo(filepath.Join(dirPath, header.Name), tr); err != nil {
+			return err
+		}
+		if header, err = tr.Next(); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	// the manifest is written at last, it indicates the backup is restored completely.
+	if manifest != nil {
+		return writeBackupManifest(dirPath, manifest)
+	}
+	return nil
+}
+
+// RestoreInPlace replaces all the data of the opened database with a backup archive created by Backup,
+// or a full backup created by BackupSince.
+//
+// The backup is restored and opened in a temporary directory next to the database first,
+// so a broken backup changes nothing, and the reads and writes are only blocked while the files are being replaced.
+// If the restored files can't be opened after the replacement, the old files are put back;
+// if the old files can't be opened either, the database is closed.
+// No watch event is sent for the replaced data.
+func (db *DB) RestoreInPlace(backup io.Reader) error {
+	if db.readOnly {
+		return ErrDBReadOnly
+	}
+	return db.restoreInPlace(backup)
+}
+
+func (db *DB) restoreInPlace(backup io.Reader) error {
+	dirPath := db.options.DirPath
+	restorePath := filepath.Join(filepath.Dir(filepath.Clean(dirPath)), filepath.Base(dirPath)+restoreDirSuffixName)
+	oldPath := filepath.Join(filepath.Dir(filepath.Clean(dirPath)), filepath.Base(dirPath)+restoreOldDirSuffixName)
+	if err := os.RemoveAll(restorePath); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(restorePath)
+	}()
+	if err := Restore(backup, restorePath); err != nil {
+		return err
+	}
+	manifest, err := readBackupManifest(restorePath)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && !manifest.Full {
+		return ErrBackupParentMismatch
+	}
+	if err = os.Remove(filepath.Join(restorePath, backupManifestFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	restoredIndex, err := db.loadRestoredIndex(restorePath)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrDBClosed
+	}
+	// a merge would replace the restored files with the old data.
+	if atomic.LoadUint32(&db.mergeRunning) == 1 {
+		return ErrMergeRunning
+	}
+	// discard the merge which has not been loaded, the merged data is also in the old files.
+	if err = os.RemoveAll(mergeDirPath(dirPath)); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(oldPath); err != nil {
+		return err
+	}
+	if err = os.Mkdir(oldPath, os.ModePerm); err != nil {
+		return err
+	}
+	if err = db.closeFiles(); err != nil {
+		return err
+	}
+
+	// replace all the files of the database with the restored ones,
+	// the index of the restored files is reused since the file names are not changed.
+	// the closed files are kept in db.dataFiles until the new ones are opened, so Close still works if all fails.
+	var oldMoved bool
+	var dataFiles *wal.WAL
+	if err = moveDBFiles(dirPath, oldPath); err == nil {
+		oldMoved = true
+		if err = moveDBFiles(restorePath, dirPath); err == nil {
+			dataFiles, err = db.openWalFiles()
+		}
+	}
+	if err == nil {
+		db.dataFiles = dataFiles
+		db.index = restoredIndex
+		_ = os.RemoveAll(oldPath)
+		return nil
+	}
+
+	// the database can't be used without its files if the old ones can't be opened either.
+	if rollbackErr := db.rollbackRestore(oldPath, oldMoved); rollbackErr != nil {
+		db.closed = true
+	}
+	return err
+}
+
+// rollbackRestore puts the old files back and opens them after RestoreInPlace fails to open the restored files.
+// Only the restored files are in the directory of the database if all the old ones have been moved.
+// The caller must hold the lock of the database.
+func (db *DB) rollbackRestore(oldPath string, oldMoved bool) error {
+	dirPath := db.options.DirPath
+	if oldMoved {
+		if err := removeDBFiles(dirPath); err != nil {
+			return err
+		}
+	}
+	if err := moveDBFiles(oldPath, dirPath); err != nil {
+		return err
+	}
+	_ = os.RemoveAll(oldPath)
+	dataFiles, err := db.openWalFiles()
+	if err != nil {
+		return err
+	}
+	db.dataFiles = dataFiles
+	db.index = index.NewIndexer()
+	return db.loadIndex()
+}
+
+// loadRestoredIndex opens the files in the restored directory and loads their index,
+// so a broken backup is found before the files of the database are replaced.
+func (db *DB) loadRestoredIndex(dirPath string) (index.Indexer, error) {
+	options := db.options
+	options.DirPath = dirPath
+	restored := &DB{options: options, index: index.NewIndexer()}
+	var err error
+	if restored.dataFiles, err = restored.openWalFiles(); err != nil {
+		return nil, err
+	}
+	err = restored.loadIndex()
+	if closeErr := restored.dataFiles.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return restored.index, nil
+}
+
+// isDBFileName returns whether the file belongs to the data of a database.
+func isDBFileName(name string) bool {
+	return isBackupFileName(name) || name == indexCheckpointFileName || name == backupManifestFileName
+}
+
+// moveDBFiles moves the files of the data of a database to another directory, the other files are not moved.
+func moveDBFiles(from, to string) error {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if isDBFileName(entry.Name()) {
+			if err = os.Rename(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeDBFiles removes the files of the data of a database, the other files are not removed.
+func removeDBFiles(dirPath string) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if isDBFileName(entry.Name()) {
+			if err = os.Remove(filepath.Join(dirPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeBackupArchive writes the manifest (if not nil) and all the files to w in tar format.
+func writeBackupArchive(w io.Writer, manifest *BackupManifest, files []*backupFile) error {
+	tw := tar.NewWriter(w)
+	modTime := time.Now()
+	if manifest != nil {
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     backupManifestFileName,
+			Size:     int64(len(data)),
+			Mode:     0644,
+			ModTime:  modTime,
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err = tw.Write(data); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Size:     f.size,
+			Mode:     0644,
+			ModTime:  modTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, io.NewSectionReader(f.file, 0, f.size)); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// openIncrementalBackupFiles seals the active segment,
+// and opens the files which should be included in the backup based on prev.
+func (db *DB) openIncrementalBackupFiles(prev *BackupManifest) (*BackupManifest, []*backupFile, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, nil, ErrDBClosed
+	}
+	// seal the active segment, so all the data written before is in the immutable segment files.
+	// the segments of a replica must be the same as the primary's, see Replica.
+	if !db.readOnly {
+		if err := db.sealActiveSegment(); err != nil {
+			return nil, nil, err
+		}
+	}
+	activeSegId := db.dataFiles.ActiveSegmentID()
+	mergeFinSegId, err := getMergeFinSegmentId(db.options.DirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	segIds, err := listSegmentIds(db.options.DirPath, dataFileNameSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest := &BackupManifest{
+		Id:                uint64(time.Now().UnixNano()),
+		Full:              true,
+		MergeFinSegmentId: mergeFinSegId,
+		MaxSegmentId:      activeSegId - 1,
+		Segments:          []uint32{},
+		CreatedAt:         time.Now(),
+	}
+	// if the segments have been renumbered by a merge, create a full backup.
+	if prev != nil && prev.MergeFinSegmentId == mergeFinSegId && prev.MaxSegmentId < activeSegId {
+		manifest.Full = false
+		manifest.ParentId = prev.Id
+		if manifest.Id <= prev.Id {
+			manifest.Id = prev.Id + 1
+		}
+	}
+
+	for _, segId := range segIds {
+		if segId >= activeSegId {
+			continue
+		}
+		if !manifest.Full && segId <= prev.MaxSegmentId {
+			continue
+		}
+		manifest.Segments = append(manifest.Segments, segId)
+	}
+
+	files, err := openFilesForBackup(db.backupFilePaths(manifest.Segments, manifest.Full))
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, files, nil
+}
+
+// readBackupManifest reads the manifest of the last restored backup in the directory,
+// it returns nil if there is no manifest.
+func readBackupManifest(dirPath string) (*BackupManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, backupManifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	manifest := new(BackupManifest)
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBackupManifest writes the manifest of the restored backup to the directory.
+func writeBackupManifest(dirPath string, manifest *BackupManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	tempPath := filepath.Join(dirPath, backupManifestFileName+".tmp")
+	if err = os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, filepath.Join(dirPath, backupManifestFileName))
+}
+
+// openBackupFiles opens all the files of the database which should be backed up,
+// and records the current size of them.
+//
+// The files are opened while holding the lock of the database,
+// so no batch is half written, and the merge can not replace the files at the same time.
+// Once the files are opened, replacing or removing them by a merge will not affect the opened ones.
+func (db *DB) openBackupFiles() ([]*backupFile, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	segIds, err := listSegmentIds(db.options.DirPath, dataFileNameSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return openFilesForBackup(db.backupFilePaths(segIds, true))
+}
+
+// backupFilePaths returns the paths of the specified segment files,
+// and the paths of the hint file and the merge finished file if withMergeFiles is true.
+func (db *DB) backupFilePaths(segIds []wal.SegmentID, withMergeFiles bool) []string {
+	paths := make([]string, 0, len(segIds)+2)
+	for _, segId := range segIds {
+		paths = append(paths, wal.SegmentFileName(db.options.DirPath, dataFileNameSuffix, segId))
+	}
+	if !withMergeFiles {
+		return paths
+	}
+	// there is only one hint file and merge finished file, the file id is always 1.
+	for _, suffix := range []string{hintFileNameSuffix, mergeFinNameSuffix} {
+		path := wal.SegmentFileName(db.options.DirPath, suffix, 1)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func openFilesForBackup(paths []string) ([]*backupFile, error) {
+	files := make([]*backupFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			closeBackupFiles(files)
+			return nil, err
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			closeBackupFiles(files)
+			return nil, err
+		}
+		files = append(files, &backupFile{
+			name: filepath.Base(path),
+			file: file,
+			size: stat.Size(),
+		})
+	}
+	return files, nil
+}
+
+func closeBackupFiles(files []*backupFile) {
+	for _, f := range files {
+		_ = f.file.Close()
+	}
+}
+
+// isBackupFileName checks whether the name is a plain file name of a database file,
+// any path separator is not allowed, to avoid writing files outside the restore directory.
+func isBackupFileName(name string) bool {
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	ext := filepath.Ext(name)
+	return ext == dataFileNameSuffix || ext == hintFileNameSuffix || ext == mergeFinNameSuffix
+}
+
+// prepareRestoreDir creates the directory if not exists,
+// or checks whether the existing directory is empty.
+func prepareRestoreDir(dirPath string) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.MkdirAll(dirPath, os.ModePerm)
+		}
+		return err
+	}
+	if len(entries) > 0 {
+		return ErrDirNotEmpty
+	}
+	return nil
+}
+
+// copyFileTo creates the file in the specified path, and copies all the data from r to it.
+func copyFileTo(path string, r io.Reader) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrInvalidBackup
+		}
+		return err
+	}
+	if _, err = io.Copy(file, r); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,342 @@
+package rosedb
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_Backup_Restore(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = MB
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 20000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+
+	// the writes during the backup will not be included, but must not break it.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 20000; i < 30000; i++ {
+			assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+		}
+	}()
+	buf := new(bytes.Buffer)
+	require.NoError(t, db.Backup(buf))
+	wg.Wait()
+
+	restoreOpts := DefaultOptions
+	restoreOpts.DirPath = filepath.Join(os.TempDir(), "rosedb-restore-test")
+	require.NoError(t, Restore(buf, restoreOpts.DirPath))
+	restored, err := Open(restoreOpts)
+	require.NoError(t, err)
+	defer destroyDB(restored)
+
+	for key, value := range kvs {
+		v, err := restored.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	for i := 0; i < 5000; i++ {
+		_, err := restored.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+}
+
+func TestDB_Backup_Merge(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.Merge(true))
+	for i := 10000; i < 12000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+
+	dirPath := filepath.Join(os.TempDir(), "rosedb-backup-dir-test")
+	require.NoError(t, db.BackupToDir(dirPath))
+	_, err = os.Stat(filepath.Join(dirPath, "000000001"+hintFileNameSuffix))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dirPath, "000000001"+mergeFinNameSuffix))
+	assert.NoError(t, err)
+
+	// the directory is not empty now.
+	assert.Equal(t, ErrDirNotEmpty, db.BackupToDir(dirPath))
+
+	restoreOpts := DefaultOptions
+	restoreOpts.DirPath = dirPath
+	restored, err := Open(restoreOpts)
+	require.NoError(t, err)
+	defer destroyDB(restored)
+	assert.Equal(t, len(kvs), restored.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := restored.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+}
+
+func TestRestore_Invalid(t *testing.T) {
+	parentPath := filepath.Join(os.TempDir(), "rosedb-restore-invalid-test")
+	dirPath := filepath.Join(parentPath, "db")
+	defer func() {
+		_ = os.RemoveAll(parentPath)
+	}()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	data := []byte("hello")
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "../000000001.SEG",
+		Size:     int64(len(data)),
+		Mode:     0644,
+	}))
+	_, err := tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	assert.Equal(t, ErrInvalidBackup, Restore(buf, dirPath))
+	_, err = os.Stat(filepath.Join(parentPath, "000000001.SEG"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDB_BackupSince(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = MB
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	put := func(start, end int) {
+		for i := start; i < end; i++ {
+			key, value := utils.GetTestKey(i), utils.RandomValue(128)
+			kvs[string(key)] = value
+			assert.NoError(t, db.Put(key, value))
+		}
+	}
+
+	put(0, 10000)
+	full := new(bytes.Buffer)
+	m1, err := db.BackupSince(nil, full)
+	require.NoError(t, err)
+	assert.True(t, m1.Full)
+	assert.NotEmpty(t, m1.Segments)
+
+	put(5000, 15000)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+	incr := new(bytes.Buffer)
+	m2, err := db.BackupSince(m1, incr)
+	require.NoError(t, err)
+	assert.False(t, m2.Full)
+	assert.Equal(t, m1.Id, m2.ParentId)
+	for _, segId := range m2.Segments {
+		assert.Greater(t, segId, m1.MaxSegmentId)
+	}
+
+	// no writes, the incremental backup is empty.
+	empty := new(bytes.Buffer)
+	m3, err := db.BackupSince(m2, empty)
+	require.NoError(t, err)
+	assert.False(t, m3.Full)
+	assert.Empty(t, m3.Segments)
+
+	restoreOpts := DefaultOptions
+	restoreOpts.DirPath = filepath.Join(os.TempDir(), "rosedb-restore-incr-test")
+	// the incremental backup can not be restored without its parent.
+	assert.Equal(t, ErrBackupParentMismatch, Restore(bytes.NewReader(incr.Bytes()), restoreOpts.DirPath))
+	require.NoError(t, os.RemoveAll(restoreOpts.DirPath))
+
+	require.NoError(t, Restore(full, restoreOpts.DirPath))
+	require.NoError(t, Restore(incr, restoreOpts.DirPath))
+	require.NoError(t, Restore(empty, restoreOpts.DirPath))
+	restored, err := Open(restoreOpts)
+	require.NoError(t, err)
+	assert.Equal(t, len(kvs), restored.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := restored.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	destroyDB(restored)
+
+	// the merge renumbers the segments, so the next backup must be a full one.
+	require.NoError(t, db.Merge(true))
+	put(15000, 16000)
+	afterMerge := new(bytes.Buffer)
+	m4, err := db.BackupSince(m3, afterMerge)
+	require.NoError(t, err)
+	assert.True(t, m4.Full)
+	assert.Zero(t, m4.ParentId)
+
+	require.NoError(t, Restore(afterMerge, restoreOpts.DirPath))
+	restored, err = Open(restoreOpts)
+	require.NoError(t, err)
+	defer destroyDB(restored)
+	assert.Equal(t, len(kvs), restored.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := restored.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+}
+
+func TestDB_Checkpoint(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = MB
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.Merge(true))
+	for i := 10000; i < 20000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+
+	cpOpts := DefaultOptions
+	cpOpts.DirPath = filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, db.Checkpoint(cpOpts.DirPath))
+
+	// the sealed segments are hard linked.
+	src, err := os.Stat(filepath.Join(options.DirPath, "000000001"+dataFileNameSuffix))
+	require.NoError(t, err)
+	dst, err := os.Stat(filepath.Join(cpOpts.DirPath, "000000001"+dataFileNameSuffix))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(src, dst))
+
+	cp, err := Open(cpOpts)
+	require.NoError(t, err)
+	defer func() {
+		_ = cp.Close()
+	}()
+	assert.Equal(t, len(kvs), cp.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := cp.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	// the two databases are independent.
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, cp.Put(utils.GetTestKey(i), []byte("checkpoint")))
+		assert.NoError(t, db.Delete(utils.GetTestKey(i+1000)))
+	}
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	require.NoError(t, cp.Close())
+	cp, err = Open(cpOpts)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		v, err := db.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+		assert.Equal(t, kvs[string(utils.GetTestKey(i))], v)
+		v, err = cp.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("checkpoint"), v)
+		v, err = cp.Get(utils.GetTestKey(i + 1000))
+		assert.NoError(t, err)
+		assert.Equal(t, kvs[string(utils.GetTestKey(i+1000))], v)
+	}
+}
+
+func TestDB_RestoreInPlace(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, db.Backup(buf))
+	for i := 1000; i < 2000; i++ {
+		require.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	require.NoError(t, db.Delete(utils.GetTestKey(0)))
+
+	require.NoError(t, db.RestoreInPlace(buf))
+	assert.Equal(t, 1000, db.Stat().KeysNum)
+	_, err = db.Get(utils.GetTestKey(0))
+	assert.NoError(t, err)
+	_, err = db.Get(utils.GetTestKey(1000))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the database is still writable, and the data survives a restart.
+	require.NoError(t, db.Put([]byte("k"), []byte("v")))
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, 1001, db.Stat().KeysNum)
+
+	// the data is not touched if the backup is broken.
+	assert.Error(t, db.RestoreInPlace(bytes.NewReader([]byte("invalid"))))
+	assert.Equal(t, 1001, db.Stat().KeysNum)
+
+	// the restored files are opened before the files of the database are replaced.
+	buf.Reset()
+	tw := tar.NewWriter(buf)
+	// a chunk of 5 bytes with a wrong checksum.
+	data := []byte{1, 2, 3, 4, 5, 0, 0, 'h', 'e', 'l', 'l', 'o'}
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "000000001.SEG",
+		Size:     int64(len(data)),
+		Mode:     0644,
+	}))
+	_, err = tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	assert.Error(t, db.RestoreInPlace(buf))
+	assert.Equal(t, 1001, db.Stat().KeysNum)
+	value, err := db.Get([]byte("k"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), value)
+	_, err = os.Stat(options.DirPath + restoreOldDirSuffixName)
+	assert.True(t, os.IsNotExist(err))
+}
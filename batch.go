@@ -466,6 +466,9 @@ func (b *Batch) Commit() error {
 	if b.options.ReadOnly || len(b.pendingWrites) == 0 {
 		return nil
 	}
+	if b.db.readOnly {
+		return ErrDBReadOnly
+	}
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -478,8 +481,13 @@ func (b *Batch) Commit() error {
 		return ErrBatchRollbacked
 	}
 
-	batchId := b.batchId.Generate()
 	now := time.Now().UnixNano()
+	// the entries of the secondary indexes are written in the same batch as the keys.
+	if err := b.updateSecondaryIndexes(now); err != nil {
+		return err
+	}
+
+	batchId := b.batchId.Generate()
 	// write to wal buffer
 	for _, record := range b.pendingWrites {
 		buf := bytebufferpool.Get()
@@ -489,12 +497,14 @@ func (b *Batch) Commit() error {
 		b.db.dataFiles.PendingWrites(encRecord)
 	}
 
-	// write a record to indicate the end of the batch
+	// write a record to indicate the end of the batch,
+	// and the value of it is the commit time of the batch.
 	buf := bytebufferpool.Get()
 	b.buffers = append(b.buffers, buf)
 	endRecord := encodeLogRecord(&LogRecord{
-		Key:  batchId.Bytes(),
-		Type: LogRecordBatchFinished,
+		Key:   batchId.Bytes(),
+		Value: encodeCommitTime(now),
+		Type:  LogRecordBatchFinished,
 	}, b.db.encodeHeader, buf)
 	b.db.dataFiles.PendingWrites(endRecord)
 
@@ -516,6 +526,8 @@ func (b *Batch) Commit() error {
 	}
 
 	// write to index
+	var events []*Event
+	watching := b.db.watching()
 	for i, record := range b.pendingWrites {
 		if record.Type == LogRecordDeleted || record.IsExpired(now) {
 			b.db.index.Delete(record.Key)
@@ -523,18 +535,15 @@ func (b *Batch) Commit() error {
 			b.db.index.Put(record.Key, chunkPositions[i])
 		}
 
-		if b.db.options.WatchQueueSize > 0 {
-			e := &Event{Key: record.Key, Value: record.Value, BatchId: record.BatchId}
-			if record.Type == LogRecordDeleted {
-				e.Action = WatchActionDelete
-			} else {
-				e.Action = WatchActionPut
-			}
-			b.db.watcher.putEvent(e)
+		if watching {
+			events = append(events, newEvent(record, now))
 		}
 		// put the record back to the pool
 		b.db.recordPool.Put(record)
 	}
+	if watching {
+		b.db.publishEvents(events)
+	}
 
 	b.committed = true
 	return nil
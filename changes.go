@@ -0,0 +1,146 @@
+package rosedb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bwmarrin/snowflake"
+)
+
+// changesReadSize is the max size of the chunks read from the WAL at a time by ChangesSince.
+const changesReadSize = MB
+
+// ChangeCursor is a position in the WAL after a committed batch, where ChangesSince continues from.
+// It increases monotonically with the writes, and can be persisted by String and ParseChangeCursor.
+//
+// The zero ChangeCursor is the beginning of the WAL.
+type ChangeCursor WALPosition
+
+// String encodes the cursor to a string, which can be parsed by ParseChangeCursor.
+func (c ChangeCursor) String() string {
+	return fmt.Sprintf("%d-%d-%d-%d", c.MergeTime, c.SegmentId, c.BlockNumber, c.ChunkOffset)
+}
+
+// ParseChangeCursor parses a cursor encoded by ChangeCursor.String.
+func ParseChangeCursor(s string) (ChangeCursor, error) {
+	var c ChangeCursor
+	n, err := fmt.Sscanf(s, "%d-%d-%d-%d", &c.MergeTime, &c.SegmentId, &c.BlockNumber, &c.ChunkOffset)
+	if err != nil || n != 4 || c.String() != s {
+		return ChangeCursor{}, fmt.Errorf("invalid change cursor %q", s)
+	}
+	return c, nil
+}
+
+// Change is a change of a key committed to the database.
+type Change struct {
+	Action  WatchActionType
+	Key     []byte
+	Value   []byte
+	Expire  int64
+	BatchId uint64
+	// CommitTime is the commit time of the batch in nanoseconds,
+	// it is 0 for the records rewritten by merge and the batches written by the old versions.
+	CommitTime int64
+	// Cursor is the cursor after the batch of the change,
+	// which is where the consumer resumes from after it has handled the batch.
+	Cursor ChangeCursor
+}
+
+// ChangesSince reads the changes committed after the cursor from the WAL,
+// and returns them with the cursor to read the following changes from.
+//
+// The changes of a batch are always returned together, so it returns at least one whole batch if there is any,
+// and stops after the batch which reaches maxChanges, 0 means no limit.
+// The incomplete batches, which were not committed successfully, are skipped.
+//
+// Unlike Watch, the changes are durable and never dropped until they are reclaimed by merge,
+// ErrChangesReclaimed is returned then, and the consumer can start over from the zero cursor,
+// where the merged records are returned as the puts of all the keys.
+func (db *DB) ChangesSince(cursor ChangeCursor, maxChanges int) ([]*Change, ChangeCursor, error) {
+	var changes, pending []*Change
+	var pendingBatchId uint64
+	var done bool
+	next := cursor
+
+	// commit adds the pending changes of the batch ends at pos.
+	commit := func(pos WALPosition) {
+		next = ChangeCursor(pos)
+		for _, change := range pending {
+			change.Cursor = next
+		}
+		changes = append(changes, pending...)
+		pending, pendingBatchId = nil, 0
+		done = maxChanges > 0 && len(changes) >= maxChanges
+	}
+
+	pos := WALPosition(cursor)
+	for !done {
+		var read int
+		end, err := db.ReadWAL(pos, changesReadSize, func(chunk []byte, chunkPos WALPosition) error {
+			read++
+			if done {
+				return nil
+			}
+			record := decodeLogRecord(chunk)
+			batchId := record.BatchId
+			if record.Type == LogRecordBatchFinished {
+				id, err := snowflake.ParseBytes(record.Key)
+				if err != nil {
+					return err
+				}
+				batchId = uint64(id)
+			}
+			// the records of a batch are always written together,
+			// so a batch is incomplete if a record of another batch follows it.
+			if batchId != pendingBatchId {
+				pending = nil
+			}
+			pendingBatchId = batchId
+
+			endPos := chunkEndPosition(chunkPos.chunkPosition(), len(chunk))
+			cursorPos := WALPosition{
+				SegmentId:   endPos.SegmentId,
+				BlockNumber: endPos.BlockNumber,
+				ChunkOffset: endPos.ChunkOffset,
+				MergeTime:   chunkPos.MergeTime,
+			}
+			if record.Type == LogRecordBatchFinished {
+				commitTime := decodeCommitTime(record)
+				for _, change := range pending {
+					change.CommitTime = commitTime
+				}
+				commit(cursorPos)
+				return nil
+			}
+
+			change := &Change{
+				Action:  WatchActionPut,
+				Key:     record.Key,
+				Value:   record.Value,
+				Expire:  record.Expire,
+				BatchId: record.BatchId,
+			}
+			if record.Type == LogRecordDeleted {
+				change.Action = WatchActionDelete
+			}
+			pending = append(pending, change)
+			// the merged records have no batch finished record.
+			if batchId == mergeFinishedBatchID {
+				commit(cursorPos)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrReseedRequired) {
+			return nil, cursor, ErrChangesReclaimed
+		}
+		if err != nil {
+			return nil, cursor, err
+		}
+		// the end of the WAL, the batch at the tail is not finished yet.
+		if read == 0 {
+			break
+		}
+		pos = end
+	}
+	return changes, next, nil
+}
@@ -0,0 +1,115 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/bytebufferpool"
+)
+
+func TestDB_ChangesSince(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = 64 * KB
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	changes, cursor, err := db.ChangesSince(ChangeCursor{}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	assert.NoError(t, batch.Put([]byte("key-1"), []byte("value-1")))
+	assert.NoError(t, batch.Put([]byte("key-2"), []byte("value-2")))
+	require.NoError(t, batch.Commit())
+	time.Sleep(time.Millisecond * 2)
+	require.NoError(t, db.Delete([]byte("key-1")))
+
+	// a batch without the batch finished record is skipped.
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	_, err = db.dataFiles.Write(encodeLogRecord(&LogRecord{
+		Key:     []byte("key-1"),
+		Value:   []byte("garbage"),
+		Type:    LogRecordNormal,
+		BatchId: 1,
+	}, db.encodeHeader, buf))
+	require.NoError(t, err)
+
+	changes, next, err := db.ChangesSince(cursor, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, WatchActionPut, changes[0].Action)
+	assert.Equal(t, []byte("value-1"), changes[0].Value)
+	assert.Equal(t, changes[0].BatchId, changes[1].BatchId)
+	assert.Equal(t, changes[0].Cursor, changes[1].Cursor)
+	assert.True(t, changes[0].CommitTime > 0)
+	assert.Equal(t, WatchActionDelete, changes[2].Action)
+	assert.Equal(t, []byte("key-1"), changes[2].Key)
+	assert.Equal(t, changes[2].Cursor, next)
+
+	// resume from the cursor of a change.
+	changes, _, err = db.ChangesSince(changes[0].Cursor, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, WatchActionDelete, changes[0].Action)
+
+	// a whole batch is returned even if it exceeds maxChanges.
+	changes, _, err = db.ChangesSince(cursor, 1)
+	require.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	// the changes across the segments, and after a restart.
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), make([]byte, 128)))
+	}
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+
+	parsed, err := ParseChangeCursor(next.String())
+	require.NoError(t, err)
+	assert.Equal(t, next, parsed)
+	_, err = ParseChangeCursor("1-2-3")
+	assert.Error(t, err)
+
+	var count int
+	cursor = parsed
+	for {
+		changes, next, err = db.ChangesSince(cursor, 100)
+		require.NoError(t, err)
+		if len(changes) == 0 {
+			assert.Equal(t, cursor, next)
+			break
+		}
+		for _, change := range changes {
+			assert.Equal(t, []byte(fmt.Sprintf("key-%d", count)), change.Key)
+			count++
+		}
+		assert.True(t, next.SegmentId > cursor.SegmentId ||
+			(next.SegmentId == cursor.SegmentId && next.BlockNumber > cursor.BlockNumber) ||
+			(next.SegmentId == cursor.SegmentId && next.BlockNumber == cursor.BlockNumber && next.ChunkOffset > cursor.ChunkOffset))
+		cursor = next
+	}
+	assert.Equal(t, 1000, count)
+
+	// the history is reclaimed by merge, start over from the merged records.
+	require.NoError(t, db.Merge(true))
+	_, _, err = db.ChangesSince(cursor, 0)
+	assert.Equal(t, ErrChangesReclaimed, err)
+	changes, cursor, err = db.ChangesSince(ChangeCursor{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, len(changes))
+	assert.Equal(t, uint64(mergeFinishedBatchID), changes[0].BatchId)
+
+	require.NoError(t, db.Put([]byte("k"), []byte("v")))
+	changes, _, err = db.ChangesSince(cursor, 0)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []byte("k"), changes[0].Key)
+}
@@ -0,0 +1,113 @@
+// Command rosedb-server serves a rosedb database over the redis protocol,
+// so it can be accessed by the existing redis clients.
+//
+// Usage:
+//
+//	rosedb-server -dir <path> [-addr 127.0.0.1:6380]
+//	              [-repl-addr <addr> | -replica-of <addr>]
+//
+// With -repl-addr, the WAL is served to the replicas on the address.
+// With -replica-of, the database is a read only replica of the primary at the address,
+// the write commands are rejected.
+//
+// It shuts down gracefully on SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/rosedblabs/rosedb/v2/replication"
+	"github.com/rosedblabs/rosedb/v2/server"
+)
+
+func main() {
+	dirPath := flag.String("dir", "", "the directory of the database")
+	addr := flag.String("addr", "127.0.0.1:6380", "the address to listen on")
+	sync := flag.Bool("sync", false, "sync the data to disk after each write")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "the max time to wait for the connections to close")
+	replAddr := flag.String("repl-addr", "", "the address to serve the WAL to the replicas on")
+	replicaOf := flag.String("replica-of", "", "the replication address of the primary to follow")
+	flag.Parse()
+	if *dirPath == "" || (*replAddr != "" && *replicaOf != "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := rosedb.DefaultOptions
+	options.DirPath = *dirPath
+	options.Sync = *sync
+
+	var db *rosedb.DB
+	var replica *rosedb.Replica
+	var err error
+	if *replicaOf != "" {
+		if replica, err = rosedb.OpenReplica(options); err != nil {
+			log.Fatalf("open replica: %v", err)
+		}
+		db = replica.DB()
+	} else if db, err = rosedb.Open(options); err != nil {
+		log.Fatalf("open database: %v", err)
+	}
+
+	// the replication stops before the server, so it never writes to a closed database.
+	replCtx, stopReplication := context.WithCancel(context.Background())
+	replDone := make(chan struct{})
+	switch {
+	case *replAddr != "":
+		primary := replication.NewPrimary(db)
+		go func() {
+			defer close(replDone)
+			go func() {
+				<-replCtx.Done()
+				_ = primary.Close()
+			}()
+			if err := primary.ListenAndServe(*replAddr); err != replication.ErrPrimaryClosed {
+				log.Printf("replication: %v", err)
+			}
+		}()
+		log.Printf("replication is listening on %s", *replAddr)
+	case *replicaOf != "":
+		follower := replication.NewFollower(replica, *replicaOf)
+		go func() {
+			defer close(replDone)
+			_ = follower.Run(replCtx)
+		}()
+		log.Printf("replicating from %s", *replicaOf)
+	default:
+		close(replDone)
+	}
+
+	s := server.New(db)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.ListenAndServe(*addr)
+	}()
+	log.Printf("rosedb server is listening on %s", *addr)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sig:
+		log.Println("shutting down")
+	case err = <-serveErr:
+		log.Printf("serve: %v", err)
+	}
+
+	stopReplication()
+	<-replDone
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if err = db.Close(); err != nil {
+		log.Fatalf("close database: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+var errUsage = errors.New("invalid usage")
+
+// command is a subcommand which operates on an opened database.
+type command struct {
+	name  string
+	usage string
+	desc  string
+	run   func(c *cli, args []string) error
+}
+
+var commands = []*command{
+	{name: "get", usage: "get <key>", desc: "print the value of the key", run: (*cli).get},
+	{name: "put", usage: "put [-ttl duration] <key> <value>", desc: "set the value of the key", run: (*cli).put},
+	{name: "del", usage: "del <key>", desc: "delete the key", run: (*cli).del},
+	{name: "scan", usage: "scan [-prefix prefix] [-limit n] [-keys]", desc: "print the key/value pairs in ascending order", run: (*cli).scan},
+	{name: "ttl", usage: "ttl <key>", desc: "print the remaining ttl of the key, -1 if it has no ttl", run: (*cli).ttl},
+	{name: "stat", usage: "stat", desc: "print the statistics of the database", run: (*cli).stat},
+	{name: "merge", usage: "merge", desc: "merge the data files to reclaim the disk space", run: (*cli).merge},
+	{name: "backup", usage: "backup <file>", desc: "write a backup archive to the file, - for stdout", run: (*cli).backup},
+	{name: "dump", usage: "dump [-key key] [-batch id] [-values] [-json]", desc: "print the records in the WAL in the order they are written", run: (*cli).dump},
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printCommands(w io.Writer) {
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-48s %s\n", cmd.usage, cmd.desc)
+	}
+}
+
+// cli executes the commands on the database, and writes the results to out.
+type cli struct {
+	db  *rosedb.DB
+	out io.Writer
+}
+
+// exec executes a command, args[0] is the name of the command.
+func (c *cli) exec(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if err := cmd.run(c, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return fmt.Errorf("usage: %s", cmd.usage)
+		}
+		return err
+	}
+	return nil
+}
+
+// parseFlags parses the flags of a command, and checks the number of the remaining args.
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if fs.NArg() != nArgs {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+func (c *cli) get(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	value, err := c.db.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "%s\n", value)
+	return err
+}
+
+func (c *cli) put(args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "the ttl of the key")
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *ttl > 0 {
+		err = c.db.PutWithTTL([]byte(args[0]), []byte(args[1]), *ttl)
+	} else {
+		err = c.db.Put([]byte(args[0]), []byte(args[1]))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.out, "OK")
+	return err
+}
+
+func (c *cli) del(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := c.db.Delete([]byte(args[0])); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(c.out, "OK")
+	return err
+}
+
+func (c *cli) scan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "only scan the keys with the prefix")
+	limit := fs.Int("limit", 0, "the max number of keys to scan, 0 means no limit")
+	keysOnly := fs.Bool("keys", false, "only print the keys")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	var count int
+	var err error
+	c.db.AscendGreaterOrEqual([]byte(*prefix), func(k, v []byte) (bool, error) {
+		if !bytes.HasPrefix(k, []byte(*prefix)) {
+			return false, nil
+		}
+		if *keysOnly {
+			_, err = fmt.Fprintf(c.out, "%s\n", k)
+		} else {
+			_, err = fmt.Fprintf(c.out, "%s\t%s\n", k, v)
+		}
+		if err != nil {
+			return false, nil
+		}
+		count++
+		return *limit <= 0 || count < *limit, nil
+	})
+	return err
+}
+
+func (c *cli) ttl(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	ttl, err := c.db.TTL([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		_, err = fmt.Fprintln(c.out, "-1")
+	} else {
+		_, err = fmt.Fprintln(c.out, ttl.Round(time.Millisecond))
+	}
+	return err
+}
+
+func (c *cli) stat(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	stat := c.db.Stat()
+	_, err := fmt.Fprintf(c.out, "keys: %d\ndisk size: %d bytes\n", stat.KeysNum, stat.DiskSize)
+	return err
+}
+
+func (c *cli) merge(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := c.db.Merge(true); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(c.out, "OK")
+	return err
+}
+
+func (c *cli) backup(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if args[0] == "-" {
+		return c.db.Backup(c.out)
+	}
+
+	file, err := os.OpenFile(args[0], os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err = c.db.Backup(file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(args[0])
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.out, "OK")
+	return err
+}
+
+// restore restores the backup archive to the directory,
+// it does not open the database, so it is not a command of cli.
+func restore(dirPath string, args []string, in io.Reader) error {
+	if len(args) != 1 {
+		return errors.New("usage: restore <file>")
+	}
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		in = file
+	}
+	return rosedb.Restore(in, dirPath)
+}
+
+func recordTypeName(typ rosedb.LogRecordType) string {
+	switch typ {
+	case rosedb.LogRecordNormal:
+		return "put"
+	case rosedb.LogRecordDeleted:
+		return "delete"
+	case rosedb.LogRecordBatchFinished:
+		return "batch-finished"
+	default:
+		return fmt.Sprintf("unknown(%d)", typ)
+	}
+}
+
+// dumpRecord is the JSON format of rosedb.DumpRecord.
+type dumpRecord struct {
+	SegmentId   uint32 `json:"segment"`
+	BlockNumber uint32 `json:"block"`
+	ChunkOffset int64  `json:"offset"`
+	ChunkSize   uint32 `json:"size"`
+	Type        string `json:"type"`
+	BatchId     uint64 `json:"batch_id"`
+	Expire      int64  `json:"expire,omitempty"`
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	CommitTime  int64  `json:"commit_time,omitempty"`
+	Incomplete  bool   `json:"incomplete,omitempty"`
+}
+
+func (c *cli) dump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	key := fs.String("key", "", "only dump the records of the key")
+	batchId := fs.Uint64("batch", 0, "only dump the records of the batch")
+	withValue := fs.Bool("values", false, "dump the values of the records")
+	jsonLines := fs.Bool("json", false, "dump the records as JSON Lines")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	options := rosedb.DumpOptions{BatchId: *batchId, WithValue: *withValue}
+	if *key != "" {
+		options.Key = []byte(*key)
+	}
+	encoder := json.NewEncoder(c.out)
+	return c.db.DumpWAL(options, func(record *rosedb.DumpRecord) (bool, error) {
+		if *jsonLines {
+			err := encoder.Encode(&dumpRecord{
+				SegmentId:   record.SegmentId,
+				BlockNumber: record.BlockNumber,
+				ChunkOffset: record.ChunkOffset,
+				ChunkSize:   record.ChunkSize,
+				Type:        recordTypeName(record.Type),
+				BatchId:     record.BatchId,
+				Expire:      record.Expire,
+				Key:         string(record.Key),
+				Value:       string(record.Value),
+				CommitTime:  record.CommitTime,
+				Incomplete:  record.Incomplete,
+			})
+			return err == nil, err
+		}
+
+		line := fmt.Sprintf("segment=%d block=%d offset=%d size=%d type=%s batch=%d",
+			record.SegmentId, record.BlockNumber, record.ChunkOffset, record.ChunkSize,
+			recordTypeName(record.Type), record.BatchId)
+		if record.Type == rosedb.LogRecordBatchFinished {
+			if record.CommitTime > 0 {
+				line += " commit=" + time.Unix(0, record.CommitTime).Format(time.RFC3339Nano)
+			}
+		} else {
+			line += fmt.Sprintf(" key=%q", record.Key)
+			if record.Expire > 0 {
+				line += " expire=" + time.Unix(0, record.Expire).Format(time.RFC3339Nano)
+			}
+			if *withValue {
+				line += fmt.Sprintf(" value=%q", record.Value)
+			}
+		}
+		if record.Incomplete {
+			line += " INCOMPLETE"
+		}
+		_, err := fmt.Fprintln(c.out, line)
+		return err == nil, err
+	})
+}
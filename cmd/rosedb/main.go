@@ -0,0 +1,84 @@
+// Command rosedb is a command-line tool for inspecting and operating a rosedb database directory.
+//
+// Usage:
+//
+//	rosedb -dir <path> <command> [args]
+//	rosedb -dir <path>                   start an interactive REPL
+//
+// The database is locked while the tool is running,
+// so it fails if the directory is used by another process.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "rosedb:", err)
+		os.Exit(1)
+	}
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "usage: rosedb -dir <path> [command [args]]")
+	_, _ = fmt.Fprintln(w, "\nstart an interactive REPL if no command is given.")
+	_, _ = fmt.Fprintln(w, "\ncommands:")
+	printCommands(w)
+	_, _ = fmt.Fprintf(w, "  %-48s %s\n", "restore <file>", "restore a backup archive to the directory, - for stdin")
+	_, _ = fmt.Fprintln(w, "\noptions:")
+}
+
+func run(args []string, in io.Reader, out, errOut io.Writer) error {
+	fs := flag.NewFlagSet("rosedb", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.Usage = func() {
+		usage(errOut)
+		fs.PrintDefaults()
+	}
+	dirPath := fs.String("dir", "", "the directory of the database")
+	sync := fs.Bool("sync", false, "sync the data to disk after each write")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *dirPath == "" {
+		fs.Usage()
+		return errors.New("the -dir option is required")
+	}
+
+	// restore writes to an empty directory, there is no database to open.
+	if fs.NArg() > 0 && fs.Arg(0) == "restore" {
+		return restore(*dirPath, fs.Args()[1:], in)
+	}
+
+	options := rosedb.DefaultOptions
+	options.DirPath = *dirPath
+	options.Sync = *sync
+	db, err := rosedb.Open(options)
+	if err != nil {
+		if errors.Is(err, rosedb.ErrDatabaseIsUsing) {
+			return fmt.Errorf("%s is locked by another process", *dirPath)
+		}
+		return err
+	}
+
+	c := &cli{db: db, out: out}
+	if fs.NArg() == 0 {
+		err = c.repl(in, errOut)
+	} else {
+		err = c.exec(fs.Args())
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCommand(dirPath string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	err := run(append([]string{"-dir", dirPath}, args...), strings.NewReader(""), out, &bytes.Buffer{})
+	return out.String(), err
+}
+
+func TestRun_Commands(t *testing.T) {
+	dirPath := filepath.Join(t.TempDir(), "db")
+
+	out, err := runCommand(dirPath, "put", "name", "rosedb")
+	require.NoError(t, err)
+	assert.Equal(t, "OK\n", out)
+	_, err = runCommand(dirPath, "put", "-ttl", "1h", "user:1", "alice")
+	require.NoError(t, err)
+	_, err = runCommand(dirPath, "put", "user:2", "bob")
+	require.NoError(t, err)
+
+	out, err = runCommand(dirPath, "get", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "rosedb\n", out)
+
+	out, err = runCommand(dirPath, "scan", "-prefix", "user:")
+	assert.NoError(t, err)
+	assert.Equal(t, "user:1\talice\nuser:2\tbob\n", out)
+	out, err = runCommand(dirPath, "scan", "-keys", "-limit", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "name\nuser:1\n", out)
+
+	out, err = runCommand(dirPath, "ttl", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "-1\n", out)
+	out, err = runCommand(dirPath, "ttl", "user:1")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "59m59") || out == "1h0m0s\n")
+
+	_, err = runCommand(dirPath, "del", "name")
+	assert.NoError(t, err)
+	_, err = runCommand(dirPath, "get", "name")
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+
+	_, err = runCommand(dirPath, "merge")
+	assert.NoError(t, err)
+	out, err = runCommand(dirPath, "stat")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "keys: 2\n"))
+
+	_, err = runCommand(dirPath, "get")
+	assert.EqualError(t, err, "usage: get <key>")
+	_, err = runCommand(dirPath, "unknown")
+	assert.Error(t, err)
+}
+
+func TestRun_BackupRestore(t *testing.T) {
+	dirPath := filepath.Join(t.TempDir(), "db")
+	backupPath := filepath.Join(t.TempDir(), "backup.tar")
+	restorePath := filepath.Join(t.TempDir(), "restored")
+
+	_, err := runCommand(dirPath, "put", "name", "rosedb")
+	require.NoError(t, err)
+	_, err = runCommand(dirPath, "backup", backupPath)
+	require.NoError(t, err)
+	_, err = runCommand(restorePath, "restore", backupPath)
+	require.NoError(t, err)
+
+	out, err := runCommand(restorePath, "get", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "rosedb\n", out)
+}
+
+func TestRun_Locked(t *testing.T) {
+	options := rosedb.DefaultOptions
+	options.DirPath = filepath.Join(t.TempDir(), "db")
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err = runCommand(options.DirPath, "stat")
+	assert.Error(t, err)
+}
+
+func TestRun_REPL(t *testing.T) {
+	dirPath := filepath.Join(t.TempDir(), "db")
+	in := strings.NewReader("put \"hello world\" \"a \\\"quoted\\\" value\"\nget \"hello world\"\nget missing\nexit\nget never\n")
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+
+	err := run([]string{"-dir", dirPath}, in, out, errOut)
+	require.NoError(t, err)
+	assert.Equal(t, replPrompt+"OK\n"+replPrompt+"a \"quoted\" value\n"+replPrompt+replPrompt, out.String())
+	assert.Equal(t, "error: key not found in database\n", errOut.String())
+}
+
+func TestRun_Dump(t *testing.T) {
+	dirPath := filepath.Join(t.TempDir(), "db")
+
+	_, err := runCommand(dirPath, "put", "name", "rosedb")
+	require.NoError(t, err)
+	_, err = runCommand(dirPath, "del", "name")
+	require.NoError(t, err)
+
+	out, err := runCommand(dirPath, "dump", "-key", "name", "-values")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], "type=put")
+	assert.Contains(t, lines[0], `key="name" value="rosedb"`)
+	assert.Contains(t, lines[1], "type=delete")
+
+	out, err = runCommand(dirPath, "dump", "-json")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	require.Equal(t, 4, len(lines))
+	var record dumpRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "batch-finished", record.Type)
+	assert.True(t, record.CommitTime > 0)
+	assert.False(t, record.Incomplete)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const replPrompt = "rosedb> "
+
+// repl reads the commands from in line by line and executes them,
+// until in is closed or the exit command is received.
+// The error of a command is written to errOut, and will not stop the REPL.
+func (c *cli) repl(in io.Reader, errOut io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		_, _ = fmt.Fprint(c.out, replPrompt)
+		if !scanner.Scan() {
+			_, _ = fmt.Fprintln(c.out)
+			return scanner.Err()
+		}
+
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			_, _ = fmt.Fprintln(errOut, "error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			printCommands(c.out)
+			_, _ = fmt.Fprintf(c.out, "  %-48s %s\n", "exit", "exit the REPL")
+			continue
+		case "restore":
+			_, _ = fmt.Fprintln(errOut, "error: restore is not supported in the REPL, the database is opened")
+			continue
+		}
+		if err = c.exec(args); err != nil {
+			_, _ = fmt.Fprintln(errOut, "error:", err)
+		}
+	}
+}
+
+// splitArgs splits a line into args by whitespace,
+// an arg can be quoted by double quotes to contain whitespace.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var inArg, quoted bool
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quoted && ch == '\\' && i+1 < len(line):
+			i++
+			arg.WriteByte(line[i])
+		case ch == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (ch == ' ' || ch == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,535 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/rosedblabs/wal"
+)
+
+// DataType is the type of the value of a key stored by the data type APIs, such as Hash and List.
+//
+// The data types are stored in the same key space as the plain key-value pairs,
+// the keys starting with the byte 0x00 followed by 'm' or 'd' are reserved for them:
+//
+//	meta key:   0x00 | 'm' | key                             -> type | count | head | tail
+//	member key: 0x00 | 'd' | uvarint(len(key)) | key | member -> value
+//
+// Each key has a meta record, and its members are stored under the member keys, which are sorted by member,
+// so the members of a key can be scanned by the index in order.
+// The expiration time of a key is only kept in its meta record, so the ttl is changed by rewriting the meta only.
+// The members are not visible once the meta record expires, they are deleted when the key is written again,
+// and merge reclaims the members whose meta record is gone.
+type DataType byte
+
+const (
+	DataTypeHash DataType = iota + 1
+	DataTypeList
+	DataTypeZSet
+	DataTypeSet
+	DataTypeQueue
+	DataTypeStream
+)
+
+func (t DataType) String() string {
+	switch t {
+	case DataTypeHash:
+		return "hash"
+	case DataTypeList:
+		return "list"
+	case DataTypeZSet:
+		return "zset"
+	case DataTypeSet:
+		return "set"
+	case DataTypeQueue:
+		return "queue"
+	case DataTypeStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	dataKeyPrefix = 0x00
+	metaKeyTag    = 'm'
+	memberKeyTag  = 'd'
+)
+
+// dataMeta is the meta record of a data type key.
+// head and tail are used by the data types which keep the members in a sequence, such as List.
+type dataMeta struct {
+	dataType DataType
+	count    uint64
+	head     uint64
+	tail     uint64
+	expire   int64 // the expiration time of the whole value of the key
+}
+
+func encodeMetaKey(key []byte) []byte {
+	buf := make([]byte, 0, len(key)+2)
+	buf = append(buf, dataKeyPrefix, metaKeyTag)
+	return append(buf, key...)
+}
+
+// encodeMemberPrefix returns the prefix of the member keys of the key.
+func encodeMemberPrefix(key []byte) []byte {
+	buf := make([]byte, 0, len(key)+2+binary.MaxVarintLen64)
+	buf = append(buf, dataKeyPrefix, memberKeyTag)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	return append(buf, key...)
+}
+
+func encodeMemberKey(key, member []byte) []byte {
+	return append(encodeMemberPrefix(key), member...)
+}
+
+// decodeMemberKey returns the key which the member key belongs to, ok is false if it is not a member key.
+func decodeMemberKey(memberKey []byte) (key []byte, ok bool) {
+	if len(memberKey) < 2 || memberKey[0] != dataKeyPrefix || memberKey[1] != memberKeyTag {
+		return nil, false
+	}
+	size, n := binary.Uvarint(memberKey[2:])
+	if n <= 0 || uint64(len(memberKey)-2-n) < size {
+		return nil, false
+	}
+	return memberKey[2+n : 2+n+int(size)], true
+}
+
+func (m *dataMeta) encode() []byte {
+	buf := make([]byte, 0, 1+3*binary.MaxVarintLen64)
+	buf = append(buf, byte(m.dataType))
+	buf = binary.AppendUvarint(buf, m.count)
+	buf = binary.AppendUvarint(buf, m.head)
+	return binary.AppendUvarint(buf, m.tail)
+}
+
+func decodeMeta(buf []byte, expire int64) *dataMeta {
+	meta := &dataMeta{dataType: DataType(buf[0]), expire: expire}
+	var n int
+	index := 1
+	meta.count, n = binary.Uvarint(buf[index:])
+	index += n
+	meta.head, n = binary.Uvarint(buf[index:])
+	index += n
+	meta.tail, _ = binary.Uvarint(buf[index:])
+	return meta
+}
+
+// indexRange converts the start and stop index which may be negative to the offsets in [from, to)
+// of the members of a data type with length members, -1 is the last member.
+func indexRange(length uint64, start, stop int64) (uint64, uint64) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop, n-1)
+	if start > stop {
+		return 0, 0
+	}
+	return uint64(start), uint64(stop) + 1
+}
+
+// getRecord returns the record of the key in the batch or the database,
+// ErrKeyNotFound is returned if the key is deleted or expired.
+func (b *Batch) getRecord(key []byte) (*LogRecord, error) {
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+	now := time.Now().UnixNano()
+	b.mu.RLock()
+	record := b.lookupPendingWrites(key)
+	b.mu.RUnlock()
+	if record == nil {
+		position := b.db.index.Get(key)
+		if position == nil {
+			return nil, ErrKeyNotFound
+		}
+		chunk, err := b.db.dataFiles.Read(position)
+		if err != nil {
+			return nil, err
+		}
+		record = decodeLogRecord(chunk)
+	}
+	if record.Type == LogRecordDeleted || record.IsExpired(now) {
+		return nil, ErrKeyNotFound
+	}
+	return record, nil
+}
+
+// putRecord adds a key-value pair with the absolute expiration time to the batch, 0 means never expire.
+func (b *Batch) putRecord(key, value []byte, expire int64) error {
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	record := b.lookupPendingWrites(key)
+	if record == nil {
+		record = b.db.recordPool.Get().(*LogRecord)
+		b.appendPendingWrites(key, record)
+	}
+	record.Key, record.Value = key, value
+	record.Type, record.Expire = LogRecordNormal, expire
+	b.mu.Unlock()
+	return nil
+}
+
+// getMeta returns the meta record of the key,
+// a new meta record of the data type is returned if the key does not exist,
+// and ErrWrongType if the key holds another data type.
+// In a write batch, the members left by the expired value of the key are deleted before it is created again.
+func (b *Batch) getMeta(key []byte, dataType DataType) (*dataMeta, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err == ErrKeyNotFound {
+		if !b.options.ReadOnly {
+			if err = b.deleteMembers(key); err != nil {
+				return nil, err
+			}
+		}
+		return &dataMeta{dataType: dataType}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := decodeMeta(record.Value, record.Expire)
+	if meta.dataType != dataType {
+		return nil, ErrWrongType
+	}
+	return meta, nil
+}
+
+// putMeta writes the meta record of the key, the key is deleted if it has no members.
+func (b *Batch) putMeta(key []byte, meta *dataMeta) error {
+	if meta.count == 0 {
+		return b.Delete(encodeMetaKey(key))
+	}
+	return b.putRecord(encodeMetaKey(key), meta.encode(), meta.expire)
+}
+
+// membersHidden returns whether the member records of the key are left by its expired value and must be skipped.
+// It only happens in the read only batches, a write batch deletes them by getMeta before the key is written again.
+func (b *Batch) membersHidden(key []byte) (bool, error) {
+	if !b.options.ReadOnly {
+		return false, nil
+	}
+	_, err := b.getRecord(encodeMetaKey(key))
+	if err == ErrKeyNotFound {
+		return true, nil
+	}
+	return false, err
+}
+
+// getMember returns the value of the member of the key,
+// ErrKeyNotFound is returned if the member or the key does not exist.
+func (b *Batch) getMember(key, member []byte) ([]byte, error) {
+	if hidden, err := b.membersHidden(key); err != nil || hidden {
+		if err == nil {
+			err = ErrKeyNotFound
+		}
+		return nil, err
+	}
+	record, err := b.getRecord(encodeMemberKey(key, member))
+	if err != nil {
+		return nil, err
+	}
+	return record.Value, nil
+}
+
+// putMember writes a member of the key, the member expires with the meta record of the key.
+func (b *Batch) putMember(key, member, value []byte) error {
+	return b.putRecord(encodeMemberKey(key, member), value, 0)
+}
+
+func (b *Batch) deleteMember(key, member []byte) error {
+	return b.Delete(encodeMemberKey(key, member))
+}
+
+// scanMembers calls handleFn for each member of the key in the order of the members,
+// starting from the member start, or ending at it if reverse is true, nil means from the first or the last.
+// The members written in the batch are also included.
+func (b *Batch) scanMembers(key, start []byte, reverse bool, handleFn func(member, value []byte) (bool, error)) error {
+	if hidden, err := b.membersHidden(key); err != nil || hidden {
+		return err
+	}
+	return b.scanMemberRecords(key, start, reverse, handleFn)
+}
+
+// scanMemberRecords is the same as scanMembers, but it does not check whether the key exists,
+// so the members left by the expired value of the key are also scanned.
+func (b *Batch) scanMemberRecords(key, start []byte, reverse bool, handleFn func(member, value []byte) (bool, error)) error {
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	prefix := encodeMemberPrefix(key)
+	now := time.Now().UnixNano()
+
+	// the pending writes of the key, sorted in the order of the scan.
+	b.mu.RLock()
+	var pending []*LogRecord
+	for _, record := range b.pendingWrites {
+		if bytes.HasPrefix(record.Key, prefix) {
+			pending = append(pending, record)
+		}
+	}
+	b.mu.RUnlock()
+	// before returns whether the key a is before b in the order of the scan.
+	before := func(a, b []byte) bool {
+		if reverse {
+			return bytes.Compare(a, b) > 0
+		}
+		return bytes.Compare(a, b) < 0
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return before(pending[i].Key, pending[j].Key)
+	})
+
+	startKey := prefix
+	if start != nil {
+		startKey = encodeMemberKey(key, start)
+	} else if reverse {
+		startKey = prefixEnd(prefix)
+	}
+	for len(pending) > 0 && before(pending[0].Key, startKey) {
+		pending = pending[1:]
+	}
+
+	var stopped bool
+	var handleErr error
+	emit := func(record *LogRecord) bool {
+		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			return true
+		}
+		next, err := handleFn(record.Key[len(prefix):], record.Value)
+		if err != nil || !next {
+			stopped, handleErr = true, err
+			return false
+		}
+		return true
+	}
+
+	var readErr error
+	scanFn := func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			// the key after the members is skipped in the reverse scan.
+			return reverse && bytes.Compare(k, prefix) > 0, nil
+		}
+		// the pending writes before the key in the index.
+		for len(pending) > 0 && before(pending[0].Key, k) {
+			if !emit(pending[0]) {
+				return false, nil
+			}
+			pending = pending[1:]
+		}
+		if len(pending) > 0 && bytes.Equal(pending[0].Key, k) {
+			record := pending[0]
+			pending = pending[1:]
+			return emit(record), nil
+		}
+		chunk, err := b.db.dataFiles.Read(pos)
+		if err != nil {
+			readErr = err
+			return false, nil
+		}
+		return emit(decodeLogRecord(chunk)), nil
+	}
+	if reverse {
+		b.db.index.DescendLessOrEqual(startKey, scanFn)
+	} else {
+		b.db.index.AscendGreaterOrEqual(startKey, scanFn)
+	}
+	if readErr != nil {
+		return readErr
+	}
+	for !stopped && len(pending) > 0 {
+		emit(pending[0])
+		pending = pending[1:]
+	}
+	return handleErr
+}
+
+// prefixEnd returns the smallest key which is greater than all the keys with the prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// deleteMembers deletes all the member records of the key, including the ones of its expired value.
+func (b *Batch) deleteMembers(key []byte) error {
+	var members [][]byte
+	err := b.scanMemberRecords(key, nil, false, func(member, _ []byte) (bool, error) {
+		members = append(members, bytes.Clone(member))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if err = b.deleteMember(key, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteData deletes the meta record and all the members of the key.
+func (b *Batch) deleteData(key []byte) (bool, error) {
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = b.deleteMembers(key); err != nil {
+		return false, err
+	}
+	return true, b.Delete(record.Key)
+}
+
+// setDataExpire rewrites the meta record of the key with the expiration time,
+// the members are not rewritten since they expire with the meta record.
+func (b *Batch) setDataExpire(key []byte, expire int64) error {
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err != nil {
+		return err
+	}
+	return b.putRecord(record.Key, record.Value, expire)
+}
+
+// DataType returns the data type of the key, ErrKeyNotFound is returned if the key does not exist.
+func (b *Batch) DataType(key []byte) (DataType, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err != nil {
+		return 0, err
+	}
+	return DataType(record.Value[0]), nil
+}
+
+// DeleteData deletes the value of the key of any data type, and returns whether the key existed.
+func (b *Batch) DeleteData(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	return b.deleteData(key)
+}
+
+// ExpireData sets the ttl of the whole value of the key of any data type.
+func (b *Batch) ExpireData(key []byte, ttl time.Duration) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return b.setDataExpire(key, time.Now().Add(ttl).UnixNano())
+}
+
+// PersistData removes the ttl of the key of any data type.
+func (b *Batch) PersistData(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return b.setDataExpire(key, 0)
+}
+
+// DataTTL returns the ttl of the key of any data type, -1 means the key never expires.
+func (b *Batch) DataTTL(key []byte) (time.Duration, error) {
+	if len(key) == 0 {
+		return -1, ErrKeyIsEmpty
+	}
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err != nil {
+		return -1, err
+	}
+	if record.Expire == 0 {
+		return -1, nil
+	}
+	return time.Duration(record.Expire - time.Now().UnixNano()), nil
+}
+
+// update runs fn in a write batch, and commits the batch if fn succeeds.
+func (db *DB) update(fn func(batch *Batch) error) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := fn(batch); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// view runs fn in a read only batch.
+func (db *DB) view(fn func(batch *Batch) error) error {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return fn(batch)
+}
+
+// DataType returns the data type of the key, ErrKeyNotFound is returned if the key does not exist.
+func (db *DB) DataType(key []byte) (dataType DataType, err error) {
+	err = db.view(func(batch *Batch) error {
+		dataType, err = batch.DataType(key)
+		return err
+	})
+	return
+}
+
+// DeleteData deletes the value of the key of any data type, and returns whether the key existed.
+func (db *DB) DeleteData(key []byte) (deleted bool, err error) {
+	err = db.update(func(batch *Batch) error {
+		deleted, err = batch.DeleteData(key)
+		return err
+	})
+	return
+}
+
+// ExpireData sets the ttl of the whole value of the key of any data type.
+func (db *DB) ExpireData(key []byte, ttl time.Duration) error {
+	return db.update(func(batch *Batch) error {
+		return batch.ExpireData(key, ttl)
+	})
+}
+
+// PersistData removes the ttl of the key of any data type.
+func (db *DB) PersistData(key []byte) error {
+	return db.update(func(batch *Batch) error {
+		return batch.PersistData(key)
+	})
+}
+
+// DataTTL returns the ttl of the key of any data type, -1 means the key never expires.
+func (db *DB) DataTTL(key []byte) (ttl time.Duration, err error) {
+	err = db.view(func(batch *Batch) error {
+		ttl, err = batch.DataTTL(key)
+		return err
+	})
+	return
+}
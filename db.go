@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,6 +21,9 @@ import (
 	"github.com/rosedblabs/wal"
 )
 
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
+	cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 const (
 	fileLockName       = "FLOCK"
 	dataFileNameSuffix = ".SEG"
@@ -54,8 +58,14 @@ type DB struct {
 	encodeHeader     []byte
 	watchCh          chan *Event // user consume channel for watch events
 	watcher          *Watcher
-	expiredCursorKey []byte     // the location to which DeleteExpiredKeys executes.
-	cronScheduler    *cron.Cron // cron scheduler for auto merge task
+	subscriptions    map[*Subscription]struct{} // the subscriptions created by Subscribe
+	subMu            sync.RWMutex
+	expiredCursorKey []byte                     // the location to which DeleteExpiredKeys executes.
+	cronScheduler    *cron.Cron                 // cron scheduler for auto merge and index checkpoint task
+	checkpointMu     sync.Mutex                 // only one index checkpoint can be written at the same time
+	recoveryTarget   *recoveryTarget            // only load the batches committed before the target, see OpenAt
+	readOnly         bool                       // the database is opened in read only mode, see OpenAt
+	secondaryIndexes map[string]*secondaryIndex // the secondary indexes created by CreateIndex
 }
 
 // Stat represents the statistics of the database.
@@ -75,6 +85,13 @@ type Stat struct {
 // It will open the wal files in the database directory and load the index from them.
 // Return the DB instance, or an error if any.
 func Open(options Options) (*DB, error) {
+	return open(options, nil)
+}
+
+// open a database with the specified options,
+// if the recovery target is not nil, the database will be opened in read only mode,
+// and only the batches committed before the target will be loaded.
+func open(options Options, target *recoveryTarget) (*DB, error) {
 	// check options
 	if err := checkOptions(options); err != nil {
 		return nil, err
@@ -97,19 +114,29 @@ func Open(options Options) (*DB, error) {
 		return nil, ErrDatabaseIsUsing
 	}
 
-	// load merge files if exists
-	if err = loadMergeFiles(options.DirPath); err != nil {
+	// load merge files if exists.
+	// a merge which has not been loaded must be ignored in recovery,
+	// because it would remove the history of the original data files.
+	if target == nil {
+		if err = loadMergeFiles(options.DirPath); err != nil {
+			return nil, err
+		}
+	} else if err = target.checkMergeFinTime(options.DirPath); err != nil {
+		_ = fileLock.Unlock()
 		return nil, err
 	}
 
 	// init DB instance
 	db := &DB{
-		index:        index.NewIndexer(),
-		options:      options,
-		fileLock:     fileLock,
-		batchPool:    sync.Pool{New: newBatch},
-		recordPool:   sync.Pool{New: newRecord},
-		encodeHeader: make([]byte, maxLogRecordHeaderSize),
+		index:          index.NewIndexer(),
+		options:        options,
+		fileLock:       fileLock,
+		batchPool:      sync.Pool{New: newBatch},
+		recordPool:     sync.Pool{New: newRecord},
+		encodeHeader:   make([]byte, maxLogRecordHeaderSize),
+		subscriptions:  make(map[*Subscription]struct{}),
+		recoveryTarget: target,
+		readOnly:       target != nil,
 	}
 
 	// open data files
@@ -130,14 +157,17 @@ func Open(options Options) (*DB, error) {
 		go db.watcher.sendEvent(db.watchCh)
 	}
 
+	if db.readOnly {
+		return db, nil
+	}
+
+	if len(options.AutoMergeCronExpr) > 0 ||
+		(options.IndexCheckpoint && len(options.IndexCheckpointCronExpr) > 0) {
+		db.cronScheduler = cron.New(cron.WithParser(cronParser))
+	}
+
 	// enable auto merge task
 	if len(options.AutoMergeCronExpr) > 0 {
-		db.cronScheduler = cron.New(
-			cron.WithParser(
-				cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
-					cron.Dom | cron.Month | cron.Dow | cron.Descriptor),
-			),
-		)
 		_, err = db.cronScheduler.AddFunc(options.AutoMergeCronExpr, func() {
 			// maybe we should deal with different errors with different logic,
 			// but a background task can't omit its error.
@@ -147,6 +177,21 @@ func Open(options Options) (*DB, error) {
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	// enable index checkpoint task
+	if options.IndexCheckpoint && len(options.IndexCheckpointCronExpr) > 0 {
+		_, err = db.cronScheduler.AddFunc(options.IndexCheckpointCronExpr, func() {
+			// the checkpoint will be written again on the next schedule or on Close,
+			// and the startup falls back to a full replay if there is no valid checkpoint.
+			_ = db.writeIndexCheckpoint()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if db.cronScheduler != nil {
 		db.cronScheduler.Start()
 	}
 
@@ -168,13 +213,41 @@ func (db *DB) openWalFiles() (*wal.WAL, error) {
 	return walFiles, nil
 }
 
+// sealActiveSegment rotates the active segment file if it is not empty,
+// so all the data written before is in the older segment files, which are immutable.
+// The caller must hold the lock of the database.
+func (db *DB) sealActiveSegment() error {
+	activeSegId := db.dataFiles.ActiveSegmentID()
+	stat, err := os.Stat(wal.SegmentFileName(db.options.DirPath, dataFileNameSuffix, activeSegId))
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		return nil
+	}
+	return db.dataFiles.OpenNewActiveSegment()
+}
+
 func (db *DB) loadIndex() error {
+	// load index from the index checkpoint if enabled,
+	// then only the WAL after the checkpoint needs to be replayed.
+	var replaySegId wal.SegmentID
+	var loaded bool
+	// the checkpoint may cover the batches after the recovery target, so it can't be used in recovery.
+	if db.options.IndexCheckpoint && db.recoveryTarget == nil {
+		var err error
+		if replaySegId, loaded, err = db.loadIndexFromCheckpoint(); err != nil {
+			return err
+		}
+	}
 	// load index from hint file
-	if err := db.loadIndexFromHintFile(); err != nil {
-		return err
+	if !loaded {
+		if err := db.loadIndexFromHintFile(); err != nil {
+			return err
+		}
 	}
 	// load index from data files
-	if err := db.loadIndexFromWAL(); err != nil {
+	if err := db.loadIndexFromWAL(replaySegId); err != nil {
 		return err
 	}
 	return nil
@@ -184,6 +257,9 @@ func (db *DB) loadIndex() error {
 // Set the closed flag to true.
 // The DB instance cannot be used after closing.
 func (db *DB) Close() error {
+	// release the writers blocked by the subscriptions, so the lock of the database can be taken.
+	db.releaseSubscriptions()
+
 	// close auto merge cron scheduler first to prevent new merge from starting
 	if db.cronScheduler != nil {
 		db.cronScheduler.Stop()
@@ -194,6 +270,13 @@ func (db *DB) Close() error {
 		time.Sleep(time.Millisecond * 100)
 	}
 
+	// write the index checkpoint for fast restarts,
+	// the error will be returned after all the resources are released.
+	var checkpointErr error
+	if db.options.IndexCheckpoint && !db.readOnly {
+		checkpointErr = db.writeIndexCheckpoint()
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -211,9 +294,10 @@ func (db *DB) Close() error {
 		db.watcher.Close()
 		close(db.watchCh)
 	}
+	db.closeSubscriptions()
 
 	db.closed = true
-	return nil
+	return checkpointErr
 }
 
 // closeFiles close all data files and hint file
@@ -404,8 +488,12 @@ func (db *DB) Ascend(handleFn func(k, v []byte) (bool, error)) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	reader := newReadAhead(db)
+	defer func() {
+		_ = reader.close()
+	}()
 	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := reader.read(pos)
 		if err != nil {
 			return false, err
 		}
@@ -421,8 +509,12 @@ func (db *DB) AscendRange(startKey, endKey []byte, handleFn func(k, v []byte) (b
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	reader := newReadAhead(db)
+	defer func() {
+		_ = reader.close()
+	}()
 	db.index.AscendRange(startKey, endKey, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := reader.read(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -438,8 +530,12 @@ func (db *DB) AscendGreaterOrEqual(key []byte, handleFn func(k, v []byte) (bool,
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	reader := newReadAhead(db)
+	defer func() {
+		_ = reader.close()
+	}()
 	db.index.AscendGreaterOrEqual(key, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := reader.read(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -659,86 +755,213 @@ func checkOptions(options Options) error {
 	}
 
 	if len(options.AutoMergeCronExpr) > 0 {
-		if _, err := cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor).
-			Parse(options.AutoMergeCronExpr); err != nil {
+		if _, err := cronParser.Parse(options.AutoMergeCronExpr); err != nil {
 			return fmt.Errorf("database auto merge cron expression is invalid, err: %s", err)
 		}
 	}
 
+	if len(options.IndexCheckpointCronExpr) > 0 {
+		if _, err := cronParser.Parse(options.IndexCheckpointCronExpr); err != nil {
+			return fmt.Errorf("database index checkpoint cron expression is invalid, err: %s", err)
+		}
+	}
+
 	return nil
 }
 
 // loadIndexFromWAL loads index from WAL.
 // It will iterate over all the WAL files and read data
 // from them to rebuild the index.
-func (db *DB) loadIndexFromWAL() error {
+//
+// The segments whose id is less than replaySegId will be skipped,
+// because they have been loaded from the index checkpoint.
+//
+// The segments are decoded in parallel by Options.IndexLoadWorkers goroutines,
+// but the decoded records are always applied to the index in segment order,
+// so the atomicity of batches and the last-writer-wins semantics are kept.
+func (db *DB) loadIndexFromWAL(replaySegId wal.SegmentID) error {
 	mergeFinSegmentId, err := getMergeFinSegmentId(db.options.DirPath)
 	if err != nil {
 		return err
 	}
+	allSegIds, err := listSegmentIds(db.options.DirPath, dataFileNameSuffix)
+	if err != nil {
+		return err
+	}
+	// if the segment id is less than the mergeFinSegmentId,
+	// we can skip this segment because it has been merged,
+	// and we can load index from the hint file directly.
+	// And the segments covered by the index checkpoint can be skipped too.
+	segIds := make([]wal.SegmentID, 0, len(allSegIds))
+	for _, segId := range allSegIds {
+		if segId > mergeFinSegmentId && segId >= replaySegId {
+			segIds = append(segIds, segId)
+		}
+	}
+	if len(segIds) == 0 {
+		return nil
+	}
+
+	workers := db.options.IndexLoadWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(segIds) {
+		workers = len(segIds)
+	}
+
+	// the order of the defers is important,
+	// we must stop the dispatcher and wait for all the readers to exit
+	// before the startup traversal flag is reset.
+	db.dataFiles.SetIsStartupTraversal(true)
+	defer db.dataFiles.SetIsStartupTraversal(false)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done)
+
+	// the tokens limit the number of segments being decoded or waiting to be applied,
+	// so the memory usage is bounded no matter how many segments there are.
+	tokens := make(chan struct{}, workers)
+	results := make([]chan *segmentRecords, len(segIds))
+	for i := range results {
+		results[i] = make(chan *segmentRecords, 1)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, segId := range segIds {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			wg.Add(1)
+			go func(i int, segId wal.SegmentID) {
+				defer wg.Done()
+				results[i] <- db.readSegmentRecords(segId)
+			}(i, segId)
+		}
+	}()
+
 	indexRecords := make(map[uint64][]*IndexRecord)
 	now := time.Now().UnixNano()
-	// get a reader for WAL
-	reader := db.dataFiles.NewReader()
-	db.dataFiles.SetIsStartupTraversal(true)
-	for {
-		// if the current segment id is less than the mergeFinSegmentId,
-		// we can skip this segment because it has been merged,
-		// and we can load index from the hint file directly.
-		if reader.CurrentSegmentId() <= mergeFinSegmentId {
-			reader.SkipCurrentSegment()
-			continue
+	for i := range segIds {
+		segRecords := <-results[i]
+		<-tokens
+		if segRecords.err != nil {
+			return segRecords.err
+		}
+
+		for j, record := range segRecords.records {
+			position := segRecords.positions[j]
+			// if we get the end of a batch,
+			// all records in this batch are ready to be indexed.
+			if record.Type == LogRecordBatchFinished {
+				batchId, err := snowflake.ParseBytes(record.Key)
+				if err != nil {
+					return err
+				}
+				// the batch is committed after the recovery target, ignore it.
+				if db.recoveryTarget != nil && !db.recoveryTarget.includes(uint64(batchId), decodeCommitTime(record)) {
+					delete(indexRecords, uint64(batchId))
+					continue
+				}
+				for _, idxRecord := range indexRecords[uint64(batchId)] {
+					if idxRecord.recordType == LogRecordNormal {
+						db.index.Put(idxRecord.key, idxRecord.position)
+					}
+					if idxRecord.recordType == LogRecordDeleted {
+						db.index.Delete(idxRecord.key)
+					}
+				}
+				// delete indexRecords according to batchId after indexing
+				delete(indexRecords, uint64(batchId))
+			} else if record.Type == LogRecordNormal && record.BatchId == mergeFinishedBatchID {
+				// if the record is a normal record and the batch id is 0,
+				// it means that the record is involved in the merge operation.
+				// so put the record into index directly.
+				db.index.Put(record.Key, position)
+			} else {
+				// expired records should not be indexed,
+				// but in recovery, we can't know whether the batch of the record will be loaded,
+				// so the expired records will be checked when reading.
+				if record.IsExpired(now) && db.recoveryTarget == nil {
+					db.index.Delete(record.Key)
+					continue
+				}
+				// put the record into the temporary indexRecords
+				indexRecords[record.BatchId] = append(indexRecords[record.BatchId],
+					&IndexRecord{
+						key:        record.Key,
+						recordType: record.Type,
+						position:   position,
+					})
+			}
 		}
 
+		if db.options.IndexLoadProgress != nil {
+			db.options.IndexLoadProgress(i+1, len(segIds))
+		}
+	}
+	return nil
+}
+
+// segmentRecords is the decoded records of a segment file, and their positions.
+type segmentRecords struct {
+	records   []*LogRecord
+	positions []*wal.ChunkPosition
+	err       error
+}
+
+// readSegmentRecords reads and decodes all the records of the specified segment file.
+// The values of the records are dropped, because they are useless for the index.
+func (db *DB) readSegmentRecords(segId wal.SegmentID) *segmentRecords {
+	segRecords := &segmentRecords{}
+	reader := db.dataFiles.NewReaderWithMax(segId)
+	for reader.CurrentSegmentId() < segId {
+		reader.SkipCurrentSegment()
+	}
+	for {
 		chunk, position, err := reader.Next()
 		if err != nil {
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				segRecords.err = err
 			}
-			return err
+			return segRecords
 		}
-		// decode and get log record
 		record := decodeLogRecord(chunk)
+		// the value of the batch finished record is the commit time of the batch.
+		if record.Type != LogRecordBatchFinished {
+			record.Value = nil
+		}
+		segRecords.records = append(segRecords.records, record)
+		segRecords.positions = append(segRecords.positions, position)
+	}
+}
 
-		// if we get the end of a batch,
-		// all records in this batch are ready to be indexed.
-		if record.Type == LogRecordBatchFinished {
-			batchId, err := snowflake.ParseBytes(record.Key)
-			if err != nil {
-				return err
-			}
-			for _, idxRecord := range indexRecords[uint64(batchId)] {
-				if idxRecord.recordType == LogRecordNormal {
-					db.index.Put(idxRecord.key, idxRecord.position)
-				}
-				if idxRecord.recordType == LogRecordDeleted {
-					db.index.Delete(idxRecord.key)
-				}
-			}
-			// delete indexRecords according to batchId after indexing
-			delete(indexRecords, uint64(batchId))
-		} else if record.Type == LogRecordNormal && record.BatchId == mergeFinishedBatchID {
-			// if the record is a normal record and the batch id is 0,
-			// it means that the record is involved in the merge operation.
-			// so put the record into index directly.
-			db.index.Put(record.Key, position)
-		} else {
-			// expired records should not be indexed
-			if record.IsExpired(now) {
-				db.index.Delete(record.Key)
-				continue
-			}
-			// put the record into the temporary indexRecords
-			indexRecords[record.BatchId] = append(indexRecords[record.BatchId],
-				&IndexRecord{
-					key:        record.Key,
-					recordType: record.Type,
-					position:   position,
-				})
+// listSegmentIds returns the ids of all the segment files with the specified extension
+// in the directory, in ascending order.
+func listSegmentIds(dirPath, ext string) ([]wal.SegmentID, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var segIds []wal.SegmentID
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		var id int
+		if _, err := fmt.Sscanf(entry.Name(), "%d"+ext, &id); err != nil {
+			continue
 		}
+		segIds = append(segIds, wal.SegmentID(id))
 	}
-	db.dataFiles.SetIsStartupTraversal(false)
-	return nil
+	sort.Slice(segIds, func(i, j int) bool {
+		return segIds[i] < segIds[j]
+	})
+	return segIds, nil
 }
 
 // DeleteExpiredKeys scan the entire index in ascending order to delete expired keys.
@@ -783,6 +1006,11 @@ func (db *DB) DeleteExpiredKeys(timeout time.Duration) error {
 				record := decodeLogRecord(chunk)
 				if record.IsExpired(now) {
 					db.index.Delete(record.Key)
+					if db.watching() {
+						e := newEvent(record, 0)
+						e.Action = WatchActionExpire
+						db.publishEvents([]*Event{e})
+					}
 				}
 				db.expiredCursorKey = record.Key
 			}
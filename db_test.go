@@ -1197,3 +1197,61 @@ func TestDB_Reopen_With_Data(t *testing.T) {
 		assert.NotNil(t, val)
 	}
 }
+
+func TestDB_Parallel_Load_Index(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = MB
+	options.IndexLoadWorkers = 1
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 20000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	// overwrite and delete keys in later segments, the last writer must win.
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	for i := 5000; i < 8000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+	batch := db.NewBatch(DefaultBatchOptions)
+	for i := 20000; i < 21000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, batch.Put(key, value))
+	}
+	assert.NoError(t, batch.Commit())
+	assert.Greater(t, db.dataFiles.ActiveSegmentID(), uint32(4))
+	require.NoError(t, db.Close())
+
+	for _, workers := range []int{0, 1, 4, 16} {
+		options.IndexLoadWorkers = workers
+		var loaded, total int
+		options.IndexLoadProgress = func(l, t int) {
+			loaded, total = l, t
+		}
+		db, err = Open(options)
+		require.NoError(t, err)
+		assert.Equal(t, len(kvs), db.Stat().KeysNum)
+		assert.Equal(t, int(db.dataFiles.ActiveSegmentID()), total)
+		assert.Equal(t, total, loaded)
+		for key, value := range kvs {
+			v, err := db.Get([]byte(key))
+			assert.NoError(t, err)
+			assert.Equal(t, value, v)
+		}
+		require.NoError(t, db.Close())
+	}
+	db, err = Open(options)
+	require.NoError(t, err)
+}
@@ -0,0 +1,167 @@
+package rosedb
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/rosedblabs/wal"
+)
+
+// DumpOptions specifies the records to be dumped by DumpWAL.
+type DumpOptions struct {
+	// Key only dumps the records of the key, nil means all the keys.
+	Key []byte
+
+	// BatchId only dumps the records of the batch, 0 means all the batches.
+	BatchId uint64
+
+	// WithValue dumps the values of the records.
+	WithValue bool
+}
+
+// DumpRecord is a log record in the WAL, and where it is.
+type DumpRecord struct {
+	SegmentId   wal.SegmentID
+	BlockNumber uint32
+	ChunkOffset int64
+	ChunkSize   uint32
+
+	Type    LogRecordType
+	BatchId uint64
+	Expire  int64
+	Key     []byte
+	Value   []byte // nil if DumpOptions.WithValue is false
+
+	// CommitTime is the commit time of the batch in nanoseconds,
+	// only set for the batch finished record, and 0 if it is written by the old versions.
+	CommitTime int64
+
+	// Incomplete is true if the batch of the record has no batch finished record,
+	// the record is not visible, because the batch was not committed successfully.
+	Incomplete bool
+}
+
+// DumpWAL calls handleFn for each record in the WAL in the order they are written,
+// it stops if handleFn returns false or an error.
+//
+// The records of a batch are passed to handleFn after the batch finished record is read,
+// so it can tell whether the batch is incomplete.
+// The batch finished records are also dumped, but not if DumpOptions.Key is set.
+//
+// It is used to inspect the history of the keys.
+// Only the records written before DumpWAL is called are dumped, and the writes are not blocked,
+// but a merge which replaces the data files during the dump stops it with an error.
+func (db *DB) DumpWAL(options DumpOptions, handleFn func(record *DumpRecord) (bool, error)) error {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrDBClosed
+	}
+	end, err := db.walEndPosition()
+	if err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	reader := db.dataFiles.NewReaderWithMax(end.SegmentId)
+	db.mu.RUnlock()
+
+	// the records of a batch are always written together,
+	// so a batch is incomplete if a record of another batch follows it.
+	var pendingBatchId uint64
+	var pendingRecords []*DumpRecord
+	flushPending := func(incomplete bool) (bool, error) {
+		defer func() {
+			pendingBatchId, pendingRecords = 0, nil
+		}()
+		for _, record := range pendingRecords {
+			record.Incomplete = incomplete
+			if next, err := handleFn(record); !next || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	for {
+		chunk, position, err := reader.Next()
+		if err == nil && position.SegmentId == end.SegmentId && (position.BlockNumber > end.BlockNumber ||
+			position.BlockNumber == end.BlockNumber && position.ChunkOffset >= end.ChunkOffset) {
+			// the chunks written after DumpWAL is called.
+			err = io.EOF
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// dump the records before the corrupted one.
+			_, _ = flushPending(true)
+			return err
+		}
+		record := decodeLogRecord(chunk)
+
+		batchId := record.BatchId
+		if record.Type == LogRecordBatchFinished {
+			id, err := snowflake.ParseBytes(record.Key)
+			if err != nil {
+				return err
+			}
+			batchId = uint64(id)
+		}
+		if pendingBatchId != 0 && batchId != pendingBatchId {
+			if next, err := flushPending(true); !next || err != nil {
+				return err
+			}
+		}
+
+		dumpRecord := &DumpRecord{
+			SegmentId:   position.SegmentId,
+			BlockNumber: position.BlockNumber,
+			ChunkOffset: position.ChunkOffset,
+			ChunkSize:   position.ChunkSize,
+			Type:        record.Type,
+			BatchId:     batchId,
+			Expire:      record.Expire,
+			Key:         record.Key,
+		}
+		if options.BatchId != 0 && batchId != options.BatchId {
+			continue
+		}
+
+		switch {
+		case record.Type == LogRecordBatchFinished:
+			if next, err := flushPending(false); !next || err != nil {
+				return err
+			}
+			if options.Key != nil {
+				continue
+			}
+			dumpRecord.CommitTime = decodeCommitTime(record)
+			if next, err := handleFn(dumpRecord); !next || err != nil {
+				return err
+			}
+		case options.Key != nil && !bytes.Equal(options.Key, record.Key):
+			// track the batch even if the record is filtered,
+			// so the records of the other batches can be checked.
+			pendingBatchId = batchId
+		case batchId == mergeFinishedBatchID:
+			// the merged records have no batch finished record.
+			if options.WithValue {
+				dumpRecord.Value = record.Value
+			}
+			if next, err := handleFn(dumpRecord); !next || err != nil {
+				return err
+			}
+		default:
+			if options.WithValue {
+				dumpRecord.Value = record.Value
+			}
+			pendingBatchId = batchId
+			pendingRecords = append(pendingRecords, dumpRecord)
+		}
+	}
+
+	// the batch at the tail of the WAL is not finished.
+	_, err = flushPending(true)
+	return err
+}
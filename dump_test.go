@@ -0,0 +1,109 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/bytebufferpool"
+)
+
+func TestDB_DumpWAL(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	assert.NoError(t, batch.Put([]byte("key-1"), []byte("value-1")))
+	assert.NoError(t, batch.Put([]byte("key-2"), []byte("value-2")))
+	require.NoError(t, batch.Commit())
+	// the batch id is generated from the time in milliseconds by each batch,
+	// make sure the two batches have different ids.
+	time.Sleep(time.Millisecond * 2)
+	assert.NoError(t, db.Delete([]byte("key-1")))
+
+	// a batch without the batch finished record.
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	_, err = db.dataFiles.Write(encodeLogRecord(&LogRecord{
+		Key:     []byte("key-1"),
+		Value:   []byte("garbage"),
+		Type:    LogRecordNormal,
+		BatchId: 1,
+	}, db.encodeHeader, buf))
+	require.NoError(t, err)
+
+	var records []*DumpRecord
+	err = db.DumpWAL(DumpOptions{WithValue: true}, func(record *DumpRecord) (bool, error) {
+		records = append(records, record)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 6, len(records))
+
+	assert.Equal(t, []byte("key-1"), records[0].Key)
+	assert.Equal(t, []byte("value-1"), records[0].Value)
+	assert.Equal(t, LogRecordNormal, records[0].Type)
+	assert.Equal(t, []byte("key-2"), records[1].Key)
+	assert.Equal(t, LogRecordBatchFinished, records[2].Type)
+	assert.Equal(t, records[0].BatchId, records[2].BatchId)
+	assert.True(t, records[2].CommitTime > 0)
+	assert.Equal(t, LogRecordDeleted, records[3].Type)
+	assert.Equal(t, LogRecordBatchFinished, records[4].Type)
+	assert.Equal(t, []byte("garbage"), records[5].Value)
+	for i := 0; i < 5; i++ {
+		assert.False(t, records[i].Incomplete)
+	}
+	assert.True(t, records[5].Incomplete)
+	assert.True(t, records[1].ChunkOffset > records[0].ChunkOffset)
+
+	// filter by key.
+	records = records[:0]
+	err = db.DumpWAL(DumpOptions{Key: []byte("key-1")}, func(record *DumpRecord) (bool, error) {
+		records = append(records, record)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	assert.Nil(t, records[0].Value)
+	assert.Equal(t, LogRecordDeleted, records[1].Type)
+	assert.True(t, records[2].Incomplete)
+
+	// filter by batch.
+	batchId := records[0].BatchId
+	records = records[:0]
+	err = db.DumpWAL(DumpOptions{BatchId: batchId}, func(record *DumpRecord) (bool, error) {
+		records = append(records, record)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	assert.Equal(t, LogRecordBatchFinished, records[2].Type)
+
+	// stop by handleFn.
+	var count int
+	err = db.DumpWAL(DumpOptions{}, func(record *DumpRecord) (bool, error) {
+		count++
+		return false, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// handleFn can write to the database, and the records written during the dump are not dumped.
+	count = 0
+	err = db.DumpWAL(DumpOptions{}, func(record *DumpRecord) (bool, error) {
+		count++
+		return true, db.Put([]byte("during-dump"), []byte("value"))
+	})
+	assert.NoError(t, err)
+	total := count
+	count = 0
+	err = db.DumpWAL(DumpOptions{Key: []byte("during-dump")}, func(record *DumpRecord) (bool, error) {
+		count++
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, total, count)
+}
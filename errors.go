@@ -12,4 +12,24 @@ var (
 	ErrDBClosed        = errors.New("the database is closed")
 	ErrMergeRunning    = errors.New("the merge operation is running")
 	ErrWatchDisabled   = errors.New("the watch is disabled")
+	ErrDirNotEmpty     = errors.New("the directory is not empty")
+	ErrInvalidBackup   = errors.New("the backup archive is invalid")
+
+	ErrBackupParentMismatch = errors.New("the parent of the incremental backup is not restored")
+	ErrDBReadOnly           = errors.New("the database is opened in read only mode")
+	ErrRecoveryBeforeMerge  = errors.New("the recovery target is before the last merge")
+
+	ErrRecoveryTargetNotFound = errors.New("the recovery target batch is not found")
+	ErrReseedRequired         = errors.New("the WAL position is unavailable, the replica must be re-seeded")
+	ErrChangesReclaimed       = errors.New("the changes after the cursor have been reclaimed by merge")
+	ErrSubscriptionOverflow   = errors.New("the buffer of the subscription is overflow")
+	ErrWrongType              = errors.New("the key holds a value of another data type")
+	ErrNotInteger             = errors.New("the value is not an integer")
+	ErrScoreIsNaN             = errors.New("the score is NaN")
+	ErrQueueEmpty             = errors.New("the queue has no visible item")
+	ErrLeaseExpired           = errors.New("the lease of the queue item has expired")
+	ErrStreamGroupExists      = errors.New("the consumer group of the stream already exists")
+	ErrStreamGroupNotFound    = errors.New("the consumer group of the stream is not found")
+	ErrIndexExists            = errors.New("the secondary index already exists")
+	ErrIndexNotFound          = errors.New("the secondary index is not found")
 )
@@ -0,0 +1,428 @@
+// Package gateway provides an HTTP/JSON gateway of rosedb, which can be embedded into an HTTP server.
+//
+// The routes are:
+//
+//	GET    /keys/{key}            get the value of the key
+//	PUT    /keys/{key}[?ttl=10s]  set the value of the key
+//	DELETE /keys/{key}            delete the key
+//	GET    /ttl/{key}             get the remaining ttl of the key
+//	PUT    /ttl/{key}?ttl=10s     set the ttl of the key
+//	DELETE /ttl/{key}             remove the ttl of the key
+//	GET    /scan                  scan the keys in ascending order, see Handler.scan
+//	POST   /batch                 apply the operations atomically in a batch
+//	GET    /stat                  get the statistics of the database
+//	GET    /watch[?prefix=]       stream the watch events as Server-Sent Events
+//
+// The keys in the path are URL escaped, so they can contain any bytes.
+// The values are sent as raw bytes if the content type (or Accept header) is application/octet-stream,
+// otherwise they are sent in JSON, and encoded in base64 like all the []byte fields in JSON.
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+const (
+	contentTypeJSON  = "application/json"
+	contentTypeBytes = "application/octet-stream"
+
+	// defaultScanLimit is the default number of the items returned by a scan request.
+	defaultScanLimit = 100
+	// maxScanLimit is the max number of the items returned by a scan request.
+	maxScanLimit = 10000
+	// maxBodySize is the max size of a request body.
+	maxBodySize = 64 << 20
+)
+
+// Handler is an http.Handler which serves the requests on top of a database.
+type Handler struct {
+	db  *rosedb.DB
+	mux *http.ServeMux
+}
+
+// NewHandler creates a gateway handler on top of the database.
+// The handler can be mounted under a path prefix with http.StripPrefix.
+func NewHandler(db *rosedb.DB) *Handler {
+	h := &Handler{
+		db:  db,
+		mux: http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/keys/", h.handleKey)
+	h.mux.HandleFunc("/ttl/", h.handleTTL)
+	h.mux.HandleFunc("/scan", h.scan)
+	h.mux.HandleFunc("/batch", h.batch)
+	h.mux.HandleFunc("/stat", h.stat)
+	h.mux.HandleFunc("/watch", h.watch)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// KeyValue is a key/value pair in the JSON requests and responses.
+type KeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// TTLResponse is the response of GET /ttl/{key}, the TTL is -1 if the key has no ttl.
+type TTLResponse struct {
+	TTL int64 `json:"ttl_ms"`
+}
+
+// ScanResponse is the response of GET /scan.
+// If Next is not empty, there are more items, and it is the cursor of the next page.
+type ScanResponse struct {
+	Items []KeyValue `json:"items"`
+	Next  []byte     `json:"next,omitempty"`
+}
+
+// BatchOperation is an operation in the batch request, Op is "put" or "delete".
+type BatchOperation struct {
+	Op    string `json:"op"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+// BatchRequest is the request of POST /batch.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// StatResponse is the response of GET /stat.
+type StatResponse struct {
+	KeysNum  int   `json:"keys_num"`
+	DiskSize int64 `json:"disk_size"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+// writeDBError writes the error returned by the database.
+func writeDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rosedb.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, rosedb.ErrKeyIsEmpty):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, rosedb.ErrDBReadOnly):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, rosedb.ErrDBClosed):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// pathKey returns the unescaped key after the prefix in the path.
+func pathKey(r *http.Request, prefix string) ([]byte, error) {
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, rosedb.ErrKeyIsEmpty
+	}
+	return []byte(key), nil
+}
+
+// parseTTL parses the ttl parameter, it returns 0 if the parameter is empty.
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, errors.New("the ttl must be positive")
+	}
+	return ttl, nil
+}
+
+func isMediaType(header, mediaType string) bool {
+	for _, part := range strings.Split(header, ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) handleKey(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r, "/keys/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodDelete:
+		if err = h.db.Delete(key); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, key []byte) {
+	value, err := h.db.Get(key)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if isMediaType(r.Header.Get("Accept"), contentTypeBytes) {
+		w.Header().Set("Content-Type", contentTypeBytes)
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		_, _ = w.Write(value)
+		return
+	}
+	writeJSON(w, http.StatusOK, &KeyValue{Key: key, Value: value})
+}
+
+// put sets the value of the key, the body is the raw value,
+// or a KeyValue in JSON if the content type is application/json.
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, key []byte) {
+	ttl, err := parseTTL(r.URL.Query().Get("ttl"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	value := body
+	if isMediaType(r.Header.Get("Content-Type"), contentTypeJSON) {
+		var kv KeyValue
+		if err = json.Unmarshal(body, &kv); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		value = kv.Value
+	}
+
+	if ttl > 0 {
+		err = h.db.PutWithTTL(key, value, ttl)
+	} else {
+		err = h.db.Put(key, value)
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleTTL(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r, "/ttl/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		ttl, err := h.db.TTL(key)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		resp := &TTLResponse{TTL: -1}
+		if ttl >= 0 {
+			resp.TTL = ttl.Milliseconds()
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPut:
+		ttl, err := parseTTL(r.URL.Query().Get("ttl"))
+		if err == nil && ttl == 0 {
+			err = errors.New("the ttl is required")
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err = h.db.Expire(key, ttl); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err = h.db.Persist(key); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// scan returns the key/value pairs in ascending order, the parameters are:
+//
+//	prefix: only the keys with the prefix
+//	start:  only the keys greater than or equal to start
+//	end:    only the keys less than end
+//	cursor: the Next of the previous page, only the keys greater than it
+//	limit:  the max number of the items, 100 by default
+//	keys_only: do not return the values if it is true
+//
+// The cursor is the Next in the response, which is base64 encoded (standard encoding),
+// so it should be URL escaped in the query.
+func (h *Handler) scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	query := r.URL.Query()
+	prefix := []byte(query.Get("prefix"))
+	start := []byte(query.Get("start"))
+	end := []byte(query.Get("end"))
+	keysOnly, _ := strconv.ParseBool(query.Get("keys_only"))
+
+	limit := defaultScanLimit
+	if s := query.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > maxScanLimit {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+	}
+	var cursor []byte
+	if s := query.Get("cursor"); s != "" {
+		var err error
+		if cursor, err = base64.StdEncoding.DecodeString(s); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid cursor"))
+			return
+		}
+	}
+
+	// the scan starts from the max of start, prefix and cursor.
+	for _, key := range [][]byte{prefix, cursor} {
+		if string(key) > string(start) {
+			start = key
+		}
+	}
+
+	resp := &ScanResponse{Items: make([]KeyValue, 0)}
+	handleFn := func(k, v []byte) (bool, error) {
+		if len(prefix) > 0 && !strings.HasPrefix(string(k), string(prefix)) {
+			return false, nil
+		}
+		if cursor != nil && string(k) == string(cursor) {
+			return true, nil
+		}
+		if len(resp.Items) == limit {
+			resp.Next = resp.Items[limit-1].Key
+			return false, nil
+		}
+		item := KeyValue{Key: append([]byte(nil), k...)}
+		if !keysOnly {
+			item.Value = append([]byte(nil), v...)
+		}
+		resp.Items = append(resp.Items, item)
+		return true, nil
+	}
+	if len(end) > 0 {
+		h.db.AscendRange(start, end, handleFn)
+	} else {
+		h.db.AscendGreaterOrEqual(start, handleFn)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// batch applies all the operations in a batch, they are committed atomically.
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// check the operations before the batch is created, so the database will not be locked for bad requests.
+	ttls := make([]time.Duration, len(req.Operations))
+	for i, op := range req.Operations {
+		if op.Op != "put" && op.Op != "delete" {
+			writeError(w, http.StatusBadRequest, errors.New("unknown operation "+strconv.Quote(op.Op)))
+			return
+		}
+		ttl, err := parseTTL(op.TTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ttls[i] = ttl
+	}
+
+	batch := h.db.NewBatch(rosedb.BatchOptions{Sync: false})
+	for i, op := range req.Operations {
+		var err error
+		switch {
+		case op.Op == "delete":
+			err = batch.Delete(op.Key)
+		case ttls[i] > 0:
+			err = batch.PutWithTTL(op.Key, op.Value, ttls[i])
+		default:
+			err = batch.Put(op.Key, op.Value)
+		}
+		if err != nil {
+			_ = batch.Rollback()
+			writeDBError(w, err)
+			return
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	stat := h.db.Stat()
+	writeJSON(w, http.StatusOK, &StatResponse{KeysNum: stat.KeysNum, DiskSize: stat.DiskSize})
+}
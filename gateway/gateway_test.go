@@ -0,0 +1,245 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGateway(t *testing.T) (*rosedb.DB, *httptest.Server) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(NewHandler(db))
+	t.Cleanup(func() {
+		ts.Close()
+		_ = db.Close()
+	})
+	return db, ts
+}
+
+func doRequest(t *testing.T, method, url string, header http.Header, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestHandler_Key(t *testing.T) {
+	_, ts := newTestGateway(t)
+	keyURL := ts.URL + "/keys/" + url.PathEscape("user/1")
+
+	// raw bytes.
+	resp, _ := doRequest(t, http.MethodPut, keyURL, nil, []byte{0, 1, 2})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body := doRequest(t, http.MethodGet, keyURL, http.Header{"Accept": {"application/octet-stream"}}, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte{0, 1, 2}, body)
+
+	// base64 in JSON.
+	resp, _ = doRequest(t, http.MethodPut, keyURL, http.Header{"Content-Type": {"application/json"}}, []byte(`{"value":"aGVsbG8="}`))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body = doRequest(t, http.MethodGet, keyURL, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var kv KeyValue
+	require.NoError(t, json.Unmarshal(body, &kv))
+	assert.Equal(t, []byte("user/1"), kv.Key)
+	assert.Equal(t, []byte("hello"), kv.Value)
+
+	resp, _ = doRequest(t, http.MethodDelete, keyURL, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, keyURL, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPost, keyURL, nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodPut, keyURL+"?ttl=bad", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandler_TTL(t *testing.T) {
+	_, ts := newTestGateway(t)
+
+	resp, _ := doRequest(t, http.MethodPut, ts.URL+"/keys/k?ttl=1h", nil, []byte("v"))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body := doRequest(t, http.MethodGet, ts.URL+"/ttl/k", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var ttl TTLResponse
+	require.NoError(t, json.Unmarshal(body, &ttl))
+	assert.True(t, ttl.TTL > 3500*1000 && ttl.TTL <= 3600*1000)
+
+	resp, _ = doRequest(t, http.MethodDelete, ts.URL+"/ttl/k", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, body = doRequest(t, http.MethodGet, ts.URL+"/ttl/k", nil, nil)
+	require.NoError(t, json.Unmarshal(body, &ttl))
+	assert.Equal(t, int64(-1), ttl.TTL)
+
+	resp, _ = doRequest(t, http.MethodPut, ts.URL+"/ttl/k?ttl=50ms", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	time.Sleep(100 * time.Millisecond)
+	resp, _ = doRequest(t, http.MethodGet, ts.URL+"/keys/k", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPut, ts.URL+"/ttl/missing?ttl=1h", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHandler_Scan(t *testing.T) {
+	db, ts := newTestGateway(t)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("user:%02d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	require.NoError(t, db.Put([]byte("other"), []byte("v")))
+
+	// prefix scan with pagination.
+	var keys []string
+	query := url.Values{"prefix": {"user:"}, "limit": {"10"}}
+	for {
+		resp, body := doRequest(t, http.MethodGet, ts.URL+"/scan?"+query.Encode(), nil, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var scan ScanResponse
+		require.NoError(t, json.Unmarshal(body, &scan))
+		for _, item := range scan.Items {
+			keys = append(keys, string(item.Key))
+			assert.NotEmpty(t, item.Value)
+		}
+		if len(scan.Next) == 0 {
+			break
+		}
+		next, _ := json.Marshal(scan.Next)
+		query.Set("cursor", strings.Trim(string(next), `"`))
+	}
+	assert.Equal(t, 25, len(keys))
+	assert.Equal(t, "user:00", keys[0])
+	assert.Equal(t, "user:24", keys[24])
+
+	// range scan.
+	query = url.Values{"start": {"user:10"}, "end": {"user:12"}, "keys_only": {"true"}}
+	_, body := doRequest(t, http.MethodGet, ts.URL+"/scan?"+query.Encode(), nil, nil)
+	var scan ScanResponse
+	require.NoError(t, json.Unmarshal(body, &scan))
+	require.Equal(t, 2, len(scan.Items))
+	assert.Equal(t, []byte("user:10"), scan.Items[0].Key)
+	assert.Nil(t, scan.Items[0].Value)
+	assert.Equal(t, []byte("user:11"), scan.Items[1].Key)
+
+	resp, _ := doRequest(t, http.MethodGet, ts.URL+"/scan?limit=0", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandler_Batch(t *testing.T) {
+	db, ts := newTestGateway(t)
+	require.NoError(t, db.Put([]byte("c"), []byte("v")))
+
+	req, _ := json.Marshal(&BatchRequest{Operations: []BatchOperation{
+		{Op: "put", Key: []byte("a"), Value: []byte("1")},
+		{Op: "put", Key: []byte("b"), Value: []byte("2"), TTL: "1h"},
+		{Op: "delete", Key: []byte("c")},
+	}})
+	resp, _ := doRequest(t, http.MethodPost, ts.URL+"/batch", nil, req)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	value, err := db.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	ttl, err := db.TTL([]byte("b"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0)
+	_, err = db.Get([]byte("c"))
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+
+	// an invalid operation rejects the whole batch.
+	req, _ = json.Marshal(&BatchRequest{Operations: []BatchOperation{
+		{Op: "put", Key: []byte("d"), Value: []byte("1")},
+		{Op: "incr", Key: []byte("a")},
+	}})
+	resp, _ = doRequest(t, http.MethodPost, ts.URL+"/batch", nil, req)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, err = db.Get([]byte("d"))
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+
+	resp, body := doRequest(t, http.MethodGet, ts.URL+"/stat", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stat StatResponse
+	require.NoError(t, json.Unmarshal(body, &stat))
+	assert.Equal(t, 2, stat.KeysNum)
+	assert.True(t, stat.DiskSize > 0)
+}
+
+func TestHandler_Watch(t *testing.T) {
+	db, ts := newTestGateway(t)
+
+	resp, err := http.Get(ts.URL + "/watch?prefix=user:")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.NoError(t, db.Put([]byte("other"), []byte("v")))
+	require.NoError(t, db.Put([]byte("user:1"), []byte("alice")))
+	require.NoError(t, db.Delete([]byte("user:1")))
+
+	readEvent := func(reader *bufio.Reader) (string, *WatchEvent) {
+		var eventType string
+		event := &WatchEvent{}
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return eventType, event
+			case strings.HasPrefix(line, "event: "):
+				eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event))
+			}
+		}
+	}
+	reader := bufio.NewReader(resp.Body)
+	eventType, event := readEvent(reader)
+	assert.Equal(t, "put", eventType)
+	assert.Equal(t, []byte("user:1"), event.Key)
+	assert.Equal(t, []byte("alice"), event.Value)
+	assert.NotZero(t, event.BatchId)
+	eventType, event = readEvent(reader)
+	assert.Equal(t, "delete", eventType)
+	assert.Equal(t, []byte("user:1"), event.Key)
+
+	// each stream has its own subscription, so the streams never split the events.
+	resp2, err := http.Get(ts.URL + "/watch")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp2.Body.Close()
+	}()
+	require.NoError(t, db.Put([]byte("user:2"), []byte("bob")))
+	_, event = readEvent(reader)
+	assert.Equal(t, []byte("user:2"), event.Key)
+	_, event = readEvent(bufio.NewReader(resp2.Body))
+	assert.Equal(t, []byte("user:2"), event.Key)
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+const (
+	// subscriberQueueSize is the max number of the events waiting to be sent to a subscriber,
+	// the oldest events will be dropped if the client is too slow to receive them.
+	subscriberQueueSize = 1024
+	// keepAliveInterval is the interval of the comments sent to keep the event stream alive.
+	keepAliveInterval = 30 * time.Second
+)
+
+// WatchEvent is the data of an event in the /watch stream,
+// the event type is "put" or "delete".
+type WatchEvent struct {
+	Key     []byte `json:"key"`
+	Value   []byte `json:"value,omitempty"`
+	BatchId uint64 `json:"batch_id"`
+}
+
+// watch streams the watch events as Server-Sent Events,
+// only the events of the keys with the prefix are sent if the prefix parameter is specified.
+// Each request has its own DB.Subscribe, so the watch of the database is not required, and is left to the application.
+func (h *Handler) watch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	var prefix []byte
+	if p := r.URL.Query().Get("prefix"); p != "" {
+		prefix = []byte(p)
+	}
+	sub, err := h.db.Subscribe(rosedb.SubscribeOptions{
+		Prefix:     prefix,
+		Actions:    []rosedb.WatchActionType{rosedb.WatchActionPut, rosedb.WatchActionDelete},
+		BufferSize: subscriberQueueSize,
+	})
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	defer func() {
+		_ = sub.Close()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			eventType := "put"
+			if event.Action == rosedb.WatchActionDelete {
+				eventType = "delete"
+			}
+			data, _ := json.Marshal(&WatchEvent{Key: event.Key, Value: event.Value, BatchId: event.BatchId})
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
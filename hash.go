@@ -0,0 +1,195 @@
+package rosedb
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// FieldValue is a field and its value in a hash.
+type FieldValue struct {
+	Field []byte
+	Value []byte
+}
+
+// HSet sets the fields of the hash, and returns the number of the fields added.
+// The fields written to an expirable hash expire along with it.
+func (b *Batch) HSet(key []byte, fieldValues ...FieldValue) (int, error) {
+	meta, err := b.getMeta(key, DataTypeHash)
+	if err != nil {
+		return 0, err
+	}
+	var added int
+	for _, fv := range fieldValues {
+		if len(fv.Field) == 0 {
+			return 0, ErrKeyIsEmpty
+		}
+		_, err = b.getMember(key, fv.Field)
+		if err == ErrKeyNotFound {
+			added++
+			meta.count++
+		} else if err != nil {
+			return 0, err
+		}
+		if err = b.putMember(key, fv.Field, fv.Value); err != nil {
+			return 0, err
+		}
+	}
+	return added, b.putMeta(key, meta)
+}
+
+// HGet returns the value of the field of the hash, ErrKeyNotFound is returned if the field does not exist.
+func (b *Batch) HGet(key, field []byte) ([]byte, error) {
+	if _, err := b.getMeta(key, DataTypeHash); err != nil {
+		return nil, err
+	}
+	return b.getMember(key, field)
+}
+
+// HDel deletes the fields of the hash, and returns the number of the fields deleted.
+func (b *Batch) HDel(key []byte, fields ...[]byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeHash)
+	if err != nil || meta.count == 0 {
+		return 0, err
+	}
+	var deleted int
+	for _, field := range fields {
+		_, err = b.getMember(key, field)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = b.deleteMember(key, field); err != nil {
+			return 0, err
+		}
+		deleted++
+		meta.count--
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, b.putMeta(key, meta)
+}
+
+// HLen returns the number of the fields of the hash.
+func (b *Batch) HLen(key []byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeHash)
+	if err != nil {
+		return 0, err
+	}
+	return int(meta.count), nil
+}
+
+// HGetAll returns all the fields of the hash in the order of the fields.
+func (b *Batch) HGetAll(key []byte) ([]FieldValue, error) {
+	fieldValues, _, err := b.HScan(key, nil, 0)
+	return fieldValues, err
+}
+
+// HScan returns at most count fields of the hash in the order of the fields, starting from the field cursor,
+// and the cursor of the next scan, which is nil if all the fields are returned.
+// A nil cursor starts from the first field, and 0 count means no limit.
+func (b *Batch) HScan(key, cursor []byte, count int) ([]FieldValue, []byte, error) {
+	if _, err := b.getMeta(key, DataTypeHash); err != nil {
+		return nil, nil, err
+	}
+	var fieldValues []FieldValue
+	var next []byte
+	err := b.scanMembers(key, cursor, false, func(field, value []byte) (bool, error) {
+		if count > 0 && len(fieldValues) == count {
+			next = bytes.Clone(field)
+			return false, nil
+		}
+		fieldValues = append(fieldValues, FieldValue{Field: bytes.Clone(field), Value: bytes.Clone(value)})
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fieldValues, next, nil
+}
+
+// HIncrBy increments the integer value of the field of the hash by delta, and returns the new value.
+// The field is set to delta if it does not exist, and ErrNotInteger is returned if its value is not an integer.
+func (b *Batch) HIncrBy(key, field []byte, delta int64) (int64, error) {
+	value, err := b.HGet(key, field)
+	if err != nil && err != ErrKeyNotFound {
+		return 0, err
+	}
+	var n int64
+	if err == nil {
+		if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	n += delta
+	if _, err = b.HSet(key, FieldValue{Field: field, Value: []byte(strconv.FormatInt(n, 10))}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// HSet sets the fields of the hash atomically, and returns the number of the fields added.
+func (db *DB) HSet(key []byte, fieldValues ...FieldValue) (added int, err error) {
+	err = db.update(func(batch *Batch) error {
+		added, err = batch.HSet(key, fieldValues...)
+		return err
+	})
+	return
+}
+
+// HGet returns the value of the field of the hash, ErrKeyNotFound is returned if the field does not exist.
+func (db *DB) HGet(key, field []byte) (value []byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		value, err = batch.HGet(key, field)
+		return err
+	})
+	return
+}
+
+// HDel deletes the fields of the hash atomically, and returns the number of the fields deleted.
+func (db *DB) HDel(key []byte, fields ...[]byte) (deleted int, err error) {
+	err = db.update(func(batch *Batch) error {
+		deleted, err = batch.HDel(key, fields...)
+		return err
+	})
+	return
+}
+
+// HLen returns the number of the fields of the hash.
+func (db *DB) HLen(key []byte) (n int, err error) {
+	err = db.view(func(batch *Batch) error {
+		n, err = batch.HLen(key)
+		return err
+	})
+	return
+}
+
+// HGetAll returns all the fields of the hash in the order of the fields.
+func (db *DB) HGetAll(key []byte) (fieldValues []FieldValue, err error) {
+	err = db.view(func(batch *Batch) error {
+		fieldValues, err = batch.HGetAll(key)
+		return err
+	})
+	return
+}
+
+// HScan returns at most count fields of the hash in the order of the fields, starting from the field cursor,
+// and the cursor of the next scan, which is nil if all the fields are returned.
+func (db *DB) HScan(key, cursor []byte, count int) (fieldValues []FieldValue, next []byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		fieldValues, next, err = batch.HScan(key, cursor, count)
+		return err
+	})
+	return
+}
+
+// HIncrBy increments the integer value of the field of the hash by delta, and returns the new value.
+func (db *DB) HIncrBy(key, field []byte, delta int64) (n int64, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.HIncrBy(key, field, delta)
+		return err
+	})
+	return
+}
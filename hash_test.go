@@ -0,0 +1,190 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_Hash(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("user:1")
+	added, err := db.HSet(key,
+		FieldValue{Field: []byte("name"), Value: []byte("rose")},
+		FieldValue{Field: []byte("age"), Value: []byte("18")},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = db.HSet(key, FieldValue{Field: []byte("name"), Value: []byte("lily")})
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+
+	value, err := db.HGet(key, []byte("name"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("lily"), value)
+	_, err = db.HGet(key, []byte("email"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	n, err := db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	age, err := db.HIncrBy(key, []byte("age"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), age)
+	_, err = db.HIncrBy(key, []byte("name"), 1)
+	assert.Equal(t, ErrNotInteger, err)
+	age, err = db.HIncrBy(key, []byte("visits"), -1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), age)
+
+	fieldValues, err := db.HGetAll(key)
+	require.NoError(t, err)
+	require.Len(t, fieldValues, 3)
+	assert.Equal(t, []byte("age"), fieldValues[0].Field)
+	assert.Equal(t, []byte("20"), fieldValues[0].Value)
+	assert.Equal(t, []byte("visits"), fieldValues[2].Field)
+
+	deleted, err := db.HDel(key, []byte("visits"), []byte("email"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	n, err = db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the other data types and the plain keys are not mixed up with the hash.
+	require.NoError(t, db.Put([]byte("name"), []byte("plain")))
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	dataType, err := db.DataType(key)
+	require.NoError(t, err)
+	assert.Equal(t, DataTypeHash, dataType)
+	_, err = db.HSet([]byte("user:10"), FieldValue{Field: []byte("name"), Value: []byte("v")})
+	require.NoError(t, err)
+	n, err = db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the fields are deleted with the hash.
+	ok, err := db.DeleteData(key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	n, err = db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.HGet(key, []byte("name"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.DataType(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_HScan(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("hash")
+	for i := 0; i < 100; i++ {
+		_, err = db.HSet(key, FieldValue{Field: []byte(fmt.Sprintf("field-%03d", i)), Value: []byte("v")})
+		require.NoError(t, err)
+	}
+
+	var cursor []byte
+	var count int
+	for {
+		fieldValues, next, err := db.HScan(key, cursor, 30)
+		require.NoError(t, err)
+		for _, fv := range fieldValues {
+			assert.Equal(t, []byte(fmt.Sprintf("field-%03d", count)), fv.Field)
+			count++
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 100, count)
+
+	// the fields written in the batch are scanned with the committed ones.
+	batch := db.NewBatch(DefaultBatchOptions)
+	_, err = batch.HSet(key, FieldValue{Field: []byte("field-050a"), Value: []byte("new")})
+	require.NoError(t, err)
+	_, err = batch.HDel(key, []byte("field-000"))
+	require.NoError(t, err)
+	fieldValues, err := batch.HGetAll(key)
+	require.NoError(t, err)
+	require.Len(t, fieldValues, 100)
+	assert.Equal(t, []byte("field-001"), fieldValues[0].Field)
+	assert.Equal(t, []byte("field-050a"), fieldValues[50].Field)
+	require.NoError(t, batch.Rollback())
+	n, err := db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+}
+
+func TestDB_ExpireData(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("hash")
+	_, err = db.HSet(key, FieldValue{Field: []byte("a"), Value: []byte("1")})
+	require.NoError(t, err)
+	ttl, err := db.DataTTL(key)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	require.NoError(t, db.ExpireData(key, time.Millisecond*100))
+	// the fields added later expire with the hash.
+	_, err = db.HSet(key, FieldValue{Field: []byte("b"), Value: []byte("2")})
+	require.NoError(t, err)
+	ttl, err = db.DataTTL(key)
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Millisecond*100)
+
+	time.Sleep(time.Millisecond * 150)
+	n, err := db.HLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.HGet(key, []byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyNotFound, db.ExpireData(key, time.Second))
+
+	// a new hash of the same key has none of the expired fields.
+	_, err = db.HSet(key, FieldValue{Field: []byte("c"), Value: []byte("3")})
+	require.NoError(t, err)
+	require.NoError(t, db.ExpireData(key, time.Hour))
+	require.NoError(t, db.PersistData(key))
+	ttl, err = db.DataTTL(key)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	// the fields of an expired hash which is not written again are reclaimed by merge.
+	other := []byte("other")
+	_, err = db.HSet(other, FieldValue{Field: []byte("a"), Value: []byte("1")})
+	require.NoError(t, err)
+	require.NoError(t, db.ExpireData(other, time.Millisecond*50))
+	time.Sleep(time.Millisecond * 100)
+	assert.NotNil(t, db.index.Get(encodeMemberKey(other, []byte("a"))))
+
+	// the hash survives the restart and the merge.
+	require.NoError(t, db.Merge(true))
+	assert.Nil(t, db.index.Get(encodeMemberKey(other, []byte("a"))))
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	fieldValues, err := db.HGetAll(key)
+	require.NoError(t, err)
+	require.Len(t, fieldValues, 1)
+	assert.Equal(t, []byte("c"), fieldValues[0].Field)
+}
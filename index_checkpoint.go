@@ -0,0 +1,223 @@
+package rosedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rosedblabs/rosedb/v2/index"
+	"github.com/rosedblabs/wal"
+)
+
+const (
+	indexCheckpointFileName = "INDEX.CHECKPOINT"
+	indexCheckpointTempName = "INDEX.CHECKPOINT.tmp"
+)
+
+var errInvalidIndexCheckpoint = errors.New("invalid index checkpoint")
+
+// writeIndexCheckpoint writes the whole index to the index checkpoint file,
+// together with the WAL position it covers.
+//
+// The active segment will be rotated first (if it is not empty),
+// so the checkpoint covers all the segments before the new active segment,
+// and only the segments after it need to be replayed on the next startup.
+//
+// The index is written from a snapshot, so the writes will not be blocked
+// while the checkpoint file is being written.
+func (db *DB) writeIndexCheckpoint() error {
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrDBClosed
+	}
+	// seal the active segment, it will also sync the data to disk,
+	// so all the data covered by the checkpoint is durable.
+	if err := db.sealActiveSegment(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	replaySegId := db.dataFiles.ActiveSegmentID()
+	mergeFinSegId, err := getMergeFinSegmentId(db.options.DirPath)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	indexIter := db.index.Iterator(false)
+	db.mu.Unlock()
+	defer indexIter.Close()
+
+	tempPath := filepath.Join(db.options.DirPath, indexCheckpointTempName)
+	if err = writeIndexCheckpointFile(tempPath, mergeFinSegId, replaySegId, indexIter); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	// rename is atomic, so there is always a complete checkpoint file, or none.
+	return os.Rename(tempPath, filepath.Join(db.options.DirPath, indexCheckpointFileName))
+}
+
+// +------------------+---------------+-------------------------------------+-----------+
+// | merge fin seg id | replay seg id |  entries(key size, key, position)  |   crc32   |
+// +------------------+---------------+-------------------------------------+-----------+
+//
+//	uvarint           uvarint                                             4 bytes
+func writeIndexCheckpointFile(path string, mergeFinSegId, replaySegId wal.SegmentID,
+	indexIter index.IndexIterator) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := crc32.NewIEEE()
+	writer := bufio.NewWriter(io.MultiWriter(file, hash))
+	varint := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) error {
+		n := binary.PutUvarint(varint, v)
+		_, err := writer.Write(varint[:n])
+		return err
+	}
+
+	if err = putUvarint(uint64(mergeFinSegId)); err != nil {
+		return err
+	}
+	if err = putUvarint(uint64(replaySegId)); err != nil {
+		return err
+	}
+	for ; indexIter.Valid(); indexIter.Next() {
+		key := indexIter.Key()
+		if err = putUvarint(uint64(len(key))); err != nil {
+			return err
+		}
+		if _, err = writer.Write(key); err != nil {
+			return err
+		}
+		if _, err = writer.Write(encodeHintRecord(nil, indexIter.Value())); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	// the checksum of all the data above, used to detect a torn checkpoint.
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, hash.Sum32())
+	if _, err = file.Write(checksum); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// loadIndexFromCheckpoint loads the index from the index checkpoint file.
+// It returns the id of the segment from which the WAL should be replayed,
+// and whether the checkpoint is loaded.
+//
+// If the checkpoint does not exist, is torn, or is stale because of a merge,
+// it will not be loaded, and the index should be rebuilt from the hint file and the whole WAL.
+func (db *DB) loadIndexFromCheckpoint() (wal.SegmentID, bool, error) {
+	buf, err := os.ReadFile(filepath.Join(db.options.DirPath, indexCheckpointFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if len(buf) < 4 {
+		return 0, false, nil
+	}
+	data, checksum := buf[:len(buf)-4], binary.LittleEndian.Uint32(buf[len(buf)-4:])
+	if crc32.ChecksumIEEE(data) != checksum {
+		return 0, false, nil
+	}
+
+	mergeFinSegId, err := getMergeFinSegmentId(db.options.DirPath)
+	if err != nil {
+		return 0, false, err
+	}
+	checkpoint, err := decodeIndexCheckpoint(data)
+	if err != nil {
+		return 0, false, nil
+	}
+	// the segments have been rewritten by a merge after the checkpoint,
+	// so the positions in the checkpoint are no longer valid.
+	if checkpoint.mergeFinSegId != mergeFinSegId {
+		return 0, false, nil
+	}
+	if checkpoint.replaySegId > db.dataFiles.ActiveSegmentID() {
+		return 0, false, nil
+	}
+
+	for i := range checkpoint.keys {
+		db.index.Put(checkpoint.keys[i], checkpoint.positions[i])
+	}
+	return checkpoint.replaySegId, true, nil
+}
+
+type indexCheckpoint struct {
+	mergeFinSegId wal.SegmentID
+	replaySegId   wal.SegmentID
+	keys          [][]byte
+	positions     []*wal.ChunkPosition
+}
+
+func decodeIndexCheckpoint(data []byte) (*indexCheckpoint, error) {
+	idx := 0
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data[idx:])
+		if n <= 0 {
+			return 0, errInvalidIndexCheckpoint
+		}
+		idx += n
+		return v, nil
+	}
+
+	mergeFinSegId, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	replaySegId, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &indexCheckpoint{
+		mergeFinSegId: wal.SegmentID(mergeFinSegId),
+		replaySegId:   wal.SegmentID(replaySegId),
+	}
+	for idx < len(data) {
+		keySize, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if keySize > uint64(len(data)-idx) {
+			return nil, errInvalidIndexCheckpoint
+		}
+		key := data[idx : idx+int(keySize)]
+		idx += int(keySize)
+
+		var fields [4]uint64
+		for j := range fields {
+			if fields[j], err = readUvarint(); err != nil {
+				return nil, err
+			}
+		}
+		checkpoint.keys = append(checkpoint.keys, key)
+		checkpoint.positions = append(checkpoint.positions, &wal.ChunkPosition{
+			SegmentId:   wal.SegmentID(fields[0]),
+			BlockNumber: uint32(fields[1]),
+			ChunkOffset: int64(fields[2]),
+			ChunkSize:   uint32(fields[3]),
+		})
+	}
+	return checkpoint, nil
+}
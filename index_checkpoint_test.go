@@ -0,0 +1,180 @@
+package rosedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_IndexCheckpoint_Close(t *testing.T) {
+	options := DefaultOptions
+	options.IndexCheckpoint = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+	require.NoError(t, db.Close())
+	_, err = os.Stat(filepath.Join(options.DirPath, indexCheckpointFileName))
+	assert.NoError(t, err)
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, len(kvs), db.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	_, loaded, err := db.loadIndexFromCheckpoint()
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+
+	// reopen without any writes, no new segment file should be created.
+	activeSegId := db.dataFiles.ActiveSegmentID()
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, activeSegId, db.dataFiles.ActiveSegmentID())
+	assert.Equal(t, len(kvs), db.Stat().KeysNum)
+}
+
+func TestDB_IndexCheckpoint_ReplayTail(t *testing.T) {
+	options := DefaultOptions
+	options.IndexCheckpoint = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.writeIndexCheckpoint())
+
+	// the writes after the checkpoint must be replayed from the WAL.
+	for i := 5000; i < 15000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+	// simulate a crash, close without writing a new checkpoint.
+	db.options.IndexCheckpoint = false
+	require.NoError(t, db.Close())
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, len(kvs), db.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+}
+
+func TestDB_IndexCheckpoint_Torn(t *testing.T) {
+	options := DefaultOptions
+	options.IndexCheckpoint = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.Close())
+
+	// truncate the checkpoint file, the checksum will not match.
+	path := filepath.Join(options.DirPath, indexCheckpointFileName)
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, stat.Size()/2))
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, len(kvs), db.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	_, loaded, err := db.loadIndexFromCheckpoint()
+	assert.NoError(t, err)
+	assert.False(t, loaded)
+}
+
+func TestDB_IndexCheckpoint_StaleAfterMerge(t *testing.T) {
+	options := DefaultOptions
+	options.IndexCheckpoint = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.writeIndexCheckpoint())
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+		delete(kvs, string(utils.GetTestKey(i)))
+	}
+	// the merge rewrites the segments, so the checkpoint becomes stale.
+	require.NoError(t, db.Merge(false))
+	db.options.IndexCheckpoint = false
+	require.NoError(t, db.Close())
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	assert.Equal(t, len(kvs), db.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+}
+
+func TestDB_IndexCheckpoint_Cron(t *testing.T) {
+	options := DefaultOptions
+	options.IndexCheckpoint = true
+	options.IndexCheckpointCronExpr = "*/1 * * * * * *"
+	_, err := Open(options)
+	assert.Error(t, err)
+
+	options.IndexCheckpointCronExpr = "@hourly"
+	db, err := Open(options)
+	assert.NoError(t, err)
+	destroyDB(db)
+}
@@ -24,6 +24,7 @@ type Iterator struct {
 	options     IteratorOptions     // user-defined configuration options
 	lastError   error               // stores the last error encountered during iteration
 	currentItem *Item               // cached current item to avoid side effects in Item()
+	readAhead   *readAhead          // reads the chunks ahead for the forward iteration
 }
 
 // NewIterator initializes and returns a new database iterator with the specified options.
@@ -35,6 +36,9 @@ func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
 		indexIter: indexIter,
 		options:   opts,
 	}
+	if !opts.Reverse {
+		iterator.readAhead = newReadAhead(db)
+	}
 	iterator.skipToNext()
 	return iterator
 }
@@ -90,6 +94,9 @@ func (it *Iterator) Close() {
 	}
 
 	it.indexIter.Close()
+	if it.readAhead != nil {
+		_ = it.readAhead.close()
+	}
 	it.indexIter = nil
 	it.db = nil
 }
@@ -125,7 +132,13 @@ func (it *Iterator) skipToNext() {
 		}
 
 		// read the record from data file
-		chunk, err := it.db.dataFiles.Read(position)
+		var chunk []byte
+		var err error
+		if it.readAhead != nil {
+			chunk, err = it.readAhead.read(position)
+		} else {
+			chunk, err = it.db.dataFiles.Read(position)
+		}
 		if err != nil {
 			it.lastError = err
 			if !it.options.ContinueOnError {
@@ -0,0 +1,292 @@
+package rosedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+)
+
+// listInitialSeq is the sequence of the first element of a new list,
+// the elements pushed to the left take the smaller sequences, and to the right the greater ones.
+const listInitialSeq = 1 << 63
+
+func encodeListSeq(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// listRange converts the start and stop index which may be negative to the sequences in [head, tail).
+func listRange(meta *dataMeta, start, stop int64) (uint64, uint64) {
+	from, to := indexRange(meta.count, start, stop)
+	return meta.head + from, meta.head + to
+}
+
+func (b *Batch) push(key []byte, left bool, values [][]byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil {
+		return 0, err
+	}
+	if meta.count == 0 {
+		meta.head, meta.tail = listInitialSeq, listInitialSeq
+	}
+	for _, value := range values {
+		var seq uint64
+		if left {
+			meta.head--
+			seq = meta.head
+		} else {
+			seq = meta.tail
+			meta.tail++
+		}
+		if err = b.putMember(key, encodeListSeq(seq), value); err != nil {
+			return 0, err
+		}
+		meta.count++
+	}
+	return int(meta.count), b.putMeta(key, meta)
+}
+
+func (b *Batch) pop(key []byte, left bool) ([]byte, error) {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil {
+		return nil, err
+	}
+	if meta.count == 0 {
+		return nil, ErrKeyNotFound
+	}
+	seq := meta.tail - 1
+	if left {
+		seq = meta.head
+	}
+	value, err := b.getMember(key, encodeListSeq(seq))
+	if err != nil {
+		return nil, err
+	}
+	if err = b.deleteMember(key, encodeListSeq(seq)); err != nil {
+		return nil, err
+	}
+	if left {
+		meta.head++
+	} else {
+		meta.tail--
+	}
+	meta.count--
+	return value, b.putMeta(key, meta)
+}
+
+// LPush inserts the values at the head of the list one by one, and returns the length of the list.
+func (b *Batch) LPush(key []byte, values ...[]byte) (int, error) {
+	return b.push(key, true, values)
+}
+
+// RPush appends the values at the tail of the list, and returns the length of the list.
+func (b *Batch) RPush(key []byte, values ...[]byte) (int, error) {
+	return b.push(key, false, values)
+}
+
+// LPop removes and returns the first element of the list, ErrKeyNotFound is returned if the list is empty.
+func (b *Batch) LPop(key []byte) ([]byte, error) {
+	return b.pop(key, true)
+}
+
+// RPop removes and returns the last element of the list, ErrKeyNotFound is returned if the list is empty.
+func (b *Batch) RPop(key []byte) ([]byte, error) {
+	return b.pop(key, false)
+}
+
+// LLen returns the length of the list.
+func (b *Batch) LLen(key []byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil {
+		return 0, err
+	}
+	return int(meta.count), nil
+}
+
+// LIndex returns the element at the index of the list, a negative index counts from the tail,
+// ErrKeyNotFound is returned if the index is out of range.
+func (b *Batch) LIndex(key []byte, index int64) ([]byte, error) {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil {
+		return nil, err
+	}
+	start, end := listRange(meta, index, index)
+	if start == end {
+		return nil, ErrKeyNotFound
+	}
+	return b.getMember(key, encodeListSeq(start))
+}
+
+// LRange returns the elements of the list from start to stop, both inclusive,
+// the negative indexes count from the tail, and -1 is the last element.
+func (b *Batch) LRange(key []byte, start, stop int64) ([][]byte, error) {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil {
+		return nil, err
+	}
+	from, to := listRange(meta, start, stop)
+	if from == to {
+		return nil, nil
+	}
+	values := make([][]byte, 0, to-from)
+	end := encodeListSeq(to)
+	err = b.scanMembers(key, encodeListSeq(from), false, func(member, value []byte) (bool, error) {
+		if bytes.Compare(member, end) >= 0 {
+			return false, nil
+		}
+		values = append(values, bytes.Clone(value))
+		return true, nil
+	})
+	return values, err
+}
+
+// LTrim trims the list to only contain the elements from start to stop, both inclusive.
+func (b *Batch) LTrim(key []byte, start, stop int64) error {
+	meta, err := b.getMeta(key, DataTypeList)
+	if err != nil || meta.count == 0 {
+		return err
+	}
+	from, to := listRange(meta, start, stop)
+	if from == to {
+		_, err = b.deleteData(key)
+		return err
+	}
+	for seq := meta.head; seq < from; seq++ {
+		if err = b.deleteMember(key, encodeListSeq(seq)); err != nil {
+			return err
+		}
+	}
+	for seq := to; seq < meta.tail; seq++ {
+		if err = b.deleteMember(key, encodeListSeq(seq)); err != nil {
+			return err
+		}
+	}
+	meta.head, meta.tail, meta.count = from, to, to-from
+	return b.putMeta(key, meta)
+}
+
+// LPush inserts the values at the head of the list one by one, and returns the length of the list.
+func (db *DB) LPush(key []byte, values ...[]byte) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.LPush(key, values...)
+		return err
+	})
+	return
+}
+
+// RPush appends the values at the tail of the list, and returns the length of the list.
+func (db *DB) RPush(key []byte, values ...[]byte) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.RPush(key, values...)
+		return err
+	})
+	return
+}
+
+// LPop removes and returns the first element of the list, ErrKeyNotFound is returned if the list is empty.
+func (db *DB) LPop(key []byte) (value []byte, err error) {
+	err = db.update(func(batch *Batch) error {
+		value, err = batch.LPop(key)
+		return err
+	})
+	return
+}
+
+// RPop removes and returns the last element of the list, ErrKeyNotFound is returned if the list is empty.
+func (db *DB) RPop(key []byte) (value []byte, err error) {
+	err = db.update(func(batch *Batch) error {
+		value, err = batch.RPop(key)
+		return err
+	})
+	return
+}
+
+// LLen returns the length of the list.
+func (db *DB) LLen(key []byte) (n int, err error) {
+	err = db.view(func(batch *Batch) error {
+		n, err = batch.LLen(key)
+		return err
+	})
+	return
+}
+
+// LIndex returns the element at the index of the list, a negative index counts from the tail.
+func (db *DB) LIndex(key []byte, index int64) (value []byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		value, err = batch.LIndex(key, index)
+		return err
+	})
+	return
+}
+
+// LRange returns the elements of the list from start to stop, both inclusive.
+func (db *DB) LRange(key []byte, start, stop int64) (values [][]byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		values, err = batch.LRange(key, start, stop)
+		return err
+	})
+	return
+}
+
+// LTrim trims the list to only contain the elements from start to stop, both inclusive.
+func (db *DB) LTrim(key []byte, start, stop int64) error {
+	return db.update(func(batch *Batch) error {
+		return batch.LTrim(key, start, stop)
+	})
+}
+
+// BLPop removes and returns the first element of the list,
+// it blocks until an element is pushed if the list is empty, or ctx is done.
+func (db *DB) BLPop(ctx context.Context, key []byte) ([]byte, error) {
+	return db.blockingPop(ctx, key, db.LPop)
+}
+
+// BRPop removes and returns the last element of the list,
+// it blocks until an element is pushed if the list is empty, or ctx is done.
+func (db *DB) BRPop(ctx context.Context, key []byte) ([]byte, error) {
+	return db.blockingPop(ctx, key, db.RPop)
+}
+
+// blockingPop retries popFn whenever the key is written, until it succeeds or ctx is done.
+func (db *DB) blockingPop(ctx context.Context, key []byte, popFn func(key []byte) ([]byte, error)) ([]byte, error) {
+	return waitData(ctx, db, key, func() ([]byte, bool, error) {
+		value, err := popFn(key)
+		if err == ErrKeyNotFound {
+			return nil, false, nil
+		}
+		return value, err == nil, err
+	})
+}
+
+// waitData calls tryFn until it is done, and waits for a write of the data type key before each retry.
+// The subscription is created before the first try, so no write is missed between the tries.
+func waitData[T any](ctx context.Context, db *DB, key []byte, tryFn func() (T, bool, error)) (T, error) {
+	var zero T
+	metaKey := encodeMetaKey(key)
+	s, err := db.Subscribe(SubscribeOptions{
+		StartKey:   metaKey,
+		EndKey:     append(bytes.Clone(metaKey), 0),
+		Actions:    []WatchActionType{WatchActionPut},
+		BufferSize: 1,
+	})
+	if err != nil {
+		return zero, err
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+
+	for {
+		result, done, err := tryFn()
+		if err != nil || done {
+			return result, err
+		}
+		select {
+		case _, ok := <-s.Events():
+			if !ok {
+				return zero, s.Err()
+			}
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package rosedb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_List(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("jobs")
+	n, err := db.RPush(key, []byte("b"), []byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.LPush(key, []byte("a"), []byte("z"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	values, err := db.LRange(key, 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("z"), []byte("a"), []byte("b"), []byte("c")}, values)
+	values, err = db.LRange(key, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, values)
+	values, err = db.LRange(key, 3, 1)
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	value, err := db.LIndex(key, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), value)
+	value, err = db.LIndex(key, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("z"), value)
+	_, err = db.LIndex(key, 4)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.LIndex(key, -5)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	value, err = db.LPop(key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("z"), value)
+	value, err = db.RPop(key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), value)
+	n, err = db.LLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the list is deleted when its last element is popped.
+	_, err = db.LPop(key)
+	require.NoError(t, err)
+	_, err = db.LPop(key)
+	require.NoError(t, err)
+	_, err = db.LPop(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.DataType(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = db.HSet([]byte("user"), FieldValue{Field: []byte("name"), Value: []byte("rose")})
+	require.NoError(t, err)
+	_, err = db.RPush([]byte("user"), []byte("v"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestDB_LTrim(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("logs")
+	for i := 0; i < 10; i++ {
+		_, err = db.RPush(key, []byte{byte('0' + i)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.LTrim(key, 2, -3))
+	values, err := db.LRange(key, 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("2"), []byte("3"), []byte("4"), []byte("5"), []byte("6"), []byte("7")}, values)
+
+	// the trimmed elements are deleted, and the list survives a reopen.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	n, err := db.LLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	_, err = db.LPush(key, []byte("1"))
+	require.NoError(t, err)
+	value, err := db.LIndex(key, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	require.NoError(t, db.LTrim(key, 5, 1))
+	n, err = db.LLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDB_BLPop(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("queue")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = db.RPush(key, []byte("job-1"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	value, err := db.BLPop(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("job-1"), value)
+
+	// the element pushed before the call is returned at once.
+	_, err = db.RPush(key, []byte("job-2"), []byte("job-3"))
+	require.NoError(t, err)
+	value, err = db.BRPop(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("job-3"), value)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = db.BLPop(ctx, []byte("empty"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -30,6 +30,9 @@ const (
 // If reopenAfterDone is true, the original file will be replaced by the merge file,
 // and db's index will be rebuilt after the merge completes.
 func (db *DB) Merge(reopenAfterDone bool) error {
+	if db.readOnly {
+		return ErrDBReadOnly
+	}
 	if err := db.doMerge(); err != nil {
 		return err
 	}
@@ -87,6 +90,8 @@ func (db *DB) doMerge() error {
 	defer atomic.StoreUint32(&db.mergeRunning, 0)
 
 	prevActiveSegId := db.dataFiles.ActiveSegmentID()
+	// all the batches in the merged segments are committed before the merge time.
+	mergeTime := time.Now().UnixNano()
 	// rotate the write-ahead log, create a new active segment file.
 	// so all the older segment files will be merged.
 	if err := db.dataFiles.OpenNewActiveSegment(); err != nil {
@@ -94,6 +99,14 @@ func (db *DB) doMerge() error {
 		return err
 	}
 
+	// take a snapshot of the index if we rewrite the data in key order,
+	// the snapshot must be taken before unlocking, so it matches the rotated segments exactly.
+	var indexIter index.IndexIterator
+	if db.options.MergeInKeyOrder {
+		indexIter = db.index.Iterator(false)
+		defer indexIter.Close()
+	}
+
 	// we can unlock the mutex here, because the write-ahead log files has been rotated,
 	// and the new active segment file will be used for the subsequent writes.
 	// Our Merge operation will only read from the older segment files.
@@ -109,6 +122,39 @@ func (db *DB) doMerge() error {
 		_ = mergeDB.Close()
 	}()
 
+	// rewrite the valid data to the new data file.
+	if indexIter != nil {
+		err = db.mergeInKeyOrder(mergeDB, indexIter, prevActiveSegId)
+	} else {
+		err = db.mergeInWALOrder(mergeDB, prevActiveSegId)
+	}
+	if err != nil {
+		return err
+	}
+
+	// After rewrite all the data, we should add a file to indicate that the merge operation is completed.
+	// So when we restart the database, we can know that the merge is completed if the file exists,
+	// otherwise, we will delete the merge directory and redo the merge operation again.
+	mergeFinFile, err := mergeDB.openMergeFinishedFile()
+	if err != nil {
+		return err
+	}
+	_, err = mergeFinFile.Write(encodeMergeFinRecord(prevActiveSegId, mergeTime))
+	if err != nil {
+		return err
+	}
+	// close the merge finished file
+	if err := mergeFinFile.Close(); err != nil {
+		return err
+	}
+
+	// all done successfully, return nil
+	return nil
+}
+
+// mergeInWALOrder iterates all the data files which are older than the merge point,
+// and writes the valid data to the merge db in the order they appear in the WAL.
+func (db *DB) mergeInWALOrder(mergeDB *DB, prevActiveSegId wal.SegmentID) error {
 	buf := bytebufferpool.Get()
 	now := time.Now().UnixNano()
 	defer bytebufferpool.Put(buf)
@@ -132,44 +178,99 @@ func (db *DB) doMerge() error {
 			indexPos := db.index.Get(record.Key)
 			db.mu.RUnlock()
 			if indexPos != nil && positionEquals(indexPos, position) {
-				// clear the batch id of the record,
-				// all data after merge will be valid data, so the batch id should be 0.
-				record.BatchId = mergeFinishedBatchID
-				// Since the mergeDB will never be used for any read or write operations,
-				// it is not necessary to update the index.
-				newPosition, err := mergeDB.dataFiles.Write(encodeLogRecord(record, mergeDB.encodeHeader, buf))
+				orphan, err := db.isOrphanMember(record.Key, now)
 				if err != nil {
 					return err
 				}
-				// And now we should write the new position to the write-ahead log,
-				// which is so-called HINT FILE in bitcask paper.
-				// The HINT FILE will be used to rebuild the index quickly when the database is restarted.
-				_, err = mergeDB.hintFile.Write(encodeHintRecord(record.Key, newPosition))
-				if err != nil {
+				if orphan {
+					continue
+				}
+				// clear the batch id of the record,
+				// all data after merge will be valid data, so the batch id should be 0.
+				record.BatchId = mergeFinishedBatchID
+				if err = mergeDB.writeMergeRecord(record, buf); err != nil {
 					return err
 				}
 			}
 		}
 	}
+	return nil
+}
 
-	// After rewrite all the data, we should add a file to indicate that the merge operation is completed.
-	// So when we restart the database, we can know that the merge is completed if the file exists,
-	// otherwise, we will delete the merge directory and redo the merge operation again.
-	mergeFinFile, err := mergeDB.openMergeFinishedFile()
-	if err != nil {
-		return err
+// mergeInKeyOrder iterates the index snapshot taken at the merge point,
+// and writes the valid data to the merge db in key order.
+// So the records of adjacent keys are adjacent in the new data files,
+// and a range scan over the merged data becomes a mostly sequential read.
+func (db *DB) mergeInKeyOrder(mergeDB *DB, indexIter index.IndexIterator, prevActiveSegId wal.SegmentID) error {
+	buf := bytebufferpool.Get()
+	now := time.Now().UnixNano()
+	defer bytebufferpool.Put(buf)
+
+	for ; indexIter.Valid(); indexIter.Next() {
+		buf.Reset()
+		position := indexIter.Value()
+		// the position is in the new active segment files,
+		// it will be loaded from the WAL directly after merge.
+		if position.SegmentId > prevActiveSegId {
+			continue
+		}
+		chunk, err := db.dataFiles.Read(position)
+		if err != nil {
+			return err
+		}
+		record := decodeLogRecord(chunk)
+		if record.Type != LogRecordNormal || record.IsExpired(now) {
+			continue
+		}
+		orphan, err := db.isOrphanMember(record.Key, now)
+		if err != nil {
+			return err
+		}
+		if orphan {
+			continue
+		}
+		record.BatchId = mergeFinishedBatchID
+		if err = mergeDB.writeMergeRecord(record, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isOrphanMember returns whether the key is a member key of a data type whose meta record is deleted or expired,
+// such members are left by the expired values of the data types, and are not rewritten by merge.
+func (db *DB) isOrphanMember(key []byte, now int64) (bool, error) {
+	dataKey, ok := decodeMemberKey(key)
+	if !ok {
+		return false, nil
 	}
-	_, err = mergeFinFile.Write(encodeMergeFinRecord(prevActiveSegId))
+	db.mu.RLock()
+	position := db.index.Get(encodeMetaKey(dataKey))
+	db.mu.RUnlock()
+	if position == nil {
+		return true, nil
+	}
+	chunk, err := db.dataFiles.Read(position)
 	if err != nil {
-		return err
+		return false, err
 	}
-	// close the merge finished file
-	if err := mergeFinFile.Close(); err != nil {
+	return decodeLogRecord(chunk).IsExpired(now), nil
+}
+
+// writeMergeRecord writes the record to the data files of the merge db,
+// and writes the new position to the hint file.
+func (db *DB) writeMergeRecord(record *LogRecord, buf *bytebufferpool.ByteBuffer) error {
+	// Since the mergeDB will never be used for any read or write operations,
+	// it is not necessary to update the index.
+	newPosition, err := db.dataFiles.Write(encodeLogRecord(record, db.encodeHeader, buf))
+	if err != nil {
 		return err
 	}
-
-	// all done successfully, return nil
-	return nil
+	// And now we should write the new position to the write-ahead log,
+	// which is so-called HINT FILE in bitcask paper.
+	// The HINT FILE will be used to rebuild the index quickly when the database is restarted.
+	_, err = db.hintFile.Write(encodeHintRecord(record.Key, newPosition))
+	return err
 }
 
 func (db *DB) openMergeDB() (*DB, error) {
@@ -183,6 +284,9 @@ func (db *DB) openMergeDB() (*DB, error) {
 	// because we can sync the data file manually after the merge operation is completed.
 	options.Sync, options.BytesPerSync = false, 0
 	options.DirPath = mergePath
+	// the merge db does not need the index checkpoint,
+	// the hint file will be used to load the index of the merged data.
+	options.IndexCheckpoint, options.IndexCheckpointCronExpr = false, ""
 	mergeDB, err := Open(options)
 	if err != nil {
 		return nil, err
@@ -319,6 +423,39 @@ func getMergeFinSegmentId(mergePath string) (wal.SegmentID, error) {
 	return mergeFinSegmentId, nil
 }
 
+// getMergeFinTime returns the time of the merge operation recorded in the merge finished file.
+// It returns 0 if the merge finished file does not exist, or is written by the old versions.
+func getMergeFinTime(mergePath string) (int64, error) {
+	mergeFinFile, err := os.Open(wal.SegmentFileName(mergePath, mergeFinNameSuffix, 1))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer func() {
+		_ = mergeFinFile.Close()
+	}()
+
+	// the chunk header is checksum(4) | length(2) | type(1), and the merge time is after the segment id.
+	mergeFinBuf := make([]byte, walChunkHeaderSize+4+8)
+	n, err := mergeFinFile.ReadAt(mergeFinBuf, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if n < walChunkHeaderSize {
+		return 0, io.ErrUnexpectedEOF
+	}
+	// the merge finished file written by the old versions only has the 4 bytes segment id.
+	if binary.LittleEndian.Uint16(mergeFinBuf[4:6]) < 4+8 {
+		return 0, nil
+	}
+	if n < len(mergeFinBuf) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int64(binary.LittleEndian.Uint64(mergeFinBuf[walChunkHeaderSize+4:])), nil
+}
+
 func (db *DB) loadIndexFromHintFile() error {
 	hintFile, err := wal.Open(wal.Options{
 		DirPath: db.options.DirPath,
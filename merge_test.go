@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -303,3 +304,80 @@ func TestDB_Merge_Concurrent_Put(t *testing.T) {
 	})
 	assert.Equal(t, count, db.index.Size())
 }
+
+func TestDB_Merge_InKeyOrder(t *testing.T) {
+	options := DefaultOptions
+	options.MergeInKeyOrder = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for _, i := range rand.Perm(100000) {
+		key := utils.GetTestKey(i)
+		value := utils.RandomValue(128)
+		kvs[string(key)] = value
+		err := db.Put(key, value)
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 20000; i++ {
+		key := utils.GetTestKey(i)
+		err := db.Delete(key)
+		assert.NoError(t, err)
+		delete(kvs, string(key))
+	}
+
+	err = db.Merge(true)
+	assert.NoError(t, err)
+
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	assert.Equal(t, len(kvs), db.index.Size())
+
+	// the positions of the merged records must be in key order.
+	var prev *wal.ChunkPosition
+	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		if prev != nil {
+			assert.True(t, prev.SegmentId < pos.SegmentId ||
+				(prev.SegmentId == pos.SegmentId && prev.BlockNumber < pos.BlockNumber) ||
+				(prev.SegmentId == pos.SegmentId && prev.BlockNumber == pos.BlockNumber && prev.ChunkOffset < pos.ChunkOffset))
+		}
+		prev = pos
+		return true, nil
+	})
+}
+
+func TestGetMergeFinTime(t *testing.T) {
+	writeMergeFin := func(dirPath string, data []byte) {
+		mergeFinFile, err := wal.Open(wal.Options{
+			DirPath:        dirPath,
+			SegmentSize:    GB,
+			SegmentFileExt: mergeFinNameSuffix,
+		})
+		require.NoError(t, err)
+		_, err = mergeFinFile.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, mergeFinFile.Close())
+	}
+
+	// no merge finished file.
+	mergeTime, err := getMergeFinTime(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), mergeTime)
+
+	// the old versions only write the segment id.
+	dirPath := t.TempDir()
+	writeMergeFin(dirPath, []byte{3, 0, 0, 0})
+	mergeTime, err = getMergeFinTime(dirPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), mergeTime)
+
+	dirPath = t.TempDir()
+	writeMergeFin(dirPath, encodeMergeFinRecord(3, 12345))
+	mergeTime, err = getMergeFinTime(dirPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12345), mergeTime)
+}
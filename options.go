@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"time"
 )
@@ -43,6 +44,41 @@ type Options struct {
 	// do not set this shecule too frequently, it will affect the performance.
 	// refer to https://en.wikipedia.org/wiki/Cron
 	AutoMergeCronExpr string
+
+	// MergeInKeyOrder specifies whether the merge operation rewrites the valid data in key order.
+	// By default, the valid data is rewritten in the order it appears in the WAL,
+	// so the records of adjacent keys are scattered over the merged data files.
+	// If true, the merge will iterate the index instead, and the records of adjacent keys
+	// will be adjacent in the merged data files, so range scans and iterators
+	// over the merged data will become mostly sequential reads.
+	MergeInKeyOrder bool
+
+	// IndexCheckpoint specifies whether to enable the index checkpoint.
+	// If true, the whole index and the WAL position it covers will be written
+	// to a checkpoint file when the database is closed (and periodically if IndexCheckpointCronExpr is set),
+	// and the database will load the index from the checkpoint when opening,
+	// so only the WAL after the checkpoint needs to be replayed.
+	//
+	// If the checkpoint is torn or stale, it will be ignored, and the index will be rebuilt
+	// from the hint file and the whole WAL as usual.
+	IndexCheckpoint bool
+
+	// IndexCheckpointCronExpr the cron expression to write the index checkpoint periodically,
+	// it follows the same format as AutoMergeCronExpr, and only works when IndexCheckpoint is true.
+	// Every checkpoint will rotate the active segment file if it is not empty,
+	// so do not set this schedule too frequently.
+	IndexCheckpointCronExpr string
+
+	// IndexLoadWorkers specifies the number of goroutines to decode the segment files
+	// in parallel when loading the index from WAL at startup.
+	// The decoded records are always applied to the index in segment order.
+	// If it is less than or equal to 0, the segment files will be decoded one by one.
+	IndexLoadWorkers int
+
+	// IndexLoadProgress is called after each segment file is loaded into the index at startup,
+	// with the number of the loaded segment files and the total number of segment files to load.
+	// It is optional, and will be called on the goroutine which opens the database.
+	IndexLoadProgress func(loaded, total int)
 }
 
 // BatchOptions specifies the options for creating a batch.
@@ -83,6 +119,9 @@ var DefaultOptions = Options{
 	BytesPerSync:      0,
 	WatchQueueSize:    0,
 	AutoMergeCronExpr: "",
+	MergeInKeyOrder:   false,
+	IndexCheckpoint:   false,
+	IndexLoadWorkers:  runtime.NumCPU(),
 }
 
 var DefaultBatchOptions = BatchOptions{
@@ -0,0 +1,264 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// The queue keeps the visible items in the order of their ids,
+// and the items being processed in the order of their deadlines in another key range:
+//
+//	'f' | deadline | id -> uvarint(attempts) | payload
+//	'i' | id            -> uvarint(attempts) | payload
+//
+// An item is moved to the in-flight range when it is delivered, and it is delivered again
+// if it is not acknowledged before its deadline, so Dequeue only looks at the first item of each range.
+// The tail of the meta record is the id of the next item, and the count is the number of the items.
+const (
+	queueInFlightTag = 'f'
+	queueItemTag     = 'i'
+)
+
+// QueueOptions specifies how a queue handles the items which fail repeatedly.
+type QueueOptions struct {
+	// MaxAttempts is the max number of the deliveries of an item,
+	// an item which is delivered MaxAttempts times without being acknowledged is moved to the dead letter queue.
+	// 0 means no limit.
+	MaxAttempts int
+	// DeadLetter is the name of the dead letter queue, default is the name of the queue with the suffix ".dlq".
+	DeadLetter []byte
+}
+
+// QueueItem is an item delivered by Dequeue.
+type QueueItem struct {
+	ID      uint64
+	Payload []byte
+	// Attempts is the number of the deliveries of the item including this one.
+	Attempts int
+	// Deadline is the time when the item is delivered again unless it is acknowledged,
+	// it identifies the delivery together with Attempts when the item is acknowledged.
+	Deadline time.Time
+}
+
+// Queue is a durable FIFO queue stored under a key of the database,
+// the items are delivered at least once, and removed when they are acknowledged by Ack.
+type Queue struct {
+	db      *DB
+	name    []byte
+	options QueueOptions
+}
+
+// Queue returns the queue with the name, it is created by the first Enqueue.
+func (db *DB) Queue(name []byte, options QueueOptions) *Queue {
+	if options.DeadLetter == nil {
+		options.DeadLetter = append(bytes.Clone(name), ".dlq"...)
+	}
+	return &Queue{db: db, name: name, options: options}
+}
+
+func encodeQueueMember(id uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{queueItemTag}, id)
+}
+
+func encodeQueueInFlight(deadline time.Time, id uint64) []byte {
+	buf := binary.BigEndian.AppendUint64([]byte{queueInFlightTag}, uint64(deadline.UnixNano()))
+	return binary.BigEndian.AppendUint64(buf, id)
+}
+
+func encodeQueueValue(attempts int, payload []byte) []byte {
+	value := binary.AppendUvarint(nil, uint64(attempts))
+	return append(value, payload...)
+}
+
+func decodeQueueValue(id uint64, value []byte) *QueueItem {
+	attempts, n := binary.Uvarint(value)
+	return &QueueItem{ID: id, Payload: bytes.Clone(value[n:]), Attempts: int(attempts)}
+}
+
+// enqueue appends an item which has been delivered attempts times to the queue, and returns its id.
+func (b *Batch) enqueue(key, payload []byte, attempts int) (uint64, error) {
+	meta, err := b.getMeta(key, DataTypeQueue)
+	if err != nil {
+		return 0, err
+	}
+	id := meta.tail
+	meta.tail++
+	meta.count++
+	if err = b.putMember(key, encodeQueueMember(id), encodeQueueValue(attempts, payload)); err != nil {
+		return 0, err
+	}
+	return id, b.putMeta(key, meta)
+}
+
+// removeQueueItem removes the member of an item from the queue.
+func (b *Batch) removeQueueItem(key, member []byte) error {
+	meta, err := b.getMeta(key, DataTypeQueue)
+	if err != nil {
+		return err
+	}
+	if err = b.deleteMember(key, member); err != nil {
+		return err
+	}
+	meta.count--
+	// the meta record is kept even if the queue is empty, so the ids are never reused,
+	// and a stale delivery can not acknowledge a new item with the same id.
+	return b.putRecord(encodeMetaKey(key), meta.encode(), meta.expire)
+}
+
+// inFlightItem returns the member and the value of the delivery of the item in the in-flight range,
+// ErrLeaseExpired is returned if its deadline has passed, or it is not the latest delivery of the item.
+func (b *Batch) inFlightItem(key []byte, item *QueueItem) ([]byte, []byte, error) {
+	if !time.Now().Before(item.Deadline) {
+		return nil, nil, ErrLeaseExpired
+	}
+	member := encodeQueueInFlight(item.Deadline, item.ID)
+	value, err := b.getMember(key, member)
+	if err == ErrKeyNotFound {
+		return nil, nil, ErrLeaseExpired
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if attempts, _ := binary.Uvarint(value); int(attempts) != item.Attempts {
+		return nil, nil, ErrLeaseExpired
+	}
+	return member, value, nil
+}
+
+// Enqueue appends the payload to the queue, and returns the id of the item.
+func (q *Queue) Enqueue(payload []byte) (id uint64, err error) {
+	err = q.db.update(func(batch *Batch) error {
+		id, err = batch.enqueue(q.name, payload, 0)
+		return err
+	})
+	return
+}
+
+// Dequeue returns the first visible item of the queue, and hides it for visibilityTimeout,
+// the item is delivered again after the timeout unless it is acknowledged by Ack.
+// The items which have been delivered QueueOptions.MaxAttempts times are moved to the dead letter queue.
+// ErrQueueEmpty is returned if there is no visible item.
+func (q *Queue) Dequeue(visibilityTimeout time.Duration) (item *QueueItem, err error) {
+	err = q.db.update(func(batch *Batch) error {
+		item, err = q.dequeue(batch, visibilityTimeout)
+		return err
+	})
+	// the items moved to the dead letter queue are committed even if there is no visible item.
+	if err == nil && item == nil {
+		err = ErrQueueEmpty
+	}
+	return
+}
+
+// dequeue delivers the first visible item of the queue, nil is returned if there is no visible item.
+// The visible items are the first item in the order of the ids, and the in-flight items whose deadlines have passed,
+// the one with the smaller id is delivered first.
+func (q *Queue) dequeue(b *Batch, visibilityTimeout time.Duration) (*QueueItem, error) {
+	if _, err := b.getMeta(q.name, DataTypeQueue); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for {
+		var item *QueueItem
+		var member []byte
+		err := b.scanMembers(q.name, []byte{queueInFlightTag}, false, func(m, value []byte) (bool, error) {
+			if m[0] == queueInFlightTag && binary.BigEndian.Uint64(m[1:]) <= uint64(now.UnixNano()) {
+				item = decodeQueueValue(binary.BigEndian.Uint64(m[9:]), value)
+				member = bytes.Clone(m)
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = b.scanMembers(q.name, []byte{queueItemTag}, false, func(m, value []byte) (bool, error) {
+			if m[0] != queueItemTag {
+				return false, nil
+			}
+			if id := binary.BigEndian.Uint64(m[1:]); item == nil || id < item.ID {
+				item = decodeQueueValue(id, value)
+				member = bytes.Clone(m)
+			}
+			return false, nil
+		})
+		if err != nil || item == nil {
+			return nil, err
+		}
+		if q.options.MaxAttempts > 0 && item.Attempts >= q.options.MaxAttempts {
+			if err = q.moveToDeadLetter(b, member, item); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err = b.deleteMember(q.name, member); err != nil {
+			return nil, err
+		}
+		item.Attempts++
+		item.Deadline = now.Add(visibilityTimeout)
+		err = b.putMember(q.name, encodeQueueInFlight(item.Deadline, item.ID), encodeQueueValue(item.Attempts, item.Payload))
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+func (q *Queue) moveToDeadLetter(b *Batch, member []byte, item *QueueItem) error {
+	if err := b.removeQueueItem(q.name, member); err != nil {
+		return err
+	}
+	_, err := b.enqueue(q.options.DeadLetter, item.Payload, item.Attempts)
+	return err
+}
+
+// Ack acknowledges the item delivered by Dequeue, and removes it from the queue.
+// ErrLeaseExpired is returned if the visibility timeout of the delivery has passed,
+// the item may have been delivered again then, and it is not removed.
+func (q *Queue) Ack(item *QueueItem) error {
+	return q.db.update(func(batch *Batch) error {
+		member, _, err := batch.inFlightItem(q.name, item)
+		if err != nil {
+			return err
+		}
+		return batch.removeQueueItem(q.name, member)
+	})
+}
+
+// Nack releases the item delivered by Dequeue, so it is visible again at once in the order of its id,
+// or moved to the dead letter queue if it has been delivered QueueOptions.MaxAttempts times.
+// ErrLeaseExpired is returned if the visibility timeout of the delivery has passed.
+func (q *Queue) Nack(item *QueueItem) error {
+	return q.db.update(func(batch *Batch) error {
+		member, value, err := batch.inFlightItem(q.name, item)
+		if err != nil {
+			return err
+		}
+		if q.options.MaxAttempts > 0 && item.Attempts >= q.options.MaxAttempts {
+			return q.moveToDeadLetter(batch, member, decodeQueueValue(item.ID, value))
+		}
+		if err = batch.deleteMember(q.name, member); err != nil {
+			return err
+		}
+		return batch.putMember(q.name, encodeQueueMember(item.ID), value)
+	})
+}
+
+// Len returns the number of the items in the queue, including the items being processed.
+func (q *Queue) Len() (n int, err error) {
+	err = q.db.view(func(batch *Batch) error {
+		meta, err := batch.getMeta(q.name, DataTypeQueue)
+		if err != nil {
+			return err
+		}
+		n = int(meta.count)
+		return nil
+	})
+	return
+}
+
+// DeadLetter returns the dead letter queue of the queue.
+func (q *Queue) DeadLetter() *Queue {
+	return q.db.Queue(q.options.DeadLetter, QueueOptions{})
+}
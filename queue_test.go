@@ -0,0 +1,135 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	q := db.Queue([]byte("jobs"), QueueOptions{})
+	_, err = q.Dequeue(time.Minute)
+	assert.Equal(t, ErrQueueEmpty, err)
+	for _, payload := range []string{"a", "b", "c"} {
+		_, err = q.Enqueue([]byte(payload))
+		require.NoError(t, err)
+	}
+
+	// the items are delivered in order, and hidden while they are processed.
+	item1, err := q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), item1.Payload)
+	assert.Equal(t, 1, item1.Attempts)
+	assert.True(t, item1.Deadline.After(time.Now()))
+	item2, err := q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("b"), item2.Payload)
+
+	require.NoError(t, q.Ack(item1))
+	assert.Equal(t, ErrLeaseExpired, q.Ack(item1))
+	require.NoError(t, q.Nack(item2))
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the released item is delivered again before the later ones.
+	item, err := q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("b"), item.Payload)
+	assert.Equal(t, 2, item.Attempts)
+	assert.Equal(t, ErrLeaseExpired, q.Ack(item2))
+	require.NoError(t, q.Ack(item))
+
+	// the acknowledged items are not delivered again after a restart.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	q = db.Queue([]byte("jobs"), QueueOptions{})
+	item, err = q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c"), item.Payload)
+	require.NoError(t, q.Ack(item))
+	_, err = q.Dequeue(time.Minute)
+	assert.Equal(t, ErrQueueEmpty, err)
+
+	// the ids are not reused after the queue is drained.
+	id, err := q.Enqueue([]byte("d"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), id)
+
+	// an item whose delivery times out is delivered again before the items enqueued after it.
+	_, err = q.Dequeue(50 * time.Millisecond)
+	require.NoError(t, err)
+	_, err = q.Enqueue([]byte("e"))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	item, err = q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("d"), item.Payload)
+	assert.Equal(t, 2, item.Attempts)
+}
+
+func TestQueue_VisibilityTimeout(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	q := db.Queue([]byte("jobs"), QueueOptions{MaxAttempts: 2})
+	_, err = q.Enqueue([]byte("a"))
+	require.NoError(t, err)
+
+	item, err := q.Dequeue(50 * time.Millisecond)
+	require.NoError(t, err)
+	_, err = q.Dequeue(50 * time.Millisecond)
+	assert.Equal(t, ErrQueueEmpty, err)
+
+	// the item is visible again after the timeout, even after a restart.
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	q = db.Queue([]byte("jobs"), QueueOptions{MaxAttempts: 2})
+	assert.Equal(t, ErrLeaseExpired, q.Ack(item))
+	item, err = q.Dequeue(50 * time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 2, item.Attempts)
+
+	// the item is moved to the dead letter queue when its last delivery times out.
+	time.Sleep(100 * time.Millisecond)
+	_, err = q.Dequeue(time.Minute)
+	assert.Equal(t, ErrQueueEmpty, err)
+	n, err := q.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	dead, err := q.DeadLetter().Dequeue(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), dead.Payload)
+	assert.Equal(t, 3, dead.Attempts)
+
+	// a nack of the last delivery moves the item at once.
+	_, err = q.Enqueue([]byte("b"))
+	require.NoError(t, err)
+	item, err = q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Nack(item))
+	item, err = q.Dequeue(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Nack(item))
+	_, err = q.Dequeue(time.Minute)
+	assert.Equal(t, ErrQueueEmpty, err)
+	n, err = q.DeadLetter().Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -0,0 +1,854 @@
+// Package raft turns a rosedb database into a replicated state machine with the Raft consensus algorithm,
+// so a cluster of nodes (typically 3 or 5) can serve a strongly consistent key-value service.
+//
+// Node is a built-in Raft implementation with leader election, log replication and log compaction.
+// The committed entries are applied to a StateMachine in order, and DBStateMachine adapts a rosedb.DB to it:
+// each entry is a Command committed as a Batch, and the snapshots are the backup archives of the database.
+//
+// The messages between the nodes are sent by a Transport, and the Raft log is persisted by a Storage.
+// MemNetwork provides the in-memory transports for testing.
+package raft
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotLeader       = errors.New("raft: the node is not the leader")
+	ErrProposalDropped = errors.New("raft: the proposal is dropped because the leadership changed")
+	ErrStopped         = errors.New("raft: the node is stopped")
+	ErrInvalidConfig   = errors.New("raft: the node id must be one of the peers")
+	ErrLogInconsistent = errors.New("raft: the state machine does not match the log")
+)
+
+// maxEntriesPerMessage is the max number of entries sent in an append message.
+const maxEntriesPerMessage = 64
+
+// Role is the role of a node in the cluster.
+type Role uint8
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+// Entry is an entry of the Raft log.
+// The entry with nil Data is appended by a new leader, it only advances the applied index.
+type Entry struct {
+	Index uint64
+	Term  uint64
+	Data  []byte
+}
+
+// Config is the configuration of a node.
+type Config struct {
+	// ID is the id of the node, it must be one of the Peers.
+	ID string
+	// Peers are the ids of all the nodes in the cluster, including this node.
+	Peers []string
+	// TickInterval is the interval of the logical clock of the node, default is 100ms.
+	TickInterval time.Duration
+	// ElectionTicks is the number of ticks without hearing from the leader before a follower starts an election,
+	// the actual timeout is randomized in [ElectionTicks, 2*ElectionTicks). Default is 10.
+	ElectionTicks int
+	// HeartbeatTicks is the number of ticks between the heartbeats of the leader, default is 1.
+	HeartbeatTicks int
+	// SnapshotThreshold is the number of applied entries in the log which triggers a log compaction,
+	// 0 means the log is never compacted.
+	SnapshotThreshold uint64
+	// SnapshotDir is the directory of the snapshot files sent to the lagging followers,
+	// default is os.TempDir().
+	SnapshotDir string
+}
+
+// Status is the status of a node.
+type Status struct {
+	ID            string
+	Role          Role
+	Term          uint64
+	Leader        string
+	CommitIndex   uint64
+	AppliedIndex  uint64
+	SnapshotIndex uint64
+	LastIndex     uint64
+}
+
+// Node is a member of a Raft cluster.
+//
+// All the writes must be proposed to the leader by Propose,
+// and they are visible in the state machine of a node after applied.
+// An empty proposal can be used as a read barrier,
+// all the writes committed before it are applied when it returns.
+type Node struct {
+	config    Config
+	sm        StateMachine
+	storage   Storage
+	transport Transport
+	quorum    int
+	rand      *rand.Rand
+
+	// the fields below are only accessed by the run goroutine.
+	term             uint64
+	vote             string
+	role             Role
+	leader           string
+	entries          []Entry // the entries after the snapshot
+	snapshotIndex    uint64
+	snapshotTerm     uint64
+	commitIndex      uint64
+	appliedIndex     uint64
+	electionElapsed  int
+	electionTimeout  int
+	heartbeatElapsed int
+	votes            map[string]bool
+	nextIndex        map[string]uint64
+	matchIndex       map[string]uint64
+	active           map[string]bool // the peers which respond since the last check of the leader
+	proposals        map[uint64]*proposal
+	snapshot         *snapshotFile // the latest snapshot built for the lagging followers
+	snapshotting     bool          // a snapshot is being built by buildSnapshot
+
+	snapc    chan *snapshotFile
+	wg       sync.WaitGroup
+	recvc    chan *Message
+	propc    chan *proposal
+	statusc  chan chan Status
+	stopc    chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+type proposal struct {
+	data   []byte
+	term   uint64
+	result chan error
+}
+
+// snapshotFile is a snapshot of the state machine written to a temporary file,
+// it is sent to the followers until a newer one is built.
+type snapshotFile struct {
+	file  *os.File
+	size  int64
+	index uint64
+	term  uint64
+	err   error
+}
+
+// release closes and removes the file.
+func (s *snapshotFile) release() {
+	if s.file != nil {
+		_ = s.file.Close()
+		_ = os.Remove(s.file.Name())
+	}
+}
+
+// NewNode creates a node and starts it, the state of the node is loaded from the storage,
+// and the entries committed but not applied to the state machine will be applied again.
+func NewNode(config Config, sm StateMachine, storage Storage, transport Transport) (*Node, error) {
+	var found bool
+	for _, peer := range config.Peers {
+		found = found || peer == config.ID
+	}
+	if !found {
+		return nil, ErrInvalidConfig
+	}
+	if config.TickInterval <= 0 {
+		config.TickInterval = 100 * time.Millisecond
+	}
+	if config.ElectionTicks <= 0 {
+		config.ElectionTicks = 10
+	}
+	if config.HeartbeatTicks <= 0 {
+		config.HeartbeatTicks = 1
+	}
+
+	state, err := storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		config:        config,
+		sm:            sm,
+		storage:       storage,
+		transport:     transport,
+		quorum:        len(config.Peers)/2 + 1,
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		term:          state.Term,
+		vote:          state.Vote,
+		entries:       state.Entries,
+		snapshotIndex: state.SnapshotIndex,
+		snapshotTerm:  state.SnapshotTerm,
+		proposals:     make(map[uint64]*proposal),
+		snapc:         make(chan *snapshotFile),
+		recvc:         make(chan *Message, 4096),
+		propc:         make(chan *proposal),
+		statusc:       make(chan chan Status),
+		stopc:         make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	// the log entries before the snapshot are discarded,
+	// so the state machine must contain them, and it can't contain the entries not in the log.
+	n.appliedIndex = sm.AppliedIndex()
+	if n.appliedIndex < n.snapshotIndex || n.appliedIndex > n.lastIndex() {
+		return nil, ErrLogInconsistent
+	}
+	n.commitIndex = n.appliedIndex
+	if err = n.becomeFollower(n.term, ""); err != nil {
+		return nil, err
+	}
+
+	transport.Receive(n.Step)
+	go n.run()
+	return n, nil
+}
+
+// Propose proposes the data to be appended to the log, and waits until it is applied to the state machine,
+// the error returned by the state machine is returned.
+//
+// ErrNotLeader is returned if the node is not the leader, the proposal should be sent to the leader then.
+// If ErrProposalDropped or the error of ctx is returned, the proposal may or may not be committed.
+func (n *Node) Propose(ctx context.Context, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	p := &proposal{data: data, result: make(chan error, 1)}
+	select {
+	case n.propc <- p:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.done:
+		return ErrStopped
+	}
+	select {
+	case err := <-p.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.done:
+		return ErrStopped
+	}
+}
+
+// Step receives a message from the other nodes, it is called by the transport.
+// The message is dropped if the node is too busy, which is tolerated by Raft.
+func (n *Node) Step(msg *Message) {
+	select {
+	case n.recvc <- msg:
+	default:
+	}
+}
+
+// Status returns the status of the node.
+func (n *Node) Status() Status {
+	ch := make(chan Status, 1)
+	select {
+	case n.statusc <- ch:
+		return <-ch
+	case <-n.done:
+		return Status{ID: n.config.ID}
+	}
+}
+
+// Stop stops the node, and returns the error which stopped the node unexpectedly if any.
+// The state machine and the storage are not closed by the node.
+func (n *Node) Stop() error {
+	n.stopOnce.Do(func() {
+		close(n.stopc)
+	})
+	<-n.done
+	n.wg.Wait()
+	return n.err
+}
+
+func (n *Node) run() {
+	ticker := time.NewTicker(n.config.TickInterval)
+	defer ticker.Stop()
+	defer close(n.done)
+	defer func() {
+		if n.snapshot != nil {
+			n.snapshot.release()
+		}
+	}()
+
+	for {
+		var err error
+		select {
+		case <-n.stopc:
+			n.dropProposals(ErrStopped)
+			return
+		case <-ticker.C:
+			err = n.tick()
+		case msg := <-n.recvc:
+			err = n.step(msg)
+		case p := <-n.propc:
+			err = n.propose(p)
+		case snapshot := <-n.snapc:
+			n.snapshotBuilt(snapshot)
+		case ch := <-n.statusc:
+			ch <- Status{
+				ID:            n.config.ID,
+				Role:          n.role,
+				Term:          n.term,
+				Leader:        n.leader,
+				CommitIndex:   n.commitIndex,
+				AppliedIndex:  n.appliedIndex,
+				SnapshotIndex: n.snapshotIndex,
+				LastIndex:     n.lastIndex(),
+			}
+		}
+		// the node can't continue if the storage or the state machine fails.
+		if err != nil {
+			n.err = err
+			n.dropProposals(ErrStopped)
+			return
+		}
+	}
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.snapshotIndex + uint64(len(n.entries))
+}
+
+// termAt returns the term of the entry at index, false if the entry is not in the log.
+func (n *Node) termAt(index uint64) (uint64, bool) {
+	if index == n.snapshotIndex {
+		return n.snapshotTerm, true
+	}
+	if index < n.snapshotIndex || index > n.lastIndex() {
+		return 0, false
+	}
+	return n.entries[index-n.snapshotIndex-1].Term, true
+}
+
+func (n *Node) send(msg *Message) {
+	msg.From = n.config.ID
+	msg.Term = n.term
+	n.transport.Send(msg)
+}
+
+func (n *Node) resetElectionTimeout() {
+	n.electionElapsed = 0
+	n.electionTimeout = n.config.ElectionTicks + n.rand.Intn(n.config.ElectionTicks)
+}
+
+func (n *Node) setHardState(term uint64, vote string) error {
+	if term == n.term && vote == n.vote {
+		return nil
+	}
+	if err := n.storage.SaveHardState(term, vote); err != nil {
+		return err
+	}
+	n.term, n.vote = term, vote
+	return nil
+}
+
+func (n *Node) becomeFollower(term uint64, leader string) error {
+	if term > n.term {
+		if err := n.setHardState(term, ""); err != nil {
+			return err
+		}
+	}
+	if n.role == Leader {
+		n.dropProposals(ErrProposalDropped)
+	}
+	n.role = Follower
+	n.leader = leader
+	n.resetElectionTimeout()
+	return nil
+}
+
+func (n *Node) campaign() error {
+	if err := n.setHardState(n.term+1, n.config.ID); err != nil {
+		return err
+	}
+	n.role = Candidate
+	n.leader = ""
+	n.votes = map[string]bool{n.config.ID: true}
+	n.resetElectionTimeout()
+	if n.quorum == 1 {
+		return n.becomeLeader()
+	}
+
+	lastTerm, _ := n.termAt(n.lastIndex())
+	for _, peer := range n.config.Peers {
+		if peer != n.config.ID {
+			n.send(&Message{Type: MsgVote, To: peer, LogIndex: n.lastIndex(), LogTerm: lastTerm})
+		}
+	}
+	return nil
+}
+
+func (n *Node) becomeLeader() error {
+	n.role = Leader
+	n.leader = n.config.ID
+	n.heartbeatElapsed = 0
+	n.electionElapsed = 0
+	n.active = make(map[string]bool)
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	for _, peer := range n.config.Peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+	// the entries of the previous terms are committed along with an entry of the current term.
+	if err := n.appendEntry(nil); err != nil {
+		return err
+	}
+	n.broadcastAppend()
+	return nil
+}
+
+func (n *Node) dropProposals(err error) {
+	for index, p := range n.proposals {
+		p.result <- err
+		delete(n.proposals, index)
+	}
+}
+
+func (n *Node) tick() error {
+	if n.role != Leader {
+		n.electionElapsed++
+		if n.electionElapsed >= n.electionTimeout {
+			return n.campaign()
+		}
+		return nil
+	}
+
+	// the leader steps down if it can't reach the majority,
+	// so the proposals are not blocked on a partitioned leader.
+	n.electionElapsed++
+	if n.electionElapsed >= n.config.ElectionTicks {
+		n.electionElapsed = 0
+		active := 1
+		for peer := range n.active {
+			if peer != n.config.ID {
+				active++
+			}
+		}
+		n.active = make(map[string]bool)
+		if active < n.quorum {
+			return n.becomeFollower(n.term, "")
+		}
+	}
+	n.heartbeatElapsed++
+	if n.heartbeatElapsed >= n.config.HeartbeatTicks {
+		n.heartbeatElapsed = 0
+		n.broadcastAppend()
+	}
+	return nil
+}
+
+func (n *Node) propose(p *proposal) error {
+	if n.role != Leader {
+		p.result <- ErrNotLeader
+		return nil
+	}
+	// the proposal is registered first, the entry is applied by appendEntry in a single node cluster.
+	index := n.lastIndex() + 1
+	p.term = n.term
+	n.proposals[index] = p
+	if err := n.appendEntry(p.data); err != nil {
+		delete(n.proposals, index)
+		p.result <- err
+		return err
+	}
+	n.broadcastAppend()
+	return n.maybeCommit()
+}
+
+// appendEntry appends an entry of the current term to the log of the leader.
+func (n *Node) appendEntry(data []byte) error {
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.term, Data: data}
+	if err := n.storage.Append([]Entry{entry}); err != nil {
+		return err
+	}
+	n.entries = append(n.entries, entry)
+	n.matchIndex[n.config.ID] = entry.Index
+	if n.quorum == 1 {
+		return n.maybeCommit()
+	}
+	return nil
+}
+
+func (n *Node) broadcastAppend() {
+	for _, peer := range n.config.Peers {
+		if peer != n.config.ID {
+			n.sendAppend(peer)
+		}
+	}
+}
+
+// sendAppend sends the entries from the next index of the peer,
+// or a snapshot if the entries have been compacted.
+func (n *Node) sendAppend(to string) {
+	next := n.nextIndex[to]
+	if next <= n.snapshotIndex {
+		n.sendSnapshot(to)
+		return
+	}
+	prev := next - 1
+	prevTerm, _ := n.termAt(prev)
+	start := prev - n.snapshotIndex
+	end := uint64(len(n.entries))
+	if end-start > maxEntriesPerMessage {
+		end = start + maxEntriesPerMessage
+	}
+	entries := n.entries[start:end]
+	n.send(&Message{
+		Type:     MsgApp,
+		To:       to,
+		LogIndex: prev,
+		LogTerm:  prevTerm,
+		Entries:  entries,
+		Commit:   n.commitIndex,
+	})
+	// send the following entries without waiting for the response,
+	// the next index is reset if the peer rejects them.
+	if len(entries) > 0 {
+		n.nextIndex[to] = entries[len(entries)-1].Index + 1
+	}
+}
+
+// sendSnapshot sends a snapshot of the state machine which contains all the applied entries.
+// The snapshot is built by buildSnapshot off the run goroutine, and sent on the next heartbeat after it is built.
+func (n *Node) sendSnapshot(to string) {
+	// the snapshot is only useful if the entries after it are still in the log.
+	if n.snapshot == nil || n.snapshot.index < n.snapshotIndex {
+		if !n.snapshotting {
+			n.snapshotting = true
+			n.wg.Add(1)
+			go n.buildSnapshot()
+		}
+		return
+	}
+	n.send(&Message{
+		Type:     MsgSnap,
+		To:       to,
+		LogIndex: n.snapshot.index,
+		LogTerm:  n.snapshot.term,
+		Snapshot: io.NewSectionReader(n.snapshot.file, 0, n.snapshot.size),
+	})
+	n.nextIndex[to] = n.snapshot.index + 1
+}
+
+// buildSnapshot writes a snapshot of the state machine to a temporary file,
+// and passes it to the run goroutine.
+func (n *Node) buildSnapshot() {
+	defer n.wg.Done()
+	snapshot := &snapshotFile{}
+	if snapshot.file, snapshot.err = os.CreateTemp(n.config.SnapshotDir, "raft-snapshot-*"); snapshot.err == nil {
+		snapshot.index, snapshot.err = n.sm.Snapshot(snapshot.file)
+		if snapshot.err == nil {
+			snapshot.size, snapshot.err = snapshot.file.Seek(0, io.SeekCurrent)
+		}
+	}
+	select {
+	case n.snapc <- snapshot:
+	case <-n.done:
+		snapshot.release()
+	}
+}
+
+// snapshotBuilt replaces the snapshot sent to the followers with the one built by buildSnapshot.
+// The failed snapshot is dropped, and built again when a follower needs it.
+func (n *Node) snapshotBuilt(snapshot *snapshotFile) {
+	n.snapshotting = false
+	term, ok := n.termAt(snapshot.index)
+	if snapshot.err != nil || !ok {
+		snapshot.release()
+		return
+	}
+	snapshot.term = term
+	if n.snapshot != nil {
+		n.snapshot.release()
+	}
+	n.snapshot = snapshot
+}
+
+func (n *Node) step(msg *Message) error {
+	if msg.Term > n.term {
+		leader := ""
+		if msg.Type == MsgApp || msg.Type == MsgSnap {
+			leader = msg.From
+		}
+		if err := n.becomeFollower(msg.Term, leader); err != nil {
+			return err
+		}
+	} else if msg.Term < n.term {
+		// tell the stale leader or candidate about the new term.
+		switch msg.Type {
+		case MsgApp, MsgSnap:
+			n.send(&Message{Type: MsgAppResp, To: msg.From, Reject: true, Index: n.lastIndex()})
+		case MsgVote:
+			n.send(&Message{Type: MsgVoteResp, To: msg.From, Reject: true})
+		}
+		return nil
+	}
+
+	switch msg.Type {
+	case MsgVote:
+		return n.handleVote(msg)
+	case MsgVoteResp:
+		return n.handleVoteResp(msg)
+	case MsgApp, MsgSnap:
+		if n.role != Follower || n.leader != msg.From {
+			if err := n.becomeFollower(n.term, msg.From); err != nil {
+				return err
+			}
+		}
+		n.electionElapsed = 0
+		if msg.Type == MsgApp {
+			return n.handleAppend(msg)
+		}
+		return n.handleSnapshot(msg)
+	case MsgAppResp:
+		if n.role == Leader {
+			return n.handleAppendResp(msg)
+		}
+	}
+	return nil
+}
+
+func (n *Node) handleVote(msg *Message) error {
+	lastTerm, _ := n.termAt(n.lastIndex())
+	canVote := n.vote == msg.From || (n.vote == "" && n.leader == "")
+	upToDate := msg.LogTerm > lastTerm || (msg.LogTerm == lastTerm && msg.LogIndex >= n.lastIndex())
+	if !canVote || !upToDate {
+		n.send(&Message{Type: MsgVoteResp, To: msg.From, Reject: true})
+		return nil
+	}
+	if err := n.setHardState(n.term, msg.From); err != nil {
+		return err
+	}
+	n.resetElectionTimeout()
+	n.send(&Message{Type: MsgVoteResp, To: msg.From})
+	return nil
+}
+
+func (n *Node) handleVoteResp(msg *Message) error {
+	if n.role != Candidate {
+		return nil
+	}
+	n.votes[msg.From] = !msg.Reject
+	var granted, rejected int
+	for _, v := range n.votes {
+		if v {
+			granted++
+		} else {
+			rejected++
+		}
+	}
+	if granted >= n.quorum {
+		return n.becomeLeader()
+	}
+	if rejected >= n.quorum {
+		return n.becomeFollower(n.term, "")
+	}
+	return nil
+}
+
+func (n *Node) handleAppend(msg *Message) error {
+	prev, prevTerm, entries := msg.LogIndex, msg.LogTerm, msg.Entries
+	// the entries before the snapshot are committed, so they must match.
+	if prev < n.snapshotIndex {
+		skip := n.snapshotIndex - prev
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		entries = entries[skip:]
+		prev, prevTerm = n.snapshotIndex, n.snapshotTerm
+	}
+	if term, ok := n.termAt(prev); !ok || term != prevTerm {
+		hint := n.lastIndex()
+		if ok {
+			hint = prev - 1
+		}
+		n.send(&Message{Type: MsgAppResp, To: msg.From, Reject: true, Index: hint})
+		return nil
+	}
+
+	for i, entry := range entries {
+		if term, ok := n.termAt(entry.Index); ok {
+			if term == entry.Term {
+				continue
+			}
+			// the conflicting entries and all that follow them are replaced.
+			if err := n.storage.Truncate(entry.Index); err != nil {
+				return err
+			}
+			n.entries = n.entries[:entry.Index-n.snapshotIndex-1]
+		}
+		if err := n.storage.Append(entries[i:]); err != nil {
+			return err
+		}
+		n.entries = append(n.entries, entries[i:]...)
+		break
+	}
+
+	lastNew := prev + uint64(len(entries))
+	if commit := min(msg.Commit, lastNew); commit > n.commitIndex {
+		n.commitIndex = commit
+		if err := n.apply(); err != nil {
+			return err
+		}
+	}
+	n.send(&Message{Type: MsgAppResp, To: msg.From, Index: lastNew})
+	return nil
+}
+
+func (n *Node) handleSnapshot(msg *Message) error {
+	index, term := msg.LogIndex, msg.LogTerm
+	if index <= n.commitIndex {
+		n.send(&Message{Type: MsgAppResp, To: msg.From, Index: n.commitIndex})
+		return nil
+	}
+	// the log already contains the snapshot, only the entries before it are committed.
+	if t, ok := n.termAt(index); ok && t == term {
+		n.commitIndex = index
+		if err := n.apply(); err != nil {
+			return err
+		}
+		n.send(&Message{Type: MsgAppResp, To: msg.From, Index: index})
+		return nil
+	}
+
+	snapshot := &snapshotReader{r: msg.Snapshot}
+	if err := n.sm.Restore(snapshot); err != nil {
+		// the snapshot broken in transit is dropped, the leader will send it again.
+		if snapshot.err != nil {
+			return nil
+		}
+		return err
+	}
+	if n.sm.AppliedIndex() != index {
+		return ErrLogInconsistent
+	}
+	if err := n.storage.Truncate(n.snapshotIndex + 1); err != nil {
+		return err
+	}
+	if err := n.storage.Compact(index, term); err != nil {
+		return err
+	}
+	n.entries = nil
+	n.snapshotIndex, n.snapshotTerm = index, term
+	n.commitIndex, n.appliedIndex = index, index
+	n.send(&Message{Type: MsgAppResp, To: msg.From, Index: index})
+	return nil
+}
+
+func (n *Node) handleAppendResp(msg *Message) error {
+	n.active[msg.From] = true
+	if msg.Reject {
+		next := n.nextIndex[msg.From] - 1
+		if msg.Index+1 < next {
+			next = msg.Index + 1
+		}
+		n.nextIndex[msg.From] = max(next, 1)
+		n.sendAppend(msg.From)
+		return nil
+	}
+
+	if msg.Index > n.matchIndex[msg.From] {
+		n.matchIndex[msg.From] = msg.Index
+	}
+	if n.nextIndex[msg.From] <= msg.Index {
+		n.nextIndex[msg.From] = msg.Index + 1
+	}
+	if err := n.maybeCommit(); err != nil {
+		return err
+	}
+	if n.nextIndex[msg.From] <= n.lastIndex() {
+		n.sendAppend(msg.From)
+	}
+	return nil
+}
+
+// maybeCommit commits the entries replicated to the majority,
+// only the entries of the current term are committed by counting the replicas.
+func (n *Node) maybeCommit() error {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if term, _ := n.termAt(index); term != n.term {
+			break
+		}
+		var replicas int
+		for _, match := range n.matchIndex {
+			if match >= index {
+				replicas++
+			}
+		}
+		if replicas >= n.quorum {
+			n.commitIndex = index
+			return n.apply()
+		}
+	}
+	return nil
+}
+
+// apply applies the committed entries to the state machine, and compacts the log if necessary.
+// The node stops if the state machine fails to apply an entry, since the following entries can't be applied before it.
+func (n *Node) apply() error {
+	for n.appliedIndex < n.commitIndex {
+		entry := n.entries[n.appliedIndex-n.snapshotIndex]
+		applyErr := n.sm.Apply(entry)
+		if applyErr != nil && !errors.Is(applyErr, ErrCommandRejected) {
+			return applyErr
+		}
+		n.appliedIndex = entry.Index
+		if p, ok := n.proposals[entry.Index]; ok {
+			delete(n.proposals, entry.Index)
+			if p.term != entry.Term {
+				applyErr = ErrProposalDropped
+			}
+			p.result <- applyErr
+		}
+	}
+
+	if n.config.SnapshotThreshold == 0 || n.appliedIndex-n.snapshotIndex < n.config.SnapshotThreshold {
+		return nil
+	}
+	// the entries can only be discarded after the state machine is persisted.
+	if err := n.sm.Sync(); err != nil {
+		return err
+	}
+	term, _ := n.termAt(n.appliedIndex)
+	if err := n.storage.Compact(n.appliedIndex, term); err != nil {
+		return err
+	}
+	n.entries = append([]Entry(nil), n.entries[n.appliedIndex-n.snapshotIndex:]...)
+	n.snapshotIndex, n.snapshotTerm = n.appliedIndex, term
+	return nil
+}
+
+// snapshotReader records the error of reading the snapshot stream,
+// which is not an error of the state machine.
+type snapshotReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,312 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNode struct {
+	id      string
+	dirPath string
+	db      *rosedb.DB
+	logDB   *rosedb.DB
+	sm      *DBStateMachine
+	node    *Node
+}
+
+type testCluster struct {
+	t       *testing.T
+	network *MemNetwork
+	peers   []string
+	nodes   map[string]*testNode
+	config  Config
+}
+
+func newTestCluster(t *testing.T, size int, snapshotThreshold uint64) *testCluster {
+	c := &testCluster{
+		t:       t,
+		network: NewMemNetwork(),
+		nodes:   make(map[string]*testNode),
+		config: Config{
+			TickInterval:      10 * time.Millisecond,
+			ElectionTicks:     10,
+			HeartbeatTicks:    1,
+			SnapshotThreshold: snapshotThreshold,
+			SnapshotDir:       t.TempDir(),
+		},
+	}
+	for i := 1; i <= size; i++ {
+		c.peers = append(c.peers, fmt.Sprintf("node-%d", i))
+	}
+	for _, id := range c.peers {
+		c.nodes[id] = &testNode{id: id, dirPath: t.TempDir()}
+		c.start(id)
+	}
+	t.Cleanup(func() {
+		for id := range c.nodes {
+			c.stop(id)
+		}
+	})
+	return c
+}
+
+func (c *testCluster) start(id string) {
+	n := c.nodes[id]
+	options := rosedb.DefaultOptions
+	options.DirPath = n.dirPath + "/data"
+	db, err := rosedb.Open(options)
+	require.NoError(c.t, err)
+	options.DirPath = n.dirPath + "/log"
+	logDB, err := rosedb.Open(options)
+	require.NoError(c.t, err)
+	sm, err := NewDBStateMachine(db)
+	require.NoError(c.t, err)
+
+	config := c.config
+	config.ID, config.Peers = id, c.peers
+	node, err := NewNode(config, sm, NewDBStorage(logDB), c.network.Transport(id))
+	require.NoError(c.t, err)
+	n.db, n.logDB, n.sm, n.node = db, logDB, sm, node
+}
+
+func (c *testCluster) stop(id string) {
+	n := c.nodes[id]
+	if n.node == nil {
+		return
+	}
+	assert.NoError(c.t, n.node.Stop())
+	assert.NoError(c.t, n.db.Close())
+	assert.NoError(c.t, n.logDB.Close())
+	n.node = nil
+}
+
+// waitLeader waits until a leader is elected among the nodes except the excluded one.
+func (c *testCluster) waitLeader(exclude string) *testNode {
+	var leader *testNode
+	require.Eventually(c.t, func() bool {
+		for id, n := range c.nodes {
+			if id != exclude && n.node != nil && n.node.Status().Role == Leader {
+				leader = n
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return leader
+}
+
+func (c *testCluster) waitValue(n *testNode, key, value string) {
+	assert.Eventually(c.t, func() bool {
+		v, err := n.db.Get([]byte(key))
+		return err == nil && string(v) == value
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func propose(leader *testNode, cmd *Command) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return leader.node.Propose(ctx, cmd.Encode())
+}
+
+func TestCommand_Encode(t *testing.T) {
+	cmd := new(Command).Put([]byte("a"), []byte("1")).Delete([]byte("b")).PutWithTTL([]byte("c"), nil, time.Second)
+	decoded, err := DecodeCommand(cmd.Encode())
+	require.NoError(t, err)
+	require.Len(t, decoded.Ops, 3)
+	assert.Equal(t, OpPut, decoded.Ops[0].Type)
+	assert.Equal(t, []byte("1"), decoded.Ops[0].Value)
+	assert.Equal(t, OpDelete, decoded.Ops[1].Type)
+	assert.Equal(t, cmd.Ops[2].Expire, decoded.Ops[2].Expire)
+
+	_, err = DecodeCommand(cmd.Encode()[:5])
+	assert.Equal(t, ErrInvalidCommand, err)
+}
+
+func TestDBStorage(t *testing.T) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	storage := NewDBStorage(db)
+	require.NoError(t, storage.SaveHardState(3, "node-2"))
+	require.NoError(t, storage.Append([]Entry{{Index: 1, Term: 1}, {Index: 2, Term: 3, Data: []byte("x")}}))
+
+	// the hard state and the entries survive a restart.
+	require.NoError(t, db.Close())
+	db, err = rosedb.Open(options)
+	require.NoError(t, err)
+	state, err := NewDBStorage(db).Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), state.Term)
+	assert.Equal(t, "node-2", state.Vote)
+	assert.Equal(t, []Entry{{Index: 1, Term: 1}, {Index: 2, Term: 3, Data: []byte("x")}}, state.Entries)
+}
+
+func TestNode_Replication(t *testing.T) {
+	c := newTestCluster(t, 3, 0)
+	leader := c.waitLeader("")
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		require.NoError(t, propose(leader, new(Command).Put(key, []byte("v"))))
+	}
+	cmd := new(Command).Put([]byte("a"), []byte("1")).Put([]byte("b"), []byte("2")).Delete([]byte("key-0"))
+	require.NoError(t, propose(leader, cmd))
+	// the value is visible in the leader once the proposal returns.
+	v, err := leader.db.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), v)
+
+	for _, n := range c.nodes {
+		c.waitValue(n, "b", "2")
+		_, err = n.db.Get([]byte("key-0"))
+		assert.Equal(t, rosedb.ErrKeyNotFound, err)
+	}
+
+	// the proposals must be sent to the leader.
+	for id, n := range c.nodes {
+		if id != leader.id {
+			assert.Equal(t, ErrNotLeader, propose(n, new(Command).Put([]byte("a"), []byte("2"))))
+		}
+	}
+	// the invalid command is applied without any change.
+	err = propose(leader, new(Command).Put(AppliedIndexKey, []byte("x")))
+	assert.ErrorIs(t, err, ErrCommandRejected)
+	assert.ErrorIs(t, err, ErrInvalidCommand)
+}
+
+// failingStateMachine fails to apply the entries after failAt, like a storage failure.
+type failingStateMachine struct {
+	*DBStateMachine
+	failAt uint64
+}
+
+var errApplyFailed = errors.New("apply failed")
+
+func (sm *failingStateMachine) Apply(entry Entry) error {
+	if entry.Index > sm.failAt {
+		return errApplyFailed
+	}
+	return sm.DBStateMachine.Apply(entry)
+}
+
+func TestNode_ApplyFailure(t *testing.T) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	dbSM, err := NewDBStateMachine(db)
+	require.NoError(t, err)
+	sm := &failingStateMachine{DBStateMachine: dbSM, failAt: 2}
+
+	config := Config{ID: "node-1", Peers: []string{"node-1"}, TickInterval: 10 * time.Millisecond}
+	node, err := NewNode(config, sm, NewMemoryStorage(), NewMemNetwork().Transport("node-1"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return node.Status().Role == Leader
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the entry of the election is 1.
+	leader := &testNode{node: node}
+	require.NoError(t, propose(leader, new(Command).Put([]byte("a"), []byte("1"))))
+	// the node stops instead of skipping the entry which fails to apply.
+	assert.Equal(t, errApplyFailed, propose(leader, new(Command).Put([]byte("b"), []byte("2"))))
+	assert.Equal(t, errApplyFailed, node.Stop())
+	assert.Equal(t, uint64(2), sm.AppliedIndex())
+	_, err = db.Get([]byte("b"))
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+}
+
+func TestNode_LeaderFailure(t *testing.T) {
+	c := newTestCluster(t, 3, 0)
+	old := c.waitLeader("")
+	require.NoError(t, propose(old, new(Command).Put([]byte("k"), []byte("v1"))))
+
+	// a new leader is elected by the majority, and the old one steps down.
+	c.network.Disconnect(old.id)
+	leader := c.waitLeader(old.id)
+	require.NoError(t, propose(leader, new(Command).Put([]byte("k"), []byte("v2"))))
+	assert.Eventually(t, func() bool {
+		return old.node.Status().Role != Leader
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ErrNotLeader, propose(old, new(Command).Put([]byte("k"), []byte("v3"))))
+
+	// the old leader catches up after it is reconnected.
+	c.network.Connect(old.id)
+	c.waitValue(old, "k", "v2")
+
+	// a node continues from its persisted log and state machine after a restart.
+	leader = c.waitLeader("")
+	var follower string
+	for id := range c.nodes {
+		if id != leader.id {
+			follower = id
+		}
+	}
+	c.stop(follower)
+	require.NoError(t, propose(leader, new(Command).Put([]byte("k"), []byte("v4"))))
+	c.start(follower)
+	c.waitValue(c.nodes[follower], "k", "v4")
+}
+
+func TestNode_Snapshot(t *testing.T) {
+	c := newTestCluster(t, 3, 20)
+	leader := c.waitLeader("")
+	var lagging *testNode
+	for id, n := range c.nodes {
+		if id != leader.id {
+			lagging = n
+			break
+		}
+	}
+
+	// the log is compacted while a follower is partitioned,
+	// so it has to catch up with a snapshot.
+	c.network.Disconnect(lagging.id)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		require.NoError(t, propose(leader, new(Command).Put(key, []byte(fmt.Sprintf("v-%d", i)))))
+	}
+	status := leader.node.Status()
+	assert.True(t, status.SnapshotIndex > 0)
+	assert.True(t, status.LastIndex-status.SnapshotIndex < 20)
+
+	c.network.Connect(lagging.id)
+	c.waitValue(lagging, "key-99", "v-99")
+	assert.Eventually(t, func() bool {
+		return lagging.node.Status().SnapshotIndex > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		v, err := lagging.db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("v-%d", i), string(v))
+	}
+
+	// the log continues after the snapshot.
+	leader = c.waitLeader("")
+	require.NoError(t, propose(leader, new(Command).Put([]byte("k"), []byte("v"))))
+	c.waitValue(lagging, "k", "v")
+
+	// the snapshot files are removed after the nodes stop.
+	for id := range c.nodes {
+		c.stop(id)
+	}
+	files, err := os.ReadDir(c.config.SnapshotDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,292 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+var (
+	// ErrInvalidCommand is returned if the data of an entry is not an encoded Command.
+	ErrInvalidCommand = errors.New("raft: invalid command")
+	// ErrCommandRejected is wrapped by the errors of the commands rejected by the state machine,
+	// the entry is applied without any change then.
+	ErrCommandRejected = errors.New("raft: the command is rejected")
+)
+
+// AppliedIndexKey is the reserved key where DBStateMachine stores the index of the last applied entry,
+// it must not be written by the commands.
+var AppliedIndexKey = []byte("__raft_applied_index__")
+
+// StateMachine is the state replicated by Raft, the committed entries are applied to it in order.
+type StateMachine interface {
+	// Apply applies a committed entry, including the entries with empty Data.
+	// An entry may be applied again if the node restarts before the state machine is synced,
+	// so the state machine should ignore the entries not after AppliedIndex.
+	// If the command of the entry is rejected, the error wrapping ErrCommandRejected is returned to the proposer,
+	// and the entry is regarded as applied. Any other error stops the node, the entry is not applied.
+	Apply(entry Entry) error
+	// AppliedIndex returns the index of the last applied entry.
+	AppliedIndex() uint64
+	// Snapshot writes a snapshot which contains all the applied entries to w, and returns the index of the last one.
+	// It is called off the goroutine which applies the entries, so Apply may be called concurrently.
+	Snapshot(w io.Writer) (uint64, error)
+	// Restore replaces the whole state with a snapshot written by Snapshot,
+	// AppliedIndex must return the index of the snapshot after it.
+	// The state must not be changed if r fails, the snapshot broken in transit is sent again.
+	Restore(r io.Reader) error
+	// Sync persists all the applied entries, the entries synced are never applied again.
+	Sync() error
+}
+
+// OpType is the type of an operation in a Command.
+type OpType uint8
+
+const (
+	OpPut OpType = iota + 1
+	OpDelete
+)
+
+// Op is an operation in a Command.
+type Op struct {
+	Type  OpType
+	Key   []byte
+	Value []byte
+	// Expire is the absolute expiration time in unix nano, 0 means never expire.
+	// It is absolute, so all the nodes expire the key at the same time wherever the entry is applied.
+	Expire int64
+}
+
+// Command is the data of an entry applied by DBStateMachine, its operations are committed as a Batch.
+type Command struct {
+	Ops []Op
+}
+
+// Put adds a put operation to the command.
+func (c *Command) Put(key, value []byte) *Command {
+	c.Ops = append(c.Ops, Op{Type: OpPut, Key: key, Value: value})
+	return c
+}
+
+// PutWithTTL adds a put operation to the command, the key expires after ttl from now.
+func (c *Command) PutWithTTL(key, value []byte, ttl time.Duration) *Command {
+	c.Ops = append(c.Ops, Op{Type: OpPut, Key: key, Value: value, Expire: time.Now().Add(ttl).UnixNano()})
+	return c
+}
+
+// Delete adds a delete operation to the command.
+func (c *Command) Delete(key []byte) *Command {
+	c.Ops = append(c.Ops, Op{Type: OpDelete, Key: key})
+	return c
+}
+
+// Encode encodes the command to the data of an entry.
+//
+//	+--------------+----------+---------------+-------+-----------------+-------+--------------+
+//	| ops (uvarint)| type (1) | key size (uv) |  key  | value size (uv) | value | expire (var) | ...
+//	+--------------+----------+---------------+-------+-----------------+-------+--------------+
+func (c *Command) Encode() []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(c.Ops)))
+	for _, op := range c.Ops {
+		buf = append(buf, byte(op.Type))
+		buf = binary.AppendUvarint(buf, uint64(len(op.Key)))
+		buf = append(buf, op.Key...)
+		buf = binary.AppendUvarint(buf, uint64(len(op.Value)))
+		buf = append(buf, op.Value...)
+		buf = binary.AppendVarint(buf, op.Expire)
+	}
+	return buf
+}
+
+// DecodeCommand decodes a command encoded by Encode.
+func DecodeCommand(data []byte) (*Command, error) {
+	readBytes := func() ([]byte, bool) {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return nil, false
+		}
+		b := data[n : n+int(size)]
+		data = data[n+int(size):]
+		return b, true
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, ErrInvalidCommand
+	}
+	data = data[n:]
+	cmd := &Command{Ops: make([]Op, 0, count)}
+	for i := uint64(0); i < count; i++ {
+		if len(data) == 0 {
+			return nil, ErrInvalidCommand
+		}
+		op := Op{Type: OpType(data[0])}
+		data = data[1:]
+		var ok bool
+		if op.Key, ok = readBytes(); !ok {
+			return nil, ErrInvalidCommand
+		}
+		if op.Value, ok = readBytes(); !ok {
+			return nil, ErrInvalidCommand
+		}
+		if op.Expire, n = binary.Varint(data); n <= 0 {
+			return nil, ErrInvalidCommand
+		}
+		data = data[n:]
+		cmd.Ops = append(cmd.Ops, op)
+	}
+	if len(data) != 0 {
+		return nil, ErrInvalidCommand
+	}
+	return cmd, nil
+}
+
+// DBStateMachine is a StateMachine of a rosedb database,
+// the data of the entries are Commands, and the snapshots are the backups of the database.
+//
+// The applied index is stored in AppliedIndexKey within the batch of each entry,
+// so it is always consistent with the data after a crash.
+type DBStateMachine struct {
+	db      *rosedb.DB
+	mu      sync.Mutex
+	applied uint64
+}
+
+// NewDBStateMachine creates a state machine of the database, the database should only be written by it.
+func NewDBStateMachine(db *rosedb.DB) (*DBStateMachine, error) {
+	sm := &DBStateMachine{db: db}
+	if err := sm.loadAppliedIndex(); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (sm *DBStateMachine) loadAppliedIndex() error {
+	value, err := sm.db.Get(AppliedIndexKey)
+	if err == rosedb.ErrKeyNotFound {
+		sm.applied = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(value) != 8 {
+		return ErrLogInconsistent
+	}
+	sm.applied = binary.BigEndian.Uint64(value)
+	return nil
+}
+
+// DB returns the database of the state machine, it should only be used to read.
+func (sm *DBStateMachine) DB() *rosedb.DB {
+	return sm.db
+}
+
+// Apply commits the operations of the command in the entry as a batch, the entry with empty data has no command.
+// If the command is invalid, nothing but the applied index is written, and the error wrapping ErrCommandRejected is returned.
+func (sm *DBStateMachine) Apply(entry Entry) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if entry.Index <= sm.applied {
+		return nil
+	}
+
+	var cmd *Command
+	var cmdErr error
+	if len(entry.Data) > 0 {
+		cmd, cmdErr = DecodeCommand(entry.Data)
+	}
+	// the batch is synced by Sync before the log is compacted.
+	batch := sm.db.NewBatch(rosedb.BatchOptions{})
+	if cmd != nil {
+		if cmdErr = applyOps(batch, cmd.Ops); cmdErr != nil {
+			_ = batch.Rollback()
+			batch = sm.db.NewBatch(rosedb.BatchOptions{})
+		}
+	}
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, entry.Index)
+	if err := batch.Put(AppliedIndexKey, index); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	sm.applied = entry.Index
+	if cmdErr != nil {
+		return fmt.Errorf("%w: %w", ErrCommandRejected, cmdErr)
+	}
+	return nil
+}
+
+func applyOps(batch *rosedb.Batch, ops []Op) error {
+	now := time.Now().UnixNano()
+	for _, op := range ops {
+		var err error
+		switch {
+		case string(op.Key) == string(AppliedIndexKey):
+			err = ErrInvalidCommand
+		case op.Type == OpDelete || (op.Type == OpPut && op.Expire != 0 && op.Expire <= now):
+			err = batch.Delete(op.Key)
+		case op.Type == OpPut && op.Expire != 0:
+			err = batch.PutWithTTL(op.Key, op.Value, time.Duration(op.Expire-now))
+		case op.Type == OpPut:
+			err = batch.Put(op.Key, op.Value)
+		default:
+			err = ErrInvalidCommand
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppliedIndex returns the index of the last applied entry.
+func (sm *DBStateMachine) AppliedIndex() uint64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.applied
+}
+
+// Snapshot writes a backup of the database to w.
+// The files of the backup are taken by Backup before anything is written to w,
+// so the entries are only blocked until the first write, and the ones applied after it are not in the backup.
+func (sm *DBStateMachine) Snapshot(w io.Writer) (uint64, error) {
+	sm.mu.Lock()
+	index := sm.applied
+	unlock := sync.OnceFunc(sm.mu.Unlock)
+	defer unlock()
+	err := sm.db.Backup(writerFunc(func(p []byte) (int, error) {
+		unlock()
+		return w.Write(p)
+	}))
+	return index, err
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// Restore replaces all the data of the database with a backup written by Snapshot.
+func (sm *DBStateMachine) Restore(r io.Reader) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if err := sm.db.RestoreInPlace(r); err != nil {
+		return err
+	}
+	return sm.loadAppliedIndex()
+}
+
+// Sync persists the database.
+func (sm *DBStateMachine) Sync() error {
+	return sm.db.Sync()
+}
@@ -0,0 +1,217 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// State is the persistent state of a node loaded from the storage.
+type State struct {
+	Term          uint64
+	Vote          string
+	SnapshotIndex uint64 // the index of the last entry discarded by Compact
+	SnapshotTerm  uint64
+	Entries       []Entry // the entries after SnapshotIndex
+}
+
+// Storage persists the Raft log and the hard state of a node,
+// all the methods must persist the changes durably before they return.
+type Storage interface {
+	// Load loads the persistent state.
+	Load() (*State, error)
+	// SaveHardState saves the current term and the vote in the term.
+	SaveHardState(term uint64, vote string) error
+	// Append appends the entries after the last entry.
+	Append(entries []Entry) error
+	// Truncate discards the entry at index and all the entries after it.
+	Truncate(index uint64) error
+	// Compact discards the entries up to index, and records the term of the entry at index.
+	Compact(index, term uint64) error
+}
+
+// MemoryStorage is a Storage in memory, it is mostly used in tests.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	state State
+}
+
+// NewMemoryStorage creates an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state
+	state.Entries = append([]Entry(nil), s.state.Entries...)
+	return &state, nil
+}
+
+func (s *MemoryStorage) SaveHardState(term uint64, vote string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Term, s.state.Vote = term, vote
+	return nil
+}
+
+func (s *MemoryStorage) Append(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Entries = append(s.state.Entries, entries...)
+	return nil
+}
+
+func (s *MemoryStorage) Truncate(index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index <= s.state.SnapshotIndex {
+		s.state.Entries = nil
+	} else if n := index - s.state.SnapshotIndex - 1; n < uint64(len(s.state.Entries)) {
+		s.state.Entries = s.state.Entries[:n]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Compact(index, term uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []Entry
+	for _, entry := range s.state.Entries {
+		if entry.Index > index {
+			entries = append(entries, entry)
+		}
+	}
+	s.state.Entries = entries
+	s.state.SnapshotIndex, s.state.SnapshotTerm = index, term
+	return nil
+}
+
+var (
+	hardStateKey      = []byte("h")
+	snapshotKey       = []byte("s")
+	entryKeyPrefix    = []byte("e")
+	entryKeyPrefixEnd = []byte("f")
+)
+
+// DBStorage is a Storage in a rosedb database,
+// which must be a separate database from the one of the state machine.
+//
+// Each entry is stored in a key of its index in big endian, so they are sorted by the index.
+type DBStorage struct {
+	db *rosedb.DB
+}
+
+// NewDBStorage creates a storage in the database.
+func NewDBStorage(db *rosedb.DB) *DBStorage {
+	return &DBStorage{db: db}
+}
+
+func entryKey(index uint64) []byte {
+	return binary.BigEndian.AppendUint64(bytes.Clone(entryKeyPrefix), index)
+}
+
+func (s *DBStorage) Load() (*State, error) {
+	state := &State{}
+	value, err := s.db.Get(hardStateKey)
+	if err != nil && err != rosedb.ErrKeyNotFound {
+		return nil, err
+	}
+	if len(value) >= 8 {
+		state.Term = binary.BigEndian.Uint64(value)
+		state.Vote = string(value[8:])
+	}
+	value, err = s.db.Get(snapshotKey)
+	if err != nil && err != rosedb.ErrKeyNotFound {
+		return nil, err
+	}
+	if len(value) == 16 {
+		state.SnapshotIndex = binary.BigEndian.Uint64(value)
+		state.SnapshotTerm = binary.BigEndian.Uint64(value[8:])
+	}
+
+	var decodeErr error
+	s.db.AscendRange(entryKey(state.SnapshotIndex+1), entryKeyPrefixEnd, func(k, v []byte) (bool, error) {
+		if len(k) != 9 || len(v) < 8 {
+			decodeErr = ErrLogInconsistent
+			return false, nil
+		}
+		entry := Entry{Index: binary.BigEndian.Uint64(k[1:]), Term: binary.BigEndian.Uint64(v)}
+		if len(v) > 8 {
+			entry.Data = bytes.Clone(v[9:])
+		}
+		state.Entries = append(state.Entries, entry)
+		return true, nil
+	})
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	return state, nil
+}
+
+func (s *DBStorage) SaveHardState(term uint64, vote string) error {
+	value := binary.BigEndian.AppendUint64(nil, term)
+	// the vote must be synced, or the node may vote twice in a term after a crash.
+	batch := s.db.NewBatch(rosedb.DefaultBatchOptions)
+	if err := batch.Put(hardStateKey, append(value, vote...)); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+func (s *DBStorage) Append(entries []Entry) error {
+	batch := s.db.NewBatch(rosedb.DefaultBatchOptions)
+	for _, entry := range entries {
+		// the term and a flag byte which distinguishes the empty data from the nil data.
+		value := binary.BigEndian.AppendUint64(nil, entry.Term)
+		if entry.Data != nil {
+			value = append(append(value, 1), entry.Data...)
+		}
+		if err := batch.Put(entryKey(entry.Index), value); err != nil {
+			_ = batch.Rollback()
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// deleteEntries deletes the entries in [start, end) with the other operations in a batch.
+func (s *DBStorage) deleteEntries(start, end []byte, fn func(batch *rosedb.Batch) error) error {
+	var keys [][]byte
+	err := s.db.AscendKeysRange(start, end, nil, false, func(k []byte) (bool, error) {
+		keys = append(keys, k)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	batch := s.db.NewBatch(rosedb.DefaultBatchOptions)
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			_ = batch.Rollback()
+			return err
+		}
+	}
+	if fn != nil {
+		if err := fn(batch); err != nil {
+			_ = batch.Rollback()
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+func (s *DBStorage) Truncate(index uint64) error {
+	return s.deleteEntries(entryKey(index), entryKeyPrefixEnd, nil)
+}
+
+func (s *DBStorage) Compact(index, term uint64) error {
+	return s.deleteEntries(entryKey(0), entryKey(index+1), func(batch *rosedb.Batch) error {
+		value := binary.BigEndian.AppendUint64(nil, index)
+		return batch.Put(snapshotKey, binary.BigEndian.AppendUint64(value, term))
+	})
+}
@@ -0,0 +1,107 @@
+package raft
+
+import (
+	"io"
+	"sync"
+)
+
+// MessageType is the type of a Message.
+type MessageType uint8
+
+const (
+	// MsgVote requests the vote of a node, LogIndex and LogTerm are of the last entry of the candidate.
+	MsgVote MessageType = iota + 1
+	// MsgVoteResp grants the vote unless Reject is true.
+	MsgVoteResp
+	// MsgApp appends Entries after the entry at LogIndex of LogTerm, it is also the heartbeat of the leader.
+	MsgApp
+	// MsgAppResp acknowledges the entries up to Index,
+	// or rejects them with Index as a hint of the last entry which may match.
+	MsgAppResp
+	// MsgSnap installs Snapshot which contains the entries up to LogIndex of LogTerm.
+	MsgSnap
+)
+
+// Message is a message between the nodes of a cluster.
+type Message struct {
+	Type     MessageType
+	From     string
+	To       string
+	Term     uint64
+	LogIndex uint64
+	LogTerm  uint64
+	Entries  []Entry
+	Commit   uint64
+	Reject   bool
+	Index    uint64
+	// Snapshot is streamed from the file of the leader, it can only be read once,
+	// and the transport should copy it to the receiver as it is read.
+	Snapshot io.Reader
+}
+
+// Transport sends the messages between the nodes.
+// The messages may be dropped, duplicated or delayed, which is tolerated by Raft,
+// but the messages from a node to another should be delivered in order.
+type Transport interface {
+	// Send sends a message to the node msg.To, it must not block.
+	Send(msg *Message)
+	// Receive sets the handler of the messages sent to this node.
+	Receive(handler func(msg *Message))
+}
+
+// MemNetwork connects the nodes in the same process, it is used to test a cluster.
+// The messages are shared between the nodes without copying, so they must not be modified.
+type MemNetwork struct {
+	mu       sync.RWMutex
+	handlers map[string]func(msg *Message)
+	down     map[string]bool
+}
+
+// NewMemNetwork creates an in-memory network.
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{
+		handlers: make(map[string]func(msg *Message)),
+		down:     make(map[string]bool),
+	}
+}
+
+// Transport returns the transport of the node id in the network.
+func (nw *MemNetwork) Transport(id string) Transport {
+	return &memTransport{network: nw, id: id}
+}
+
+// Disconnect isolates the node from the network, the messages from or to it are dropped.
+func (nw *MemNetwork) Disconnect(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.down[id] = true
+}
+
+// Connect connects the node to the network again.
+func (nw *MemNetwork) Connect(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.down, id)
+}
+
+type memTransport struct {
+	network *MemNetwork
+	id      string
+}
+
+func (t *memTransport) Send(msg *Message) {
+	nw := t.network
+	nw.mu.RLock()
+	handler := nw.handlers[msg.To]
+	dropped := nw.down[msg.From] || nw.down[msg.To]
+	nw.mu.RUnlock()
+	if handler != nil && !dropped {
+		handler(msg)
+	}
+}
+
+func (t *memTransport) Receive(handler func(msg *Message)) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	t.network.handlers[t.id] = handler
+}
@@ -0,0 +1,118 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/rosedblabs/wal"
+)
+
+// readAheadSize is the size of the data read from a segment file at a time by the read-ahead.
+const readAheadSize = 256 * KB
+
+// readAhead reads the chunks for a forward scan over the index.
+//
+// The records of a merge in key order (see Options.MergeInKeyOrder) are laid out in the order of the keys,
+// so a forward scan reads the chunks of a merged segment one after another.
+// Once two chunks of a sealed segment are read in a row,
+// readAhead reads readAheadSize bytes from the segment file,
+// and the following chunks are decoded from the buffer instead of being read one by one.
+// The chunks which are not read in order, or in the active segment, are read from the WAL as usual.
+type readAhead struct {
+	db    *DB
+	segId wal.SegmentID // the segment of the last chunk read
+	last  int64         // the end offset of the last chunk read in its segment
+
+	file      *os.File      // the segment file of the buffer
+	fileSegId wal.SegmentID // the segment of the buffer
+	start     int64         // the offset of the buffer in the segment file
+	buf       []byte
+}
+
+func newReadAhead(db *DB) *readAhead {
+	return &readAhead{db: db}
+}
+
+// read returns the data of the chunk at the given position.
+func (r *readAhead) read(pos *wal.ChunkPosition) ([]byte, error) {
+	offset := int64(pos.BlockNumber)*walBlockSize + pos.ChunkOffset
+	end := offset + int64(pos.ChunkSize)
+
+	inOrder := pos.SegmentId == r.segId && offset >= r.last && offset-r.last < readAheadSize
+	r.segId, r.last = pos.SegmentId, end
+	if r.file != nil && pos.SegmentId == r.fileSegId && offset >= r.start && end <= r.start+int64(len(r.buf)) {
+		return decodeChunks(r.buf[offset-r.start : end-r.start])
+	}
+	// the position loaded from an old hint file may have no chunk size.
+	if !inOrder || pos.ChunkSize == 0 || pos.SegmentId >= r.db.dataFiles.ActiveSegmentID() {
+		return r.db.dataFiles.Read(pos)
+	}
+
+	if err := r.fill(pos.SegmentId, offset, max(readAheadSize, int(pos.ChunkSize))); err != nil {
+		return nil, err
+	}
+	if end > r.start+int64(len(r.buf)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return decodeChunks(r.buf[offset-r.start : end-r.start])
+}
+
+// fill reads at most size bytes of the segment file from the offset into the buffer.
+func (r *readAhead) fill(segId wal.SegmentID, offset int64, size int) error {
+	if r.file == nil || r.fileSegId != segId {
+		if err := r.close(); err != nil {
+			return err
+		}
+		file, err := os.Open(wal.SegmentFileName(r.db.options.DirPath, dataFileNameSuffix, segId))
+		if err != nil {
+			return err
+		}
+		r.file, r.fileSegId = file, segId
+	}
+
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	n, err := r.file.ReadAt(r.buf[:size], offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	r.start, r.buf = offset, r.buf[:n]
+	return nil
+}
+
+func (r *readAhead) close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.buf = nil, r.buf[:0]
+	return err
+}
+
+// decodeChunks decodes the data of a record from its chunks,
+// which are laid out one after another across the blocks, see how the chunks are written in wal.
+func decodeChunks(buf []byte) ([]byte, error) {
+	var data []byte
+	for {
+		if len(buf) < walChunkHeaderSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+		// the chunk header is checksum(4) | length(2) | type(1).
+		length := walChunkHeaderSize + int(binary.LittleEndian.Uint16(buf[4:6]))
+		if len(buf) < length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if crc32.ChecksumIEEE(buf[4:length]) != binary.LittleEndian.Uint32(buf[:4]) {
+			return nil, wal.ErrInvalidCRC
+		}
+		data = append(data, buf[walChunkHeaderSize:length]...)
+
+		if chunkType := buf[6]; chunkType == wal.ChunkTypeFull || chunkType == wal.ChunkTypeLast {
+			return data, nil
+		}
+		buf = buf[length:]
+	}
+}
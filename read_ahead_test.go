@@ -0,0 +1,65 @@
+package rosedb
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAhead_MergeInKeyOrder(t *testing.T) {
+	options := DefaultOptions
+	options.MergeInKeyOrder = true
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for _, i := range rand.Perm(20000) {
+		key := utils.GetTestKey(i)
+		// some values are split into the chunks of several blocks.
+		value := utils.RandomValue(128)
+		if i%100 == 0 {
+			value = utils.RandomValue(70 * KB)
+		}
+		kvs[string(key)] = value
+		require.NoError(t, db.Put(key, value))
+	}
+	require.NoError(t, db.Merge(true))
+
+	// the chunks read ahead must be the same as the chunks read from the WAL.
+	reader := newReadAhead(db)
+	var buffered bool
+	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		chunk, err := reader.read(pos)
+		assert.NoError(t, err)
+		expected, err := db.dataFiles.Read(pos)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, chunk)
+		buffered = buffered || reader.file != nil
+		return true, nil
+	})
+	assert.True(t, buffered)
+	assert.NoError(t, reader.close())
+
+	iter := db.NewIterator(DefaultIteratorOptions)
+	var count int
+	for ; iter.Valid(); iter.Next() {
+		assert.Equal(t, kvs[string(iter.Item().Key)], iter.Item().Value)
+		count++
+	}
+	assert.NoError(t, iter.Err())
+	iter.Close()
+	assert.Equal(t, len(kvs), count)
+
+	count = 0
+	db.AscendRange(utils.GetTestKey(100), utils.GetTestKey(200), func(k, v []byte) (bool, error) {
+		assert.Equal(t, kvs[string(k)], v)
+		count++
+		return true, nil
+	})
+	assert.Equal(t, 100, count)
+}
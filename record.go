@@ -161,8 +161,37 @@ func decodeHintRecord(buf []byte) ([]byte, *wal.ChunkPosition) {
 	}
 }
 
-func encodeMergeFinRecord(segmentId wal.SegmentID) []byte {
-	buf := make([]byte, 4)
+// +-------------+---------------+
+// |  segment id |   merge time  |
+// +-------------+---------------+
+//
+//	4 bytes         8 bytes
+//
+// The merge time is added later, so it may not exist in the old merge finished file.
+func encodeMergeFinRecord(segmentId wal.SegmentID, mergeTime int64) []byte {
+	buf := make([]byte, 12)
 	binary.LittleEndian.PutUint32(buf, segmentId)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(mergeTime))
 	return buf
 }
+
+// encodeCommitTime encodes the commit time of a batch,
+// it is the value of the batch finished record.
+func encodeCommitTime(commitTime int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(buf, commitTime)
+	return buf[:n]
+}
+
+// decodeCommitTime decodes the commit time from the batch finished record.
+// It returns 0 if the record has no commit time, which is written by the old versions.
+func decodeCommitTime(record *LogRecord) int64 {
+	if len(record.Value) == 0 {
+		return 0
+	}
+	commitTime, n := binary.Varint(record.Value)
+	if n <= 0 {
+		return 0
+	}
+	return commitTime
+}
@@ -0,0 +1,178 @@
+package rosedb
+
+import (
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/rosedblabs/wal"
+)
+
+// exportBatchSize is the max number of records written in one batch by ExportTo.
+const exportBatchSize = 1000
+
+// recoveryTarget is the point to which the WAL is replayed in point-in-time recovery.
+// The batches are loaded in the order they are written to the WAL,
+// and all the batches after the target are ignored.
+type recoveryTarget struct {
+	time    int64  // recover to the last batch committed at or before the time, in nanoseconds
+	batchId uint64 // recover to the batch with the id, if time is 0
+	reached bool   // the target has been reached, the following batches will be ignored
+}
+
+// OpenAt opens a database in read only mode, and recovers it to the state at the specified time.
+// Only the batches committed at or before t are loaded, all the writes after t are invisible.
+//
+// The data files are not modified, any write operation will return ErrDBReadOnly,
+// and ExportTo can be used to write the recovered data to a new database.
+//
+// The history before the last merge is lost, so ErrRecoveryBeforeMerge will be returned
+// if t is before the time of the last merge.
+// A merge which has not been loaded yet (the merge directory exists) is ignored.
+func OpenAt(options Options, t time.Time) (*DB, error) {
+	return openAt(options, &recoveryTarget{time: t.UnixNano()})
+}
+
+// OpenAtBatch is like OpenAt, but recovers the database to the state
+// right after the batch with the specified id is committed.
+//
+// ErrRecoveryTargetNotFound will be returned if the batch is not found in the data files,
+// for example, the batch has been rewritten by a merge.
+func OpenAtBatch(options Options, batchId uint64) (*DB, error) {
+	return openAt(options, &recoveryTarget{batchId: batchId})
+}
+
+func openAt(options Options, target *recoveryTarget) (*DB, error) {
+	// the background tasks may write to the database, disable them.
+	options.AutoMergeCronExpr = ""
+	options.IndexCheckpoint = false
+	options.IndexCheckpointCronExpr = ""
+
+	db, err := open(options, target)
+	if err != nil {
+		return nil, err
+	}
+	if !target.found() {
+		_ = db.Close()
+		return nil, ErrRecoveryTargetNotFound
+	}
+	return db, nil
+}
+
+// includes reports whether the batch should be loaded in the recovery.
+// It must be called in the order the batches are written to the WAL.
+//
+// commitTime is the commit time stored in the batch finished record,
+// if it is 0 (written by the old versions), the time embedded in the batch id will be used.
+func (t *recoveryTarget) includes(batchId uint64, commitTime int64) bool {
+	if t.reached {
+		return false
+	}
+	if t.time == 0 {
+		t.reached = batchId == t.batchId
+		return true
+	}
+	if commitTime == 0 {
+		commitTime = snowflake.ID(batchId).Time() * int64(time.Millisecond)
+	}
+	if commitTime > t.time {
+		t.reached = true
+		return false
+	}
+	return true
+}
+
+// found reports whether the target has been found in the data files.
+func (t *recoveryTarget) found() bool {
+	return t.time != 0 || t.reached
+}
+
+// checkMergeFinTime checks whether the target is after the last merge,
+// since the history before the merge is not kept in the data files.
+func (t *recoveryTarget) checkMergeFinTime(dirPath string) error {
+	if t.time == 0 {
+		// the merged batch will not be found, it is checked after loading.
+		return nil
+	}
+	mergeTime, err := getMergeFinTime(dirPath)
+	if err != nil {
+		return err
+	}
+	if mergeTime > t.time {
+		return ErrRecoveryBeforeMerge
+	}
+	return nil
+}
+
+// ExportTo writes all the valid keys of the database to a new database in the specified directory,
+// the expired keys are skipped, and the others keep their remaining TTL.
+// If the directory exists, it must be empty.
+//
+// It is typically used to save the database recovered by OpenAt,
+// the new database only contains the live data, so it is also compact.
+func (db *DB) ExportTo(dirPath string) error {
+	if err := prepareRestoreDir(dirPath); err != nil {
+		return err
+	}
+
+	options := db.options
+	options.DirPath = dirPath
+	options.WatchQueueSize = 0
+	options.AutoMergeCronExpr = ""
+	options.IndexCheckpoint = false
+	options.IndexCheckpointCronExpr = ""
+	exportDB, err := Open(options)
+	if err != nil {
+		return err
+	}
+
+	if err = db.exportRecords(exportDB); err != nil {
+		_ = exportDB.Close()
+		return err
+	}
+	return exportDB.Close()
+}
+
+func (db *DB) exportRecords(exportDB *DB) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	now := time.Now().UnixNano()
+	batch := exportDB.NewBatch(DefaultBatchOptions)
+	count := 0
+	var err error
+	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		var chunk []byte
+		if chunk, err = db.dataFiles.Read(pos); err != nil {
+			return false, nil
+		}
+		record := decodeLogRecord(chunk)
+		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			return true, nil
+		}
+		if record.Expire > 0 {
+			err = batch.PutWithTTL(key, record.Value, time.Duration(record.Expire-now))
+		} else {
+			err = batch.Put(key, record.Value)
+		}
+		if err != nil {
+			return false, nil
+		}
+
+		// commit the batch every exportBatchSize records to limit the memory usage.
+		if count++; count%exportBatchSize == 0 {
+			if err = batch.Commit(); err != nil {
+				return false, nil
+			}
+			batch = exportDB.NewBatch(DefaultBatchOptions)
+		}
+		return true, nil
+	})
+	if err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
@@ -0,0 +1,149 @@
+package rosedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAt(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+
+	kvs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		key, value := utils.GetTestKey(i), utils.RandomValue(128)
+		kvs[string(key)] = value
+		assert.NoError(t, db.Put(key, value))
+	}
+	time.Sleep(time.Millisecond * 10)
+	target := time.Now()
+	time.Sleep(time.Millisecond * 10)
+
+	// the bad writes after the target.
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), []byte("garbage")))
+	}
+	for i := 5000; i < 6000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.NoError(t, db.Put([]byte("new-key"), []byte("garbage")))
+	require.NoError(t, db.Close())
+
+	db, err = OpenAt(options, target)
+	require.NoError(t, err)
+	for key, value := range kvs {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	_, err = db.Get([]byte("new-key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrDBReadOnly, db.Put([]byte("new-key"), []byte("value")))
+	assert.Equal(t, ErrDBReadOnly, db.Merge(true))
+
+	// write the recovered data to a new database.
+	exportPath := filepath.Join(os.TempDir(), "rosedb-export")
+	defer func() {
+		_ = os.RemoveAll(exportPath)
+	}()
+	require.NoError(t, db.ExportTo(exportPath))
+	require.NoError(t, db.Close())
+
+	exportOptions := DefaultOptions
+	exportOptions.DirPath = exportPath
+	exportDB, err := Open(exportOptions)
+	require.NoError(t, err)
+	defer func() {
+		_ = exportDB.Close()
+	}()
+	assert.Equal(t, len(kvs), exportDB.Stat().KeysNum)
+	for key, value := range kvs {
+		v, err := exportDB.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	// the original database is not modified.
+	db, err = Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+	v, err := db.Get([]byte("new-key"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("garbage"), v)
+}
+
+func TestOpenAtBatch(t *testing.T) {
+	options := DefaultOptions
+	options.WatchQueueSize = 100
+	db, err := Open(options)
+	require.NoError(t, err)
+
+	watchCh, err := db.Watch()
+	require.NoError(t, err)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	assert.NoError(t, batch.Put([]byte("key-1"), []byte("value-1")))
+	assert.NoError(t, batch.PutWithTTL([]byte("key-2"), []byte("value-2"), time.Hour))
+	require.NoError(t, batch.Commit())
+	event := <-watchCh
+	batchId := event.BatchId
+
+	assert.NoError(t, db.Put([]byte("key-1"), []byte("garbage")))
+	assert.NoError(t, db.Delete([]byte("key-2")))
+	require.NoError(t, db.Close())
+
+	options.WatchQueueSize = 0
+	db, err = OpenAtBatch(options, batchId)
+	require.NoError(t, err)
+	v, err := db.Get([]byte("key-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value-1"), v)
+	v, err = db.Get([]byte("key-2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value-2"), v)
+	ttl, err := db.TTL([]byte("key-2"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Hour)
+	require.NoError(t, db.Close())
+
+	_, err = OpenAtBatch(options, 1)
+	assert.Equal(t, ErrRecoveryTargetNotFound, err)
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	destroyDB(db)
+}
+
+func TestOpenAt_BeforeMerge(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	target := time.Now()
+	time.Sleep(time.Millisecond * 10)
+	require.NoError(t, db.Merge(true))
+	assert.NoError(t, db.Put([]byte("new-key"), []byte("value")))
+	require.NoError(t, db.Close())
+
+	_, err = OpenAt(options, target)
+	assert.Equal(t, ErrRecoveryBeforeMerge, err)
+
+	db, err = OpenAt(options, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1001, db.Stat().KeysNum)
+	require.NoError(t, db.Close())
+
+	db, err = Open(options)
+	require.NoError(t, err)
+	destroyDB(db)
+}
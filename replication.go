@@ -0,0 +1,397 @@
+package rosedb
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/rosedblabs/wal"
+)
+
+const (
+	// the layout of the chunks in the WAL, see how the chunks are written in wal.
+	walBlockSize       = 32 * KB
+	walChunkHeaderSize = 7
+)
+
+// WALPosition is a position of a chunk in the WAL, it is used to replicate the WAL.
+//
+// The segments before a merge are rewritten by the merge,
+// so a position in them is only valid for the WAL of the same merge,
+// which is identified by MergeTime, and it is 0 if the database has never been merged.
+type WALPosition struct {
+	SegmentId   wal.SegmentID
+	BlockNumber uint32
+	ChunkOffset int64
+	MergeTime   int64
+}
+
+func (pos WALPosition) chunkPosition() *wal.ChunkPosition {
+	return &wal.ChunkPosition{SegmentId: pos.SegmentId, BlockNumber: pos.BlockNumber, ChunkOffset: pos.ChunkOffset}
+}
+
+// ReadWAL reads the chunks in the WAL from the start position in order,
+// until the end of the WAL or at least maxSize bytes are read,
+// and calls handleFn for each chunk with its position.
+// It returns the position where the next read should start from.
+//
+// The chunks are read under the read lock of the database, and handleFn is called after it is released,
+// so a slow handleFn does not block the writes.
+//
+// The zero start position means the beginning of the WAL.
+//
+// ErrReseedRequired is returned if the start position has been rewritten by a merge,
+// or is not in the WAL at all, the replica must be re-seeded from a backup then.
+func (db *DB) ReadWAL(start WALPosition, maxSize int,
+	handleFn func(chunk []byte, pos WALPosition) error) (WALPosition, error) {
+	chunks, positions, next, err := db.readWALChunks(start, maxSize)
+	if err != nil {
+		return WALPosition{}, err
+	}
+	for i, chunk := range chunks {
+		if err = handleFn(chunk, positions[i]); err != nil {
+			return WALPosition{}, err
+		}
+	}
+	return next, nil
+}
+
+func (db *DB) readWALChunks(start WALPosition, maxSize int) ([][]byte, []WALPosition, WALPosition, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, nil, WALPosition{}, ErrDBClosed
+	}
+
+	mergeFinSegmentId, err := getMergeFinSegmentId(db.options.DirPath)
+	if err != nil {
+		return nil, nil, WALPosition{}, err
+	}
+	mergeTime, err := getMergeFinTime(db.options.DirPath)
+	if err != nil {
+		return nil, nil, WALPosition{}, err
+	}
+	segIds, err := listSegmentIds(db.options.DirPath, dataFileNameSuffix)
+	if err != nil {
+		return nil, nil, WALPosition{}, err
+	}
+	if start.SegmentId == 0 && len(segIds) > 0 {
+		start = WALPosition{SegmentId: segIds[0], MergeTime: mergeTime}
+	}
+	if start.SegmentId <= mergeFinSegmentId && start.MergeTime != mergeTime {
+		return nil, nil, WALPosition{}, ErrReseedRequired
+	}
+	// segIds[i] is the segment of the position.
+	i := 0
+	for i < len(segIds) && segIds[i] < start.SegmentId {
+		i++
+	}
+	if i == len(segIds) || segIds[i] != start.SegmentId {
+		return nil, nil, WALPosition{}, ErrReseedRequired
+	}
+
+	var chunks [][]byte
+	var positions []WALPosition
+	var size int
+	pos := start.chunkPosition()
+	for size < maxSize {
+		chunk, err := db.dataFiles.Read(pos)
+		if err == io.EOF {
+			// the sealed segment is read completely, continue from the next one.
+			if i++; i < len(segIds) {
+				pos = &wal.ChunkPosition{SegmentId: segIds[i]}
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return nil, nil, WALPosition{}, err
+		}
+		chunks = append(chunks, chunk)
+		positions = append(positions, WALPosition{
+			SegmentId:   pos.SegmentId,
+			BlockNumber: pos.BlockNumber,
+			ChunkOffset: pos.ChunkOffset,
+			MergeTime:   mergeTime,
+		})
+		size += len(chunk)
+		pos = chunkEndPosition(pos, len(chunk))
+	}
+
+	next := WALPosition{
+		SegmentId:   pos.SegmentId,
+		BlockNumber: pos.BlockNumber,
+		ChunkOffset: pos.ChunkOffset,
+		MergeTime:   mergeTime,
+	}
+	return chunks, positions, next, nil
+}
+
+// chunkEndPosition returns the position after the chunk of dataSize bytes which starts at pos,
+// which is where the next chunk starts.
+// A chunk is split into several blocks if it can't fit into the current block,
+// and the left space of a block is padded if it can't hold a chunk header.
+func chunkEndPosition(pos *wal.ChunkPosition, dataSize int) *wal.ChunkPosition {
+	blockNumber, offset := pos.BlockNumber, pos.ChunkOffset
+	left := int64(dataSize)
+	for {
+		size := walBlockSize - offset - walChunkHeaderSize
+		if size > left {
+			size = left
+		}
+		left -= size
+		offset += walChunkHeaderSize + size
+		if left == 0 {
+			break
+		}
+		blockNumber++
+		offset = 0
+	}
+	if offset+walChunkHeaderSize >= walBlockSize {
+		blockNumber++
+		offset = 0
+	}
+	return &wal.ChunkPosition{SegmentId: pos.SegmentId, BlockNumber: blockNumber, ChunkOffset: offset}
+}
+
+// Replica is a read only copy of a database,
+// it is kept in sync with the primary by applying the chunks read by ReadWAL of the primary in order.
+//
+// The chunks are written to the WAL of the replica at the same positions as the primary,
+// so a replica can continue from its Position after a disconnection or a restart.
+// The SegmentSize of the replica must not be less than the primary's.
+type Replica struct {
+	db             *DB
+	mu             sync.Mutex
+	position       *wal.ChunkPosition // the position after the last chunk written to the WAL
+	mergeTime      int64
+	pendingBatchId uint64
+	pending        []*replicaChunk // the chunks of the batch which is not finished yet
+}
+
+type replicaChunk struct {
+	data     []byte
+	record   *LogRecord
+	position *wal.ChunkPosition
+}
+
+// OpenReplica opens a replica with the specified options.
+// The auto merge and the index checkpoint are disabled,
+// since a replica must never rewrite its WAL by itself.
+func OpenReplica(options Options) (*Replica, error) {
+	options.AutoMergeCronExpr = ""
+	options.IndexCheckpoint = false
+	db, err := Open(options)
+	if err != nil {
+		return nil, err
+	}
+	db.readOnly = true
+
+	r := &Replica{db: db}
+	if err = r.loadPosition(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// DB returns the database of the replica, it can only be used to read,
+// and the writes will return ErrDBReadOnly.
+func (r *Replica) DB() *DB {
+	return r.db
+}
+
+// Close the replica and its database.
+func (r *Replica) Close() error {
+	return r.db.Close()
+}
+
+// Position returns the position in the WAL of the primary which the replica should continue from.
+func (r *Replica) Position() WALPosition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return WALPosition{
+		SegmentId:   r.position.SegmentId,
+		BlockNumber: r.position.BlockNumber,
+		ChunkOffset: r.position.ChunkOffset,
+		MergeTime:   r.mergeTime,
+	}
+}
+
+// walEndPosition returns the position after the last chunk in the WAL, where the next chunk will be written.
+func (db *DB) walEndPosition() (*wal.ChunkPosition, error) {
+	activeSegId := db.dataFiles.ActiveSegmentID()
+	stat, err := os.Stat(wal.SegmentFileName(db.options.DirPath, dataFileNameSuffix, activeSegId))
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	position := &wal.ChunkPosition{
+		SegmentId:   activeSegId,
+		BlockNumber: uint32(size / walBlockSize),
+		ChunkOffset: size % walBlockSize,
+	}
+	if position.ChunkOffset+walChunkHeaderSize >= walBlockSize {
+		position.BlockNumber++
+		position.ChunkOffset = 0
+	}
+	return position, nil
+}
+
+// loadPosition sets the position of the replica to the end of its WAL.
+func (r *Replica) loadPosition() error {
+	position, err := r.db.walEndPosition()
+	if err != nil {
+		return err
+	}
+	mergeTime, err := getMergeFinTime(r.db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	r.position = position
+	r.mergeTime = mergeTime
+	r.pending, r.pendingBatchId = nil, 0
+	return nil
+}
+
+// Apply writes a chunk read from the WAL of the primary to the replica.
+// The chunks must be applied in the order they are read, starting from Position.
+//
+// The records of a batch are buffered until the batch finished record is applied,
+// then they are written and indexed together, so the readers never see a part of a batch.
+// If the primary sends the buffered chunks again after a reconnection, they are replaced.
+//
+// ErrReseedRequired is returned if the chunk is not at the expected position,
+// or the WAL of the replica diverges from the primary.
+func (r *Replica) Apply(chunk []byte, pos WALPosition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	position := pos.chunkPosition()
+	if len(r.pending) > 0 && positionEquals(position, r.position) {
+		r.pending, r.pendingBatchId = nil, 0
+	}
+	expected := r.position
+	if n := len(r.pending); n > 0 {
+		expected = chunkEndPosition(r.pending[n-1].position, len(r.pending[n-1].data))
+	}
+	// the primary opens a new segment if the active one is full or sealed,
+	// the segments skipped are empty, for example, the active segment is sealed twice by the merges.
+	newSegment := position.SegmentId > expected.SegmentId &&
+		position.BlockNumber == 0 && position.ChunkOffset == 0
+	if !positionEquals(position, expected) && !newSegment {
+		return ErrReseedRequired
+	}
+
+	// the chunk is copied, because it may be reused by the caller.
+	data := make([]byte, len(chunk))
+	copy(data, chunk)
+	record := decodeLogRecord(data)
+	batchId := record.BatchId
+	if record.Type == LogRecordBatchFinished {
+		id, err := snowflake.ParseBytes(record.Key)
+		if err != nil {
+			return err
+		}
+		batchId = uint64(id)
+	}
+
+	// the records of another batch are never finished,
+	// they are written to keep the WAL same as the primary's, but not indexed.
+	if len(r.pending) > 0 && (batchId != r.pendingBatchId || newSegment) {
+		if err := r.flush(false); err != nil {
+			return err
+		}
+	}
+	r.pending = append(r.pending, &replicaChunk{data: data, record: record, position: position})
+	r.pendingBatchId = batchId
+
+	// the merged records have no batch finished record.
+	if record.Type == LogRecordBatchFinished || batchId == mergeFinishedBatchID {
+		return r.flush(true)
+	}
+	return nil
+}
+
+// flush writes the pending chunks to the WAL, and indexes the records if the batch is committed.
+func (r *Replica) flush(committed bool) error {
+	chunks := r.pending
+	r.pending, r.pendingBatchId = nil, 0
+
+	db := r.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	if segId := chunks[0].position.SegmentId; segId < db.dataFiles.ActiveSegmentID() {
+		return ErrReseedRequired
+	}
+	// the empty segments of the primary are created too, so the segment ids are the same.
+	for chunks[0].position.SegmentId > db.dataFiles.ActiveSegmentID() {
+		if err := db.dataFiles.OpenNewActiveSegment(); err != nil {
+			return err
+		}
+	}
+	for _, chunk := range chunks {
+		db.dataFiles.PendingWrites(chunk.data)
+	}
+	positions, err := db.dataFiles.WriteAll()
+	if err != nil {
+		db.dataFiles.ClearPendingWrites()
+		return err
+	}
+	for i, position := range positions {
+		if !positionEquals(position, chunks[i].position) {
+			return ErrReseedRequired
+		}
+	}
+	last := chunks[len(chunks)-1]
+	r.position = chunkEndPosition(last.position, len(last.data))
+	if !committed {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	// the merged records have no commit time.
+	var commitTime int64
+	if last.record.Type == LogRecordBatchFinished {
+		commitTime = decodeCommitTime(last.record)
+	}
+	var events []*Event
+	watching := db.watching()
+	for i, chunk := range chunks {
+		record := chunk.record
+		if record.Type == LogRecordBatchFinished {
+			continue
+		}
+		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			db.index.Delete(record.Key)
+		} else {
+			db.index.Put(record.Key, positions[i])
+		}
+
+		if watching {
+			events = append(events, newEvent(record, commitTime))
+		}
+	}
+	if watching {
+		db.publishEvents(events)
+	}
+	return nil
+}
+
+// Reseed replaces all the data of the replica with a backup of the primary created by Backup,
+// then the replica continues from the end of the backup.
+// It is required when the WAL of the primary from the position of the replica has been rewritten by a merge.
+func (r *Replica) Reseed(backup io.Reader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.db.restoreInPlace(backup); err != nil {
+		return err
+	}
+	return r.loadPosition()
+}
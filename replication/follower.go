@@ -0,0 +1,228 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// errReseed indicates the replica must be re-seeded before streaming again.
+var errReseed = errors.New("replication: reseed required")
+
+// Status is the replication status of a replica.
+type Status struct {
+	// Connected indicates whether the replica is connected to the primary.
+	Connected bool
+	// Position is the position in the WAL of the primary which the replica has applied up to.
+	Position rosedb.WALPosition
+	// PrimaryPosition is the end of the WAL of the primary at the last heartbeat.
+	PrimaryPosition rosedb.WALPosition
+	// CaughtUpAt is the last time the replica has applied all the WAL of the primary,
+	// all the writes acknowledged by the primary before it are visible in the replica.
+	CaughtUpAt time.Time
+	// Lag is the time since CaughtUpAt, it is -1 if the replica has never caught up.
+	Lag time.Duration
+	// Reseeds is the number of times the replica has been re-seeded.
+	Reseeds int
+	// LastError is the error which broke the last connection, nil if there is none.
+	LastError error
+}
+
+// Follower keeps a replica in sync with the primary.
+type Follower struct {
+	// RetryInterval is how long to wait before reconnecting to the primary after the connection fails.
+	RetryInterval time.Duration
+
+	replica *rosedb.Replica
+	addr    string
+
+	mu         sync.Mutex
+	status     Status
+	needReseed bool
+}
+
+// NewFollower creates a follower which replicates the primary at addr to the replica.
+func NewFollower(replica *rosedb.Replica, addr string) *Follower {
+	return &Follower{
+		RetryInterval: time.Second,
+		replica:       replica,
+		addr:          addr,
+	}
+}
+
+// Status returns the replication status of the replica.
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	status := f.status
+	f.mu.Unlock()
+
+	status.Position = f.replica.Position()
+	status.Lag = -1
+	if !status.CaughtUpAt.IsZero() {
+		status.Lag = time.Since(status.CaughtUpAt)
+	}
+	return status
+}
+
+// Run replicates the primary until ctx is done, and returns the error of ctx.
+// It reconnects to the primary after RetryInterval if the connection fails,
+// and continues from the position of the replica.
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		err := f.session(ctx)
+		f.mu.Lock()
+		f.status.Connected = false
+		if err != errReseed {
+			f.status.LastError = err
+		}
+		f.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// reconnect immediately to re-seed, or to stream after re-seeded.
+		if err == errReseed || err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.RetryInterval):
+		}
+	}
+}
+
+// session connects to the primary, and re-seeds the replica or streams the WAL until the connection fails.
+func (f *Follower) session(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	f.mu.Lock()
+	needReseed := f.needReseed
+	f.status.Connected = true
+	f.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	if needReseed {
+		if err = writeHandshake(conn, modeSnapshot, rosedb.WALPosition{}); err != nil {
+			return err
+		}
+		return f.reseed(r)
+	}
+	if err = writeHandshake(conn, modeStream, f.replica.Position()); err != nil {
+		return err
+	}
+	return f.stream(r)
+}
+
+// stream applies the chunks of the WAL sent by the primary to the replica.
+func (f *Follower) stream(r *bufio.Reader) error {
+	var buf []byte
+	for {
+		typ, payload, err := readFrame(r, buf)
+		if err != nil {
+			return err
+		}
+		buf = payload
+
+		switch typ {
+		case frameChunk:
+			if len(payload) < positionSize {
+				return fmt.Errorf("replication: invalid chunk frame")
+			}
+			err = f.replica.Apply(payload[positionSize:], decodePosition(payload[:positionSize]))
+			if errors.Is(err, rosedb.ErrReseedRequired) {
+				return f.setNeedReseed()
+			}
+			if err != nil {
+				return err
+			}
+		case frameHeartbeat:
+			if len(payload) != positionSize {
+				return fmt.Errorf("replication: invalid heartbeat frame")
+			}
+			// the primary sends a heartbeat only after all the chunks before are sent.
+			f.mu.Lock()
+			f.status.PrimaryPosition = decodePosition(payload)
+			f.status.CaughtUpAt = time.Now()
+			f.mu.Unlock()
+		case frameReseed:
+			return f.setNeedReseed()
+		case frameError:
+			return fmt.Errorf("replication: primary error: %s", payload)
+		default:
+			return fmt.Errorf("replication: unexpected frame type %d", typ)
+		}
+	}
+}
+
+func (f *Follower) setNeedReseed() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.needReseed = true
+	return errReseed
+}
+
+// reseed receives a backup from the primary, and re-seeds the replica with it.
+func (f *Follower) reseed(r *bufio.Reader) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := f.replica.Reseed(pr)
+		// unblock the writer if the backup is not read completely.
+		_ = pr.Close()
+		done <- err
+	}()
+
+	var buf []byte
+	for {
+		typ, payload, err := readFrame(r, buf)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			<-done
+			return err
+		}
+		buf = payload
+
+		switch typ {
+		case frameSnapshot:
+			// the error of Reseed is returned after the whole backup is received.
+			_, _ = pw.Write(payload)
+		case frameSnapshotEnd:
+			_ = pw.Close()
+			if err = <-done; err != nil {
+				return err
+			}
+			f.mu.Lock()
+			f.needReseed = false
+			f.status.Reseeds++
+			f.mu.Unlock()
+			return nil
+		default:
+			err = fmt.Errorf("replication: unexpected frame type %d", typ)
+			if typ == frameError {
+				err = fmt.Errorf("replication: primary error: %s", payload)
+			}
+			_ = pw.CloseWithError(err)
+			<-done
+			return err
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package replication replicates a rosedb database from a primary to the replicas
+// by shipping the WAL of the primary over TCP.
+//
+// The Primary serves the chunks of the WAL of a database from the position requested by a replica,
+// and the Follower applies them to a rosedb.Replica in order, which serves the reads.
+// The Follower reconnects and continues from the position of the replica after a disconnection,
+// and re-seeds the replica from a backup of the primary if the position has been rewritten by a merge.
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// ErrPrimaryClosed is returned by Serve and ListenAndServe after Close is called.
+var ErrPrimaryClosed = errors.New("replication: primary closed")
+
+const (
+	// pollInterval is how often the primary checks the new writes after it catches up with the end of the WAL.
+	pollInterval = 100 * time.Millisecond
+	// maxReadSize is the max size of the chunks read from the WAL at a time.
+	maxReadSize = rosedb.MB
+	// handshakeTimeout is the max time to wait for the handshake of a replica.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Primary serves the WAL of a database to the replicas.
+type Primary struct {
+	db *rosedb.DB
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewPrimary creates a primary for the database.
+// The database is not closed by the primary, the caller should close it after Close.
+func NewPrimary(db *rosedb.DB) *Primary {
+	return &Primary{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		closeCh:   make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr, and then calls Serve.
+func (p *Primary) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(listener)
+}
+
+// Serve accepts the connections of the replicas on the listener,
+// and streams the WAL to each replica in a new goroutine.
+// It always returns a non-nil error, and ErrPrimaryClosed after Close is called.
+func (p *Primary) Serve(listener net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		_ = listener.Close()
+		return ErrPrimaryClosed
+	}
+	p.listeners[listener] = struct{}{}
+	p.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(p.listeners, listener)
+			if p.closed {
+				return ErrPrimaryClosed
+			}
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = conn.Close()
+			return ErrPrimaryClosed
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+		go p.serveConn(conn)
+	}
+}
+
+// Close closes all the listeners and the connections of the replicas,
+// and waits for the streams to exit.
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closeCh)
+		for listener := range p.listeners {
+			_ = listener.Close()
+		}
+		for conn := range p.conns {
+			_ = conn.Close()
+		}
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Primary) serveConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		p.wg.Done()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	mode, pos, err := readHandshake(conn)
+	if err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	w := bufio.NewWriter(conn)
+	if mode == modeSnapshot {
+		err = p.sendSnapshot(w)
+	} else {
+		err = p.stream(w, pos)
+	}
+	// tell the replica why the primary stops, unless the connection is broken.
+	var netErr net.Error
+	if err != nil && !errors.As(err, &netErr) {
+		_ = writeFrame(w, frameError, []byte(err.Error()))
+	}
+	_ = w.Flush()
+}
+
+// sendSnapshot sends a backup of the database to the replica, to re-seed it.
+func (p *Primary) sendSnapshot(w *bufio.Writer) error {
+	if err := p.db.Backup(&snapshotWriter{w: w}); err != nil {
+		return err
+	}
+	return writeFrame(w, frameSnapshotEnd)
+}
+
+// stream sends the chunks of the WAL from the position to the replica,
+// and a heartbeat whenever it catches up with the end of the WAL.
+func (p *Primary) stream(w *bufio.Writer, pos rosedb.WALPosition) error {
+	posBuf := make([]byte, positionSize)
+	for {
+		var size int
+		next, err := p.db.ReadWAL(pos, maxReadSize, func(chunk []byte, chunkPos rosedb.WALPosition) error {
+			size += len(chunk)
+			encodePosition(posBuf, chunkPos)
+			return writeFrame(w, frameChunk, posBuf, chunk)
+		})
+		if errors.Is(err, rosedb.ErrReseedRequired) {
+			return writeFrame(w, frameReseed)
+		}
+		if err != nil {
+			return err
+		}
+		pos = next
+		if size >= maxReadSize {
+			continue
+		}
+
+		if err = writePosition(w, frameHeartbeat, pos); err != nil {
+			return err
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-p.closeCh:
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
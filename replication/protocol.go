@@ -0,0 +1,157 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/rosedblabs/wal"
+)
+
+// The protocol between the primary and the replica:
+//
+// The replica sends a handshake after connected:
+//
+//	+----------------+--------+------------+
+//	|     magic      |  mode  |  position  |
+//	+----------------+--------+------------+
+//	     8 bytes       1 byte    24 bytes
+//
+// In the stream mode, the primary sends the chunks of its WAL from the position,
+// and a heartbeat whenever it catches up with the end of the WAL.
+// If the position is unavailable, a reseed frame is sent and the connection is closed,
+// then the replica should connect again in the snapshot mode,
+// and the primary sends a backup of the database in the snapshot frames.
+//
+// All the messages from the primary are frames:
+//
+//	+--------+----------+-----------+
+//	|  type  |  length  |  payload  |
+//	+--------+----------+-----------+
+//	  1 byte    4 bytes    length bytes
+const (
+	handshakeMagic = "ROSEREPL"
+	handshakeSize  = len(handshakeMagic) + 1 + positionSize
+	positionSize   = 24
+	frameHeadSize  = 5
+)
+
+const (
+	modeStream byte = iota
+	modeSnapshot
+)
+
+const (
+	// frameChunk is a chunk of the WAL, the payload is the position and the chunk.
+	frameChunk byte = iota + 1
+	// frameHeartbeat is sent when the primary catches up with the end of its WAL,
+	// the payload is the end position.
+	frameHeartbeat
+	// frameReseed tells the replica that its position is unavailable.
+	frameReseed
+	// frameSnapshot is a part of the backup archive.
+	frameSnapshot
+	// frameSnapshotEnd is the end of the backup archive.
+	frameSnapshotEnd
+	// frameError is an error of the primary, the payload is the message.
+	frameError
+)
+
+var errInvalidHandshake = errors.New("replication: invalid handshake")
+
+func encodePosition(buf []byte, pos rosedb.WALPosition) {
+	binary.BigEndian.PutUint32(buf[0:4], uint32(pos.SegmentId))
+	binary.BigEndian.PutUint32(buf[4:8], pos.BlockNumber)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(pos.ChunkOffset))
+	binary.BigEndian.PutUint64(buf[16:24], uint64(pos.MergeTime))
+}
+
+func decodePosition(buf []byte) rosedb.WALPosition {
+	return rosedb.WALPosition{
+		SegmentId:   wal.SegmentID(binary.BigEndian.Uint32(buf[0:4])),
+		BlockNumber: binary.BigEndian.Uint32(buf[4:8]),
+		ChunkOffset: int64(binary.BigEndian.Uint64(buf[8:16])),
+		MergeTime:   int64(binary.BigEndian.Uint64(buf[16:24])),
+	}
+}
+
+func writeHandshake(w io.Writer, mode byte, pos rosedb.WALPosition) error {
+	buf := make([]byte, handshakeSize)
+	copy(buf, handshakeMagic)
+	buf[len(handshakeMagic)] = mode
+	encodePosition(buf[len(handshakeMagic)+1:], pos)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readHandshake(r io.Reader) (byte, rosedb.WALPosition, error) {
+	buf := make([]byte, handshakeSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, rosedb.WALPosition{}, err
+	}
+	if string(buf[:len(handshakeMagic)]) != handshakeMagic {
+		return 0, rosedb.WALPosition{}, errInvalidHandshake
+	}
+	mode := buf[len(handshakeMagic)]
+	if mode != modeStream && mode != modeSnapshot {
+		return 0, rosedb.WALPosition{}, errInvalidHandshake
+	}
+	return mode, decodePosition(buf[len(handshakeMagic)+1:]), nil
+}
+
+// writeFrame writes a frame whose payload is the concatenation of the parts.
+func writeFrame(w *bufio.Writer, typ byte, parts ...[]byte) error {
+	var length int
+	for _, part := range parts {
+		length += len(part)
+	}
+	var head [frameHeadSize]byte
+	head[0] = typ
+	binary.BigEndian.PutUint32(head[1:], uint32(length))
+	if _, err := w.Write(head[:]); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePosition(w *bufio.Writer, typ byte, pos rosedb.WALPosition) error {
+	buf := make([]byte, positionSize)
+	encodePosition(buf, pos)
+	return writeFrame(w, typ, buf)
+}
+
+// readFrame reads a frame, the payload is only valid until the next call.
+func readFrame(r *bufio.Reader, buf []byte) (byte, []byte, error) {
+	var head [frameHeadSize]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(head[1:])
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return head[0], buf, nil
+}
+
+// snapshotWriter splits the backup archive into the snapshot frames.
+type snapshotWriter struct {
+	w *bufio.Writer
+}
+
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	if err := writeFrame(sw.w, frameSnapshot, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
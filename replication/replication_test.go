@@ -0,0 +1,108 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startPrimary(t *testing.T, db *rosedb.DB, addr string) (*Primary, string) {
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	p := NewPrimary(db)
+	go func() {
+		_ = p.Serve(listener)
+	}()
+	return p, listener.Addr().String()
+}
+
+func waitForValue(t *testing.T, db *rosedb.DB, key, value string) {
+	assert.Eventually(t, func() bool {
+		v, err := db.Get([]byte(key))
+		return err == nil && string(v) == value
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReplication(t *testing.T) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	options.SegmentSize = rosedb.MB
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), make([]byte, 2048)))
+	}
+	primary, addr := startPrimary(t, db, "127.0.0.1:0")
+
+	replicaOpts := options
+	replicaOpts.DirPath = t.TempDir()
+	replica, err := rosedb.OpenReplica(replicaOpts)
+	require.NoError(t, err)
+	defer func() {
+		_ = replica.Close()
+	}()
+	follower := NewFollower(replica, addr)
+	follower.RetryInterval = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- follower.Run(ctx)
+	}()
+
+	// catch up with the existing data, then follow the new writes.
+	require.NoError(t, db.Put([]byte("k"), []byte("v1")))
+	waitForValue(t, replica.DB(), "k", "v1")
+	assert.Equal(t, 1001, replica.DB().Stat().KeysNum)
+	require.NoError(t, db.Delete([]byte("key-0")))
+	assert.Eventually(t, func() bool {
+		_, err := replica.DB().Get([]byte("key-0"))
+		return err == rosedb.ErrKeyNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		status := follower.Status()
+		return status.Connected && status.Position == status.PrimaryPosition
+	}, 5*time.Second, 10*time.Millisecond)
+	status := follower.Status()
+	assert.True(t, status.Lag >= 0 && status.Lag < time.Second)
+	assert.NoError(t, status.LastError)
+
+	// catch up after a disconnection.
+	require.NoError(t, primary.Close())
+	assert.Eventually(t, func() bool {
+		return !follower.Status().Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, db.Put([]byte("k"), []byte("v2")))
+	primary, _ = startPrimary(t, db, addr)
+	waitForValue(t, replica.DB(), "k", "v2")
+
+	// re-seed if the position of the replica is rewritten by a merge,
+	// a connected replica which has caught up continues from the new active segment.
+	require.NoError(t, primary.Close())
+	assert.Eventually(t, func() bool {
+		return !follower.Status().Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, db.Merge(true))
+	require.NoError(t, db.Put([]byte("k"), []byte("v3")))
+	primary, _ = startPrimary(t, db, addr)
+	waitForValue(t, replica.DB(), "k", "v3")
+	assert.Eventually(t, func() bool {
+		return follower.Status().Reseeds == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.Stat().KeysNum, replica.DB().Stat().KeysNum)
+	require.NoError(t, db.Put([]byte("k"), []byte("v4")))
+	waitForValue(t, replica.DB(), "k", "v4")
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-runErr)
+	assert.NoError(t, primary.Close())
+}
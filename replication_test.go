@@ -0,0 +1,141 @@
+package rosedb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncReplica applies the WAL of the primary to the replica until it catches up.
+func syncReplica(primary *DB, replica *Replica) error {
+	pos := replica.Position()
+	for {
+		var n int
+		next, err := primary.ReadWAL(pos, 64*KB, func(chunk []byte, pos WALPosition) error {
+			n++
+			return replica.Apply(chunk, pos)
+		})
+		if err != nil || n == 0 {
+			return err
+		}
+		pos = next
+	}
+}
+
+func assertReplicaEqual(t *testing.T, primary *DB, replica *Replica) {
+	assert.Equal(t, primary.Stat().KeysNum, replica.DB().Stat().KeysNum)
+	primary.Ascend(func(k, v []byte) (bool, error) {
+		value, err := replica.DB().Get(k)
+		assert.NoError(t, err)
+		assert.Equal(t, v, value)
+		return true, nil
+	})
+}
+
+func TestReplica(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = MB
+	primary, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(primary)
+
+	replicaOpts := options
+	replicaOpts.DirPath = filepath.Join(os.TempDir(), "rosedb-replica-test")
+	_ = os.RemoveAll(replicaOpts.DirPath)
+	replica, err := OpenReplica(replicaOpts)
+	require.NoError(t, err)
+	defer func() {
+		_ = replica.Close()
+		_ = os.RemoveAll(replicaOpts.DirPath)
+	}()
+
+	// the values across the blocks and the segments.
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(1024)))
+	}
+	require.NoError(t, primary.Put([]byte("large"), utils.RandomValue(100*KB)))
+	for i := 0; i < 500; i++ {
+		require.NoError(t, primary.Delete(utils.GetTestKey(i)))
+	}
+	require.NoError(t, syncReplica(primary, replica))
+	assertReplicaEqual(t, primary, replica)
+	assert.Equal(t, ErrDBReadOnly, replica.DB().Put([]byte("k"), []byte("v")))
+
+	// the replica can be backed up, and its segments are kept the same as the primary's.
+	cpOpts := options
+	cpOpts.DirPath = filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, replica.DB().Checkpoint(cpOpts.DirPath))
+	_, err = replica.DB().BackupSince(nil, new(bytes.Buffer))
+	require.NoError(t, err)
+	assert.Equal(t, primary.dataFiles.ActiveSegmentID(), replica.DB().dataFiles.ActiveSegmentID())
+	cp, err := Open(cpOpts)
+	require.NoError(t, err)
+	assertReplicaEqual(t, primary, &Replica{db: cp})
+	require.NoError(t, cp.Close())
+
+	// a batch is invisible until it is finished, and can be sent again.
+	batch := primary.NewBatch(DefaultBatchOptions)
+	require.NoError(t, batch.Put([]byte("b1"), []byte("v1")))
+	require.NoError(t, batch.Put([]byte("b2"), []byte("v2")))
+	require.NoError(t, batch.Commit())
+	var n int
+	_, err = primary.ReadWAL(replica.Position(), 64*KB, func(chunk []byte, pos WALPosition) error {
+		if n++; n == 1 {
+			return replica.Apply(chunk, pos)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = replica.DB().Get([]byte("b1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	require.NoError(t, syncReplica(primary, replica))
+	assertReplicaEqual(t, primary, replica)
+
+	// the chunk at an unexpected position.
+	require.NoError(t, primary.Put([]byte("k1"), []byte("v1")))
+	require.NoError(t, primary.Put([]byte("k2"), []byte("v2")))
+	n = 0
+	_, err = primary.ReadWAL(replica.Position(), 64*KB, func(chunk []byte, pos WALPosition) error {
+		if n++; n > 2 {
+			return replica.Apply(chunk, pos)
+		}
+		return nil
+	})
+	assert.Equal(t, ErrReseedRequired, err)
+
+	// continue after a restart.
+	position := replica.Position()
+	require.NoError(t, replica.Close())
+	replica, err = OpenReplica(replicaOpts)
+	require.NoError(t, err)
+	assert.Equal(t, position, replica.Position())
+	require.NoError(t, syncReplica(primary, replica))
+	assertReplicaEqual(t, primary, replica)
+
+	// the empty segments sealed by the merges which are not reopened are skipped.
+	require.NoError(t, primary.Merge(false))
+	require.NoError(t, primary.Merge(false))
+	require.NoError(t, primary.Put([]byte("after-rotation"), []byte("v")))
+	require.NoError(t, syncReplica(primary, replica))
+	assertReplicaEqual(t, primary, replica)
+	assert.Equal(t, primary.dataFiles.ActiveSegmentID(), replica.DB().dataFiles.ActiveSegmentID())
+
+	// re-seed after the WAL is rewritten by a merge.
+	require.NoError(t, primary.Merge(true))
+	require.NoError(t, primary.Put([]byte("after-merge"), []byte("v")))
+	assert.Equal(t, ErrReseedRequired, syncReplica(primary, replica))
+	buf := new(bytes.Buffer)
+	require.NoError(t, primary.Backup(buf))
+	require.NoError(t, replica.Reseed(buf))
+	require.NoError(t, primary.Put([]byte("after-reseed"), []byte("v")))
+	require.NoError(t, syncReplica(primary, replica))
+	assertReplicaEqual(t, primary, replica)
+	value, err := replica.DB().Get([]byte("after-reseed"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
@@ -0,0 +1,381 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/rosedblabs/wal"
+)
+
+// A secondary index maps the values extracted from the key-value pairs to their keys,
+// each pair of an indexed value and a key is stored as an entry without value:
+//
+//	index entry: 0x00 | 'x' | uvarint(len(name)) | name | escape(indexed value) | key
+//	index meta:  0x00 | 'i' | name, written when the existing data has been backfilled,
+//	             its value is indexMetaStale if a key is written while the index is not created
+//
+// The indexed value is escaped so that the entries are sorted by the indexed value first, then by the key.
+// The entries are written with the same expiration time as the key, in the same batch as the key.
+// Only the plain key-value pairs are indexed, the keys starting with 0x00 are reserved.
+const (
+	indexEntryTag = 'x'
+	indexMetaTag  = 'i'
+
+	// backfillBatchSize is the max number of the keys indexed in a batch when an index is created.
+	backfillBatchSize = 1024
+)
+
+// indexMetaStale is the value of the index meta of a stale index, which misses some writes.
+var indexMetaStale = []byte{1}
+
+// IndexFunc extracts the values by which the key-value pair is indexed, nil means the pair is not indexed.
+// It is called while the batch is being committed, so it must not access the database.
+type IndexFunc func(key, value []byte) [][]byte
+
+type secondaryIndex struct {
+	name      string
+	extractFn IndexFunc
+}
+
+// escapeIndexValue escapes the byte 0x00 in the value as 0x00 0xff, and terminates it with 0x00 0x01,
+// so the order of the escaped values is the same as the values, and the key can follow it.
+func escapeIndexValue(buf, value []byte) []byte {
+	for _, c := range value {
+		if c == 0x00 {
+			buf = append(buf, 0x00, 0xff)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, 0x00, 0x01)
+}
+
+// splitIndexEntry returns the key of the index entry after the prefix of the index.
+func splitIndexEntry(entry []byte) []byte {
+	for i := 0; i+1 < len(entry); i++ {
+		if entry[i] != 0x00 {
+			continue
+		}
+		if entry[i+1] == 0x01 {
+			return entry[i+2:]
+		}
+		i++
+	}
+	return nil
+}
+
+func encodeIndexPrefix(name string) []byte {
+	buf := make([]byte, 0, len(name)+2+binary.MaxVarintLen64)
+	buf = append(buf, dataKeyPrefix, indexEntryTag)
+	buf = binary.AppendUvarint(buf, uint64(len(name)))
+	return append(buf, name...)
+}
+
+// encodeIndexValuePrefix returns the prefix of the entries of the indexed value.
+func encodeIndexValuePrefix(name string, value []byte) []byte {
+	return escapeIndexValue(encodeIndexPrefix(name), value)
+}
+
+func encodeIndexEntry(name string, value, key []byte) []byte {
+	return append(encodeIndexValuePrefix(name, value), key...)
+}
+
+func encodeIndexMeta(name string) []byte {
+	buf := make([]byte, 0, len(name)+2)
+	buf = append(buf, dataKeyPrefix, indexMetaTag)
+	return append(buf, name...)
+}
+
+func isReservedKey(key []byte) bool {
+	return len(key) > 0 && key[0] == dataKeyPrefix
+}
+
+// putIndexRecord writes the index entry or meta to the pending writes of the batch, the caller must hold b.mu.
+func (b *Batch) putIndexRecord(key, value []byte, recordType LogRecordType, expire int64) {
+	record := b.lookupPendingWrites(key)
+	if record == nil {
+		record = b.db.recordPool.Get().(*LogRecord)
+		b.appendPendingWrites(key, record)
+	}
+	record.Key, record.Value = key, value
+	record.Type, record.Expire = recordType, expire
+}
+
+// markStaleIndexes marks the indexes which are built but not created since the database is opened as stale,
+// since they miss the writes of the batch, and they are rebuilt when they are created again.
+// The caller must hold b.mu.
+func (b *Batch) markStaleIndexes() error {
+	prefix := []byte{dataKeyPrefix, indexMetaTag}
+	var metas [][]byte
+	var positions []*wal.ChunkPosition
+	b.db.index.AscendGreaterOrEqual(prefix, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(key, prefix) {
+			return false, nil
+		}
+		if _, ok := b.db.secondaryIndexes[string(key[len(prefix):])]; !ok {
+			metas = append(metas, key)
+			positions = append(positions, pos)
+		}
+		return true, nil
+	})
+	for i, meta := range metas {
+		chunk, err := b.db.dataFiles.Read(positions[i])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(decodeLogRecord(chunk).Value, indexMetaStale) {
+			b.putIndexRecord(meta, indexMetaStale, LogRecordNormal, 0)
+		}
+	}
+	return nil
+}
+
+// updateSecondaryIndexes adds the changes of the index entries of the keys written by the batch,
+// the entries of the old values of the keys are deleted, and the entries of the new values are written.
+// The caller must hold b.mu.
+func (b *Batch) updateSecondaryIndexes(now int64) error {
+	writes := b.pendingWrites
+	plain := false
+	for _, record := range writes {
+		if !isReservedKey(record.Key) {
+			plain = true
+			break
+		}
+	}
+	if !plain {
+		return nil
+	}
+	if err := b.markStaleIndexes(); err != nil {
+		return err
+	}
+	if len(b.db.secondaryIndexes) == 0 {
+		return nil
+	}
+	for _, record := range writes {
+		if isReservedKey(record.Key) {
+			continue
+		}
+		var oldValue []byte
+		if position := b.db.index.Get(record.Key); position != nil {
+			chunk, err := b.db.dataFiles.Read(position)
+			if err != nil {
+				return err
+			}
+			oldValue = b.db.checkValue(chunk)
+		}
+		written := record.Type == LogRecordNormal && !record.IsExpired(now)
+		for _, idx := range b.db.secondaryIndexes {
+			if oldValue != nil {
+				for _, value := range idx.extractFn(record.Key, oldValue) {
+					b.putIndexRecord(encodeIndexEntry(idx.name, value, record.Key), nil, LogRecordDeleted, 0)
+				}
+			}
+			if written {
+				for _, value := range idx.extractFn(record.Key, record.Value) {
+					b.putIndexRecord(encodeIndexEntry(idx.name, value, record.Key), nil, LogRecordNormal, record.Expire)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CreateIndex creates the secondary index which indexes the key-value pairs by the values extracted by extractFn,
+// and keeps it updated by each commit since then.
+//
+// The index is not persisted with its function, so it must be created again each time the database is opened.
+// The existing data is indexed when the index is created for the first time,
+// or when the index is created again after the plain keys are written without it, which makes it stale.
+// Call DropIndex before CreateIndex to rebuild the index if extractFn is changed.
+func (db *DB) CreateIndex(name string, extractFn IndexFunc) error {
+	if name == "" {
+		return ErrKeyIsEmpty
+	}
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrDBClosed
+	}
+	if _, ok := db.secondaryIndexes[name]; ok {
+		db.mu.Unlock()
+		return ErrIndexExists
+	}
+	if db.secondaryIndexes == nil {
+		db.secondaryIndexes = make(map[string]*secondaryIndex)
+	}
+	idx := &secondaryIndex{name: name, extractFn: extractFn}
+	db.secondaryIndexes[name] = idx
+	db.mu.Unlock()
+
+	if err := db.backfillIndex(idx); err != nil {
+		db.mu.Lock()
+		delete(db.secondaryIndexes, name)
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// backfillIndex indexes the existing key-value pairs in batches unless it has been done and the index is not stale,
+// the pairs written by the other batches in the meantime are indexed by their commits.
+func (db *DB) backfillIndex(idx *secondaryIndex) error {
+	var built bool
+	err := db.view(func(batch *Batch) error {
+		meta, err := batch.getRecord(encodeIndexMeta(idx.name))
+		built = err == nil && !bytes.Equal(meta.Value, indexMetaStale)
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil || built {
+		return err
+	}
+	// the entries of the stale index, or the ones left by a DropIndex which did not finish.
+	if err = db.deleteIndexEntries(idx.name); err != nil {
+		return err
+	}
+
+	// the plain keys are after the reserved ones.
+	start := []byte{dataKeyPrefix + 1}
+	for start != nil {
+		err = db.update(func(batch *Batch) error {
+			var keys [][]byte
+			var positions []*wal.ChunkPosition
+			var next []byte
+			db.index.AscendGreaterOrEqual(start, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+				if len(keys) == backfillBatchSize {
+					next = bytes.Clone(key)
+					return false, nil
+				}
+				keys = append(keys, bytes.Clone(key))
+				positions = append(positions, pos)
+				return true, nil
+			})
+			start = next
+
+			now := time.Now().UnixNano()
+			for i, key := range keys {
+				chunk, err := db.dataFiles.Read(positions[i])
+				if err != nil {
+					return err
+				}
+				record := decodeLogRecord(chunk)
+				if record.Type == LogRecordDeleted || record.IsExpired(now) {
+					continue
+				}
+				for _, value := range idx.extractFn(key, record.Value) {
+					if err = batch.putRecord(encodeIndexEntry(idx.name, value, key), nil, record.Expire); err != nil {
+						return err
+					}
+				}
+			}
+			if start == nil {
+				return batch.putRecord(encodeIndexMeta(idx.name), nil, 0)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropIndex stops maintaining the secondary index, and deletes all its entries.
+// It also works for an index which is not created since the database is opened.
+func (db *DB) DropIndex(name string) error {
+	if name == "" {
+		return ErrKeyIsEmpty
+	}
+	db.mu.Lock()
+	delete(db.secondaryIndexes, name)
+	db.mu.Unlock()
+
+	// the meta is deleted first, so the index is never regarded as built without all its entries.
+	err := db.update(func(batch *Batch) error {
+		return batch.Delete(encodeIndexMeta(name))
+	})
+	if err != nil {
+		return err
+	}
+	return db.deleteIndexEntries(name)
+}
+
+// deleteIndexEntries deletes all the entries of the index in batches.
+func (db *DB) deleteIndexEntries(name string) error {
+	prefix := encodeIndexPrefix(name)
+	for {
+		var done bool
+		err := db.update(func(batch *Batch) error {
+			var entries [][]byte
+			db.index.AscendGreaterOrEqual(prefix, func(key []byte, _ *wal.ChunkPosition) (bool, error) {
+				if !bytes.HasPrefix(key, prefix) || len(entries) == backfillBatchSize {
+					return false, nil
+				}
+				entries = append(entries, bytes.Clone(key))
+				return true, nil
+			})
+			done = len(entries) < backfillBatchSize
+			for _, entry := range entries {
+				if err := batch.Delete(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// scanIndex returns the keys of the entries of the index in [start, end) in order.
+func (db *DB) scanIndex(name string, start, end []byte) ([][]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if _, ok := db.secondaryIndexes[name]; !ok {
+		return nil, ErrIndexNotFound
+	}
+
+	prefixLen := len(encodeIndexPrefix(name))
+	now := time.Now().UnixNano()
+	var keys [][]byte
+	var readErr error
+	db.index.AscendGreaterOrEqual(start, func(entry []byte, pos *wal.ChunkPosition) (bool, error) {
+		if bytes.Compare(entry, end) >= 0 {
+			return false, nil
+		}
+		chunk, err := db.dataFiles.Read(pos)
+		if err != nil {
+			readErr = err
+			return false, nil
+		}
+		if !decodeLogRecord(chunk).IsExpired(now) {
+			keys = append(keys, bytes.Clone(splitIndexEntry(entry[prefixLen:])))
+		}
+		return true, nil
+	})
+	return keys, readErr
+}
+
+// QueryIndex returns the keys indexed by the value in the secondary index in order,
+// ErrIndexNotFound is returned if the index is not created.
+func (db *DB) QueryIndex(name string, value []byte) ([][]byte, error) {
+	prefix := encodeIndexValuePrefix(name, value)
+	return db.scanIndex(name, prefix, prefixEnd(prefix))
+}
+
+// QueryIndexRange returns the keys indexed by the values in [start, end) in the secondary index,
+// in the order of the indexed values, then the keys. A nil end means the range is unbounded.
+func (db *DB) QueryIndexRange(name string, start, end []byte) ([][]byte, error) {
+	to := prefixEnd(encodeIndexPrefix(name))
+	if end != nil {
+		to = encodeIndexValuePrefix(name, end)
+	}
+	return db.scanIndex(name, encodeIndexValuePrefix(name, start), to)
+}
@@ -0,0 +1,157 @@
+package rosedb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// indexByStatus indexes the orders encoded as "status:amount" by the status.
+func indexByStatus(key, value []byte) [][]byte {
+	if !bytes.HasPrefix(key, []byte("order:")) {
+		return nil
+	}
+	status, _, _ := bytes.Cut(value, []byte(":"))
+	return [][]byte{status}
+}
+
+func TestEscapeIndexValue(t *testing.T) {
+	values := [][]byte{{}, {0x00}, {0x00, 0x00}, {0x00, 0x01}, {0x01}, []byte("a"), []byte("a\x00"), []byte("ab")}
+	for i, value := range values {
+		entry := append(escapeIndexValue(nil, value), "key"...)
+		assert.Equal(t, []byte("key"), splitIndexEntry(entry))
+		if i > 0 {
+			assert.Less(t, string(escapeIndexValue(nil, values[i-1])), string(escapeIndexValue(nil, value)))
+		}
+	}
+}
+
+func TestDB_SecondaryIndex(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// the existing data is backfilled when the index is created.
+	require.NoError(t, db.Put([]byte("order:1"), []byte("pending:10")))
+	require.NoError(t, db.Put([]byte("order:2"), []byte("paid:20")))
+	require.NoError(t, db.Put([]byte("user:1"), []byte("pending:0")))
+	require.NoError(t, db.CreateIndex("status", indexByStatus))
+	assert.Equal(t, ErrIndexExists, db.CreateIndex("status", indexByStatus))
+	_, err = db.QueryIndex("amount", []byte("10"))
+	assert.Equal(t, ErrIndexNotFound, err)
+
+	keys, err := db.QueryIndex("status", []byte("pending"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:1")}, keys)
+
+	// the index follows the puts and deletes, including the ones in a batch.
+	require.NoError(t, db.Put([]byte("order:3"), []byte("pending:30")))
+	require.NoError(t, db.Put([]byte("order:1"), []byte("paid:10")))
+	batch := db.NewBatch(DefaultBatchOptions)
+	require.NoError(t, batch.Put([]byte("order:4"), []byte("shipped:40")))
+	require.NoError(t, batch.Delete([]byte("order:2")))
+	require.NoError(t, batch.Commit())
+
+	keys, err = db.QueryIndex("status", []byte("pending"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:3")}, keys)
+	keys, err = db.QueryIndex("status", []byte("paid"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:1")}, keys)
+	keys, err = db.QueryIndexRange("status", []byte("p"), []byte("q"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:1"), []byte("order:3")}, keys)
+	keys, err = db.QueryIndexRange("status", []byte("pending"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:3"), []byte("order:4")}, keys)
+
+	// the entries expire with the keys.
+	require.NoError(t, db.PutWithTTL([]byte("order:5"), []byte("pending:50"), 50*time.Millisecond))
+	keys, err = db.QueryIndex("status", []byte("pending"))
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+	time.Sleep(100 * time.Millisecond)
+	keys, err = db.QueryIndex("status", []byte("pending"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:3")}, keys)
+
+	// the index is not backfilled again after a restart.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	calls := 0
+	require.NoError(t, db.CreateIndex("status", func(key, value []byte) [][]byte {
+		calls++
+		return indexByStatus(key, value)
+	}))
+	assert.Equal(t, 0, calls)
+	keys, err = db.QueryIndex("status", []byte("shipped"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:4")}, keys)
+
+	// the writes without the index make it stale, it is rebuilt when created again.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("order:5"), []byte("shipped:50")))
+	require.NoError(t, db.Put([]byte("order:4"), []byte("paid:40")))
+	calls = 0
+	require.NoError(t, db.CreateIndex("status", func(key, value []byte) [][]byte {
+		calls++
+		return indexByStatus(key, value)
+	}))
+	assert.Greater(t, calls, 0)
+	keys, err = db.QueryIndex("status", []byte("shipped"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:5")}, keys)
+	keys, err = db.QueryIndex("status", []byte("paid"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("order:1"), []byte("order:4")}, keys)
+	// the rebuilt index is not stale any more.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	calls = 0
+	require.NoError(t, db.CreateIndex("status", func(key, value []byte) [][]byte {
+		calls++
+		return indexByStatus(key, value)
+	}))
+	assert.Equal(t, 0, calls)
+
+	require.NoError(t, db.DropIndex("status"))
+	_, err = db.QueryIndex("status", []byte("shipped"))
+	assert.Equal(t, ErrIndexNotFound, err)
+	require.NoError(t, db.CreateIndex("status", indexByStatus))
+	keys, err = db.QueryIndexRange("status", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys, 4)
+}
+
+func TestDB_SecondaryIndexBackfill(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	n := backfillBatchSize*2 + 10
+	for i := 0; i < n; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("order:%05d", i)), []byte(fmt.Sprintf("s%d:%d", i%3, i))))
+	}
+	_, err = db.HSet([]byte("order:hash"), FieldValue{Field: []byte("f"), Value: []byte("s0:0")})
+	require.NoError(t, err)
+	require.NoError(t, db.CreateIndex("status", indexByStatus))
+
+	keys, err := db.QueryIndex("status", []byte("s0"))
+	require.NoError(t, err)
+	assert.Len(t, keys, (n+2)/3)
+	keys, err = db.QueryIndexRange("status", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys, n)
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// dataCommand is a command which reads or writes the keys,
+// it is executed in a batch, so a transaction (MULTI/EXEC) can run all the commands in one batch.
+type dataCommand struct {
+	// arity is the number of the arguments including the command name,
+	// a negative arity means at least -arity arguments.
+	arity int
+	// write is true if the command writes the keys, which needs a write batch.
+	write bool
+	fn    func(b *rosedb.Batch, args [][]byte) any
+}
+
+var dataCommands = map[string]*dataCommand{
+	"get":     {arity: 2, fn: getCommand},
+	"set":     {arity: -3, write: true, fn: setCommand},
+	"del":     {arity: -2, write: true, fn: delCommand},
+	"exists":  {arity: -2, fn: existsCommand},
+	"expire":  {arity: 3, write: true, fn: expireCommand},
+	"pexpire": {arity: 3, write: true, fn: pexpireCommand},
+	"ttl":     {arity: 2, fn: ttlCommand},
+	"pttl":    {arity: 2, fn: pttlCommand},
+	"persist": {arity: 2, write: true, fn: persistCommand},
+}
+
+func checkArity(name string, arity int, args [][]byte) errorReply {
+	if (arity > 0 && len(args) != arity) || (arity < 0 && len(args) < -arity) {
+		return errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+	return ""
+}
+
+// errReply converts an error of the database to an error reply.
+func errReply(err error) errorReply {
+	return errorReply("ERR " + err.Error())
+}
+
+var (
+	errSyntax     = errorReply("ERR syntax error")
+	errNotInteger = errorReply("ERR value is not an integer or out of range")
+)
+
+func parseInt(b []byte) (int64, bool) {
+	v, err := strconv.ParseInt(string(b), 10, 64)
+	return v, err == nil
+}
+
+func getCommand(b *rosedb.Batch, args [][]byte) any {
+	value, err := b.Get(args[1])
+	if err != nil {
+		if errors.Is(err, rosedb.ErrKeyNotFound) {
+			return nil
+		}
+		return errReply(err)
+	}
+	return value
+}
+
+// SET key value [NX | XX] [EX seconds | PX milliseconds]
+func setCommand(b *rosedb.Batch, args [][]byte) any {
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if ttl != 0 || i+1 >= len(args) {
+				return errSyntax
+			}
+			v, ok := parseInt(args[i+1])
+			if !ok {
+				return errNotInteger
+			}
+			if v <= 0 {
+				return errorReply("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if args[i][0] == 'p' || args[i][0] == 'P' {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(v) * unit
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+
+	if nx || xx {
+		exist, err := b.Exist(args[1])
+		if err != nil {
+			return errReply(err)
+		}
+		if (nx && exist) || (xx && !exist) {
+			return nil
+		}
+	}
+
+	var err error
+	if ttl > 0 {
+		err = b.PutWithTTL(args[1], args[2], ttl)
+	} else {
+		err = b.Put(args[1], args[2])
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	return replyOK
+}
+
+func delCommand(b *rosedb.Batch, args [][]byte) any {
+	var count int64
+	for _, key := range args[1:] {
+		exist, err := b.Exist(key)
+		if err != nil {
+			return errReply(err)
+		}
+		if !exist {
+			continue
+		}
+		if err = b.Delete(key); err != nil {
+			return errReply(err)
+		}
+		count++
+	}
+	return count
+}
+
+func existsCommand(b *rosedb.Batch, args [][]byte) any {
+	var count int64
+	for _, key := range args[1:] {
+		exist, err := b.Exist(key)
+		if err != nil {
+			return errReply(err)
+		}
+		if exist {
+			count++
+		}
+	}
+	return count
+}
+
+func expireCommand(b *rosedb.Batch, args [][]byte) any {
+	return expireGeneric(b, args, time.Second)
+}
+
+func pexpireCommand(b *rosedb.Batch, args [][]byte) any {
+	return expireGeneric(b, args, time.Millisecond)
+}
+
+func expireGeneric(b *rosedb.Batch, args [][]byte, unit time.Duration) any {
+	v, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	exist, err := b.Exist(args[1])
+	if err != nil {
+		return errReply(err)
+	}
+	if !exist {
+		return int64(0)
+	}
+	// a non-positive ttl deletes the key, the same as redis.
+	if v <= 0 {
+		err = b.Delete(args[1])
+	} else {
+		err = b.Expire(args[1], time.Duration(v)*unit)
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	return int64(1)
+}
+
+func ttlCommand(b *rosedb.Batch, args [][]byte) any {
+	return ttlGeneric(b, args, time.Second)
+}
+
+func pttlCommand(b *rosedb.Batch, args [][]byte) any {
+	return ttlGeneric(b, args, time.Millisecond)
+}
+
+// ttlGeneric returns -2 if the key does not exist, -1 if the key has no ttl.
+func ttlGeneric(b *rosedb.Batch, args [][]byte, unit time.Duration) any {
+	ttl, err := b.TTL(args[1])
+	if err != nil {
+		if errors.Is(err, rosedb.ErrKeyNotFound) {
+			return int64(-2)
+		}
+		return errReply(err)
+	}
+	if ttl < 0 {
+		return int64(-1)
+	}
+	return int64((ttl + unit/2) / unit)
+}
+
+func persistCommand(b *rosedb.Batch, args [][]byte) any {
+	ttl, err := b.TTL(args[1])
+	if err != nil {
+		if errors.Is(err, rosedb.ErrKeyNotFound) {
+			return int64(0)
+		}
+		return errReply(err)
+	}
+	if ttl < 0 {
+		return int64(0)
+	}
+	if err = b.Persist(args[1]); err != nil {
+		return errReply(err)
+	}
+	return int64(1)
+}
+
+// scanCommand implements SCAN cursor [MATCH pattern] [COUNT count].
+//
+// The cursor is the hex encoded key to resume from, or 0 at the start and the end of the iteration,
+// no key is encoded to 0 since the hex encoding has an even length.
+// So each call only visits the keys after the cursor, and the keys written during the iteration
+// may be returned or not, which is also allowed by the redis SCAN command.
+func scanCommand(db *rosedb.DB, args [][]byte) any {
+	var start []byte
+	if string(args[1]) != "0" {
+		var err error
+		if start, err = hex.DecodeString(string(args[1])); err != nil || len(start) == 0 {
+			return errorReply("ERR invalid cursor")
+		}
+	}
+	count := int64(10)
+	var reg *regexp.Regexp
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			var err error
+			if reg, err = regexp.Compile(string(globToRegexp(args[i+1]))); err != nil {
+				return errReply(err)
+			}
+		case "count":
+			var ok bool
+			if count, ok = parseInt(args[i+1]); !ok {
+				return errNotInteger
+			}
+			if count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	var keys []any
+	var next []byte
+	db.AscendGreaterOrEqual(start, func(k, _ []byte) (bool, error) {
+		if reg != nil && !reg.Match(k) {
+			return true, nil
+		}
+		if int64(len(keys)) == count {
+			next = bytes.Clone(k)
+			return false, nil
+		}
+		keys = append(keys, bytes.Clone(k))
+		return true, nil
+	})
+	if keys == nil {
+		keys = []any{}
+	}
+	cursor := []byte("0")
+	if next != nil {
+		cursor = []byte(hex.EncodeToString(next))
+	}
+	return []any{cursor, keys}
+}
+
+// globToRegexp converts a redis glob-style pattern to a regular expression.
+func globToRegexp(pattern []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			buf.WriteString("(?s:.*)")
+		case '?':
+			buf.WriteString("(?s:.)")
+		case '[':
+			end := bytes.IndexByte(pattern[i+1:], ']')
+			if end <= 0 {
+				buf.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			buf.WriteByte('[')
+			if len(class) > 0 && class[0] == '^' {
+				buf.WriteByte('^')
+				class = class[1:]
+			}
+			for _, cc := range class {
+				if cc == '\\' || cc == '[' || cc == ']' || cc == '^' {
+					buf.WriteByte('\\')
+				}
+				buf.WriteByte(cc)
+			}
+			buf.WriteByte(']')
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			buf.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteByte('$')
+	return buf.Bytes()
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// messageQueueSize is the max number of the pub/sub messages waiting to be sent to a connection,
+// the oldest messages will be dropped if the client is too slow to receive them.
+const messageQueueSize = 1024
+
+// conn is a client connection of the server.
+type conn struct {
+	server  *Server
+	netConn net.Conn
+	reader  *respReader
+
+	// mu protects the writer, the replies and the pub/sub messages are written by different goroutines.
+	mu     sync.Mutex
+	writer *respWriter
+
+	// the states of the transaction.
+	inMulti bool
+	queued  [][][]byte
+	txAbort bool // an error occurs when queuing the commands, EXEC will fail
+
+	// the keys subscribed by the connection, it is only changed by the serving goroutine with mu held,
+	// and the events of the database subscription are sent if their keys are subscribed.
+	subscriptions map[string]struct{}
+	sub           *rosedb.Subscription
+
+	closing atomic.Bool
+}
+
+func newConn(s *Server, netConn net.Conn) *conn {
+	return &conn{
+		server:  s,
+		netConn: netConn,
+		reader:  newRespReader(netConn),
+		writer:  newRespWriter(netConn),
+	}
+}
+
+// serve reads the requests and writes the replies until the connection is closed.
+// The replies of the pipelined requests are flushed together.
+func (c *conn) serve() {
+	defer c.close()
+
+	for !c.closing.Load() {
+		args, err := c.reader.readCommand()
+		if err != nil {
+			if err == errProtocol {
+				c.mu.Lock()
+				c.writer.writeReply(errorReply("ERR Protocol error"))
+				_ = c.writer.flush()
+				c.mu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		reply, quit := c.handle(args)
+		c.mu.Lock()
+		c.writer.writeReply(reply)
+		var flushErr error
+		if c.reader.buffered() == 0 || quit {
+			flushErr = c.writer.flush()
+		}
+		c.mu.Unlock()
+		if flushErr != nil || quit {
+			return
+		}
+	}
+}
+
+// shutdown closes the connection after the executing command is finished.
+func (c *conn) shutdown() {
+	c.closing.Store(true)
+	// wake up the connection which is waiting for requests.
+	_ = c.netConn.SetReadDeadline(time.Now())
+}
+
+func (c *conn) close() {
+	if c.sub != nil {
+		_ = c.sub.Close()
+	}
+	c.mu.Lock()
+	_ = c.writer.flush()
+	c.mu.Unlock()
+	_ = c.netConn.Close()
+	c.server.trackConn(c, false)
+}
+
+// handle executes a command, and returns the reply and whether the connection should be closed.
+func (c *conn) handle(args [][]byte) (any, bool) {
+	name := strings.ToLower(string(args[0]))
+
+	// only the pub/sub commands are allowed in the subscribed state of RESP2.
+	if len(c.subscriptions) > 0 && c.writer.proto < 3 {
+		switch name {
+		case "subscribe", "unsubscribe", "ping", "quit":
+		default:
+			return errorf("ERR Can't execute '%s': only (UN)SUBSCRIBE / PING / QUIT are allowed in this context", name), false
+		}
+	}
+
+	if c.inMulti {
+		switch name {
+		case "exec", "discard", "multi", "quit":
+		default:
+			return c.queue(name, args), false
+		}
+	}
+
+	if cmd, ok := dataCommands[name]; ok {
+		if errReply := checkArity(name, cmd.arity, args); errReply != "" {
+			return errReply, false
+		}
+		return c.execData(cmd, args), false
+	}
+
+	switch name {
+	case "ping":
+		return c.ping(args), false
+	case "echo":
+		if errReply := checkArity(name, 2, args); errReply != "" {
+			return errReply, false
+		}
+		return args[1], false
+	case "quit":
+		return replyOK, true
+	case "hello":
+		return c.hello(args), false
+	case "select":
+		if errReply := checkArity(name, 2, args); errReply != "" {
+			return errReply, false
+		}
+		if string(args[1]) != "0" {
+			return errorReply("ERR DB index is out of range"), false
+		}
+		return replyOK, false
+	case "client":
+		// the clients may set the connection name or the library info when connecting.
+		return replyOK, false
+	case "command":
+		return []any{}, false
+	case "scan":
+		if errReply := checkArity(name, -2, args); errReply != "" {
+			return errReply, false
+		}
+		return scanCommand(c.server.db, args), false
+	case "multi":
+		if c.inMulti {
+			return errorReply("ERR MULTI calls can not be nested"), false
+		}
+		c.inMulti = true
+		return replyOK, false
+	case "exec":
+		return c.exec(), false
+	case "discard":
+		if !c.inMulti {
+			return errorReply("ERR DISCARD without MULTI"), false
+		}
+		c.resetMulti()
+		return replyOK, false
+	case "subscribe":
+		if errReply := checkArity(name, -2, args); errReply != "" {
+			return errReply, false
+		}
+		return c.subscribe(args[1:]), false
+	case "unsubscribe":
+		return c.unsubscribe(args[1:]), false
+	default:
+		return errorf("ERR unknown command '%s'", name), false
+	}
+}
+
+// execData executes a data command in a batch.
+func (c *conn) execData(cmd *dataCommand, args [][]byte) any {
+	batch := c.server.db.NewBatch(rosedb.BatchOptions{ReadOnly: !cmd.write})
+	reply := cmd.fn(batch, args)
+	if _, ok := reply.(errorReply); ok {
+		_ = batch.Rollback()
+		return reply
+	}
+	if err := batch.Commit(); err != nil {
+		return errReply(err)
+	}
+	return reply
+}
+
+func (c *conn) ping(args [][]byte) any {
+	if len(args) > 2 {
+		return errorReply("ERR wrong number of arguments for 'ping' command")
+	}
+	// in the subscribed state of RESP2, the reply of PING is an array.
+	if len(c.subscriptions) > 0 && c.writer.proto < 3 {
+		var payload []byte
+		if len(args) == 2 {
+			payload = args[1]
+		}
+		return []any{[]byte("pong"), payload}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return simpleString("PONG")
+}
+
+// hello switches the protocol version, HELLO [protover [AUTH username password] [SETNAME clientname]].
+func (c *conn) hello(args [][]byte) any {
+	proto := c.writer.proto
+	if len(args) > 1 {
+		v, ok := parseInt(args[1])
+		if !ok {
+			return errorReply("ERR Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 {
+			return errorReply("NOPROTO unsupported protocol version")
+		}
+		proto = int(v)
+	}
+	c.mu.Lock()
+	c.writer.proto = proto
+	c.mu.Unlock()
+
+	return mapReply{
+		"server", "rosedb",
+		"version", "2",
+		"proto", int64(proto),
+		"id", int64(0),
+		"mode", "standalone",
+		"role", "master",
+		"modules", []any{},
+	}
+}
+
+// queue adds a command to the transaction.
+func (c *conn) queue(name string, args [][]byte) any {
+	cmd, ok := dataCommands[name]
+	if !ok {
+		c.txAbort = true
+		if name == "scan" || name == "subscribe" || name == "unsubscribe" {
+			return errorf("ERR Command '%s' is not allowed in MULTI", name)
+		}
+		return errorf("ERR unknown command '%s'", name)
+	}
+	if errReply := checkArity(name, cmd.arity, args); errReply != "" {
+		c.txAbort = true
+		return errReply
+	}
+	c.queued = append(c.queued, args)
+	return replyQueued
+}
+
+// exec executes all the queued commands in one batch, so they are atomic.
+func (c *conn) exec() any {
+	if !c.inMulti {
+		return errorReply("ERR EXEC without MULTI")
+	}
+	defer c.resetMulti()
+	if c.txAbort {
+		return errorReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	var write bool
+	for _, args := range c.queued {
+		write = write || dataCommands[strings.ToLower(string(args[0]))].write
+	}
+	batch := c.server.db.NewBatch(rosedb.BatchOptions{ReadOnly: !write})
+	replies := make([]any, len(c.queued))
+	for i, args := range c.queued {
+		replies[i] = dataCommands[strings.ToLower(string(args[0]))].fn(batch, args)
+	}
+	if err := batch.Commit(); err != nil {
+		return errReply(err)
+	}
+	return replies
+}
+
+func (c *conn) resetMulti() {
+	c.inMulti = false
+	c.queued = nil
+	c.txAbort = false
+}
+
+// subscribe subscribes the keys, the replies are sent directly,
+// and the returned reply is the reply of the last key.
+func (c *conn) subscribe(keys [][]byte) any {
+	if c.sub == nil {
+		sub, err := c.server.db.Subscribe(rosedb.SubscribeOptions{
+			Actions:    []rosedb.WatchActionType{rosedb.WatchActionPut, rosedb.WatchActionDelete},
+			BufferSize: messageQueueSize,
+		})
+		if err != nil {
+			return errReply(err)
+		}
+		c.sub = sub
+		go c.sendMessages()
+	}
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[string]struct{})
+	}
+	return c.subscriptionReplies("subscribe", keys, func(channel string) {
+		c.subscriptions[channel] = struct{}{}
+	})
+}
+
+// unsubscribe unsubscribes the keys, or all the subscribed keys if no key is specified.
+func (c *conn) unsubscribe(keys [][]byte) any {
+	if len(keys) == 0 {
+		for _, channel := range c.subscribedKeys() {
+			keys = append(keys, []byte(channel))
+		}
+		if len(keys) == 0 {
+			return pushReply{[]byte("unsubscribe"), nil, int64(0)}
+		}
+	}
+	return c.subscriptionReplies("unsubscribe", keys, func(channel string) {
+		delete(c.subscriptions, channel)
+	})
+}
+
+// subscriptionReplies writes a reply for each key except the last one, whose reply is returned.
+func (c *conn) subscriptionReplies(kind string, keys [][]byte, update func(channel string)) any {
+	var reply any
+	for i, key := range keys {
+		c.mu.Lock()
+		update(string(key))
+		c.mu.Unlock()
+		reply = pushReply{[]byte(kind), key, int64(len(c.subscriptions))}
+		if i < len(keys)-1 {
+			c.mu.Lock()
+			c.writer.writeReply(reply)
+			c.mu.Unlock()
+		}
+	}
+	return reply
+}
+
+func (c *conn) subscribedKeys() []string {
+	keys := make([]string, 0, len(c.subscriptions))
+	for key := range c.subscriptions {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// sendMessages writes the events of the subscribed keys to the client,
+// until the subscription is closed with the connection or the database.
+func (c *conn) sendMessages() {
+	for event := range c.sub.Events() {
+		payload := "set"
+		if event.Action == rosedb.WatchActionDelete {
+			payload = "del"
+		}
+		c.mu.Lock()
+		if _, ok := c.subscriptions[string(event.Key)]; !ok {
+			c.mu.Unlock()
+			continue
+		}
+		c.writer.writeReply(pushReply{[]byte("message"), event.Key, []byte(payload)})
+		err := c.writer.flush()
+		c.mu.Unlock()
+		if err != nil {
+			_ = c.netConn.Close()
+			return
+		}
+	}
+}
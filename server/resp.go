@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkSize is the max size of a bulk string in a request.
+	maxBulkSize = 512 << 20
+	// maxArrayLen is the max number of arguments in a request.
+	maxArrayLen = 1 << 20
+	// maxInlineSize is the max size of an inline request.
+	maxInlineSize = 64 << 10
+	// readChunkSize is the max size allocated at a time while reading a request,
+	// so the memory grows with the received bytes rather than the sizes claimed by the client.
+	readChunkSize = 64 << 10
+)
+
+var errProtocol = errors.New("protocol error")
+
+// the types of the replies, which are encoded by respWriter.
+// []byte is a bulk string, int64 (or int) is an integer, nil is a null reply,
+// []any is an array, and the others are defined below.
+type (
+	// simpleString is a simple string reply, like +OK.
+	simpleString string
+	// errorReply is an error reply, the message should start with an error code, like ERR.
+	errorReply string
+	// mapReply is a map reply in RESP3, or a flat array in RESP2, the elements are key/value pairs.
+	mapReply []any
+	// pushReply is a push reply in RESP3, or an array in RESP2, used by the pub/sub messages.
+	pushReply []any
+)
+
+var (
+	replyOK     = simpleString("OK")
+	replyQueued = simpleString("QUEUED")
+)
+
+func errorf(format string, args ...any) errorReply {
+	return errorReply(fmt.Sprintf(format, args...))
+}
+
+// respReader reads the requests from the client,
+// both the multi bulk requests (array of bulk strings) and the inline requests are supported.
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRespReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+// buffered returns the number of bytes which have been received but not read,
+// it is used to flush the replies after all the pipelined requests are handled.
+func (r *respReader) buffered() int {
+	return r.r.Buffered()
+}
+
+// readCommand reads a request, returns the command name and the arguments.
+// An empty request (an empty inline line) returns nil args.
+func (r *respReader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArrayLen {
+		return nil, errProtocol
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, 0, min(n, readChunkSize/8))
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (r *respReader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+	size, err := strconv.Atoi(string(line[1:]))
+	if err != nil || size < 0 || size > maxBulkSize {
+		return nil, errProtocol
+	}
+	buf := make([]byte, 0, min(size+2, readChunkSize))
+	for len(buf) < size+2 {
+		n := min(size+2-len(buf), readChunkSize)
+		buf = append(buf, make([]byte, n)...)
+		if _, err = io.ReadFull(r.r, buf[len(buf)-n:]); err != nil {
+			return nil, err
+		}
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, errProtocol
+	}
+	return buf[:size], nil
+}
+
+// readLine reads a line, the trailing \r\n (or \n) is removed.
+func (r *respReader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if !isPrefix {
+			return line, nil
+		}
+		if len(line) > maxInlineSize {
+			return nil, errProtocol
+		}
+	}
+}
+
+// respWriter writes the replies to the client in RESP2 or RESP3.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newRespWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *respWriter) flush() error {
+	return w.w.Flush()
+}
+
+func (w *respWriter) writeReply(reply any) {
+	switch v := reply.(type) {
+	case nil:
+		if w.proto >= 3 {
+			_, _ = w.w.WriteString("_\r\n")
+		} else {
+			_, _ = w.w.WriteString("$-1\r\n")
+		}
+	case simpleString:
+		w.writeLine('+', string(v))
+	case errorReply:
+		w.writeLine('-', string(v))
+	case int:
+		w.writeLine(':', strconv.Itoa(v))
+	case int64:
+		w.writeLine(':', strconv.FormatInt(v, 10))
+	case string:
+		w.writeBulk([]byte(v))
+	case []byte:
+		w.writeBulk(v)
+	case []any:
+		w.writeArray('*', v)
+	case mapReply:
+		if w.proto >= 3 {
+			w.writeLine('%', strconv.Itoa(len(v)/2))
+			for _, elem := range v {
+				w.writeReply(elem)
+			}
+		} else {
+			w.writeArray('*', v)
+		}
+	case pushReply:
+		if w.proto >= 3 {
+			w.writeArray('>', v)
+		} else {
+			w.writeArray('*', v)
+		}
+	default:
+		panic(fmt.Sprintf("server: unknown reply type %T", reply))
+	}
+}
+
+func (w *respWriter) writeLine(prefix byte, s string) {
+	_ = w.w.WriteByte(prefix)
+	_, _ = w.w.WriteString(s)
+	_, _ = w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeBulk(b []byte) {
+	w.writeLine('$', strconv.Itoa(len(b)))
+	_, _ = w.w.Write(b)
+	_, _ = w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeArray(prefix byte, elems []any) {
+	w.writeLine(prefix, strconv.Itoa(len(elems)))
+	for _, elem := range elems {
+		w.writeReply(elem)
+	}
+}
@@ -0,0 +1,169 @@
+// Package server implements a server speaking the redis protocol (RESP2 and RESP3) on top of rosedb,
+// so the database can be accessed by the existing redis clients.
+//
+// The supported commands are:
+//
+//	GET, SET (with EX/PX/NX/XX), DEL, EXISTS, EXPIRE, PEXPIRE, TTL, PTTL, PERSIST, SCAN,
+//	MULTI, EXEC, DISCARD, SUBSCRIBE, UNSUBSCRIBE,
+//	PING, ECHO, HELLO, SELECT (only db 0), CLIENT, COMMAND and QUIT.
+//
+// SUBSCRIBE uses the key as the channel, a message is published to the channel
+// when the key is put ("set") or deleted ("del"), each subscribed connection has its own DB.Subscribe,
+// so the watch of the database is not required, and is left to the application.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown or Close is called.
+var ErrServerClosed = errors.New("server: server closed")
+
+// shutdownPollInterval is how often Shutdown checks whether all the connections are closed.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Server serves the redis protocol requests on top of a database.
+type Server struct {
+	db *rosedb.DB
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	conns      map[*conn]struct{}
+	inShutdown atomic.Bool
+}
+
+// New creates a server on top of the database.
+// The database is not closed by the server, the caller should close it after Shutdown.
+func New(db *rosedb.DB) *Server {
+	return &Server{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr, and then calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.inShutdown.Load() {
+		return ErrServerClosed
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts the connections on the listener, and serves each connection in a new goroutine.
+// It always returns a non-nil error, and ErrServerClosed after Shutdown or Close is called.
+func (s *Server) Serve(listener net.Listener) error {
+	if !s.trackListener(listener, true) {
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(listener, false)
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if s.inShutdown.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		c := newConn(s, netConn)
+		if !s.trackConn(c, true) {
+			_ = netConn.Close()
+			return ErrServerClosed
+		}
+		go c.serve()
+	}
+}
+
+// Shutdown gracefully shuts down the server without interrupting the executing commands.
+// It closes all the listeners, then waits for the connections to finish the executing commands and close.
+//
+// If ctx is done before all the connections are closed, the remaining connections are closed,
+// and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	s.closeListenersLocked()
+	for c := range s.conns {
+		c.shutdown()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		n := len(s.conns)
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all the listeners and connections.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeListenersLocked()
+	for c := range s.conns {
+		_ = c.netConn.Close()
+	}
+	return nil
+}
+
+func (s *Server) closeListenersLocked() {
+	for listener := range s.listeners {
+		_ = listener.Close()
+		delete(s.listeners, listener)
+	}
+}
+
+func (s *Server) trackListener(listener net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.inShutdown.Load() {
+			return false
+		}
+		s.listeners[listener] = struct{}{}
+	} else {
+		delete(s.listeners, listener)
+	}
+	return true
+}
+
+func (s *Server) trackConn(c *conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.inShutdown.Load() {
+			return false
+		}
+		s.conns[c] = struct{}{}
+	} else {
+		delete(s.conns, c)
+	}
+	return true
+}
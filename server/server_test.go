@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a minimal RESP client, the replies are decoded to
+// string (simple string and bulk string), int64, nil, error and []any.
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type testError string
+
+func (e testError) Error() string { return string(e) }
+
+func newTestServer(t *testing.T) (*Server, string, func()) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := New(db)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(listener)
+	}()
+
+	return s, listener.Addr().String(), func() {
+		assert.NoError(t, s.Shutdown(context.Background()))
+		assert.Equal(t, ErrServerClosed, <-serveErr)
+		assert.NoError(t, db.Close())
+	}
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(args ...string) {
+	buf := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		buf += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, _ = c.conn.Write([]byte(buf))
+}
+
+func (c *testClient) do(args ...string) any {
+	c.send(args...)
+	return c.read()
+}
+
+func (c *testClient) read() any {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return testError(line[1:])
+	case ':':
+		v, _ := strconv.ParseInt(line[1:], 10, 64)
+		return v
+	case '_':
+		return nil
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return nil
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(c.reader, buf); err != nil {
+			return err
+		}
+		return string(buf[:size])
+	case '*', '%', '>':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		elems := make([]any, n)
+		for i := range elems {
+			elems[i] = c.read()
+		}
+		return elems
+	default:
+		return testError("unknown reply " + line)
+	}
+}
+
+func TestServer_Basic(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	assert.Equal(t, "PONG", c.do("PING"))
+	assert.Equal(t, "hello", c.do("ECHO", "hello"))
+	assert.Equal(t, "OK", c.do("SET", "name", "rosedb"))
+	assert.Equal(t, "rosedb", c.do("GET", "name"))
+	assert.Nil(t, c.do("GET", "missing"))
+	assert.Equal(t, int64(1), c.do("EXISTS", "name", "missing"))
+	assert.Equal(t, int64(1), c.do("DEL", "name", "missing"))
+	assert.Nil(t, c.do("GET", "name"))
+
+	assert.Equal(t, testError("ERR wrong number of arguments for 'get' command"), c.do("GET"))
+	assert.Equal(t, testError("ERR unknown command 'foo'"), c.do("FOO"))
+	assert.Equal(t, testError("ERR syntax error"), c.do("SET", "k", "v", "NX", "XX"))
+
+	// inline command.
+	_, _ = c.conn.Write([]byte("SET inline value\r\n"))
+	assert.Equal(t, "OK", c.read())
+	assert.Equal(t, "value", c.do("GET", "inline"))
+	assert.Equal(t, "OK", c.do("QUIT"))
+}
+
+func TestServer_SetOptions(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	assert.Nil(t, c.do("SET", "k", "v", "XX"))
+	assert.Equal(t, "OK", c.do("SET", "k", "v1", "NX"))
+	assert.Nil(t, c.do("SET", "k", "v2", "NX"))
+	assert.Equal(t, "OK", c.do("SET", "k", "v3", "XX"))
+	assert.Equal(t, "v3", c.do("GET", "k"))
+	assert.Equal(t, int64(-1), c.do("TTL", "k"))
+	assert.Equal(t, int64(-2), c.do("TTL", "missing"))
+
+	assert.Equal(t, "OK", c.do("SET", "k", "v4", "EX", "100"))
+	assert.Equal(t, int64(100), c.do("TTL", "k"))
+	assert.Equal(t, int64(1), c.do("PERSIST", "k"))
+	assert.Equal(t, int64(0), c.do("PERSIST", "k"))
+	assert.Equal(t, int64(-1), c.do("TTL", "k"))
+
+	assert.Equal(t, int64(1), c.do("EXPIRE", "k", "50"))
+	assert.Equal(t, int64(50), c.do("TTL", "k"))
+	assert.Equal(t, int64(0), c.do("EXPIRE", "missing", "50"))
+
+	assert.Equal(t, "OK", c.do("SET", "short", "v", "PX", "50"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, c.do("GET", "short"))
+	assert.Equal(t, int64(0), c.do("EXISTS", "short"))
+}
+
+func TestServer_Scan(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	for i := 0; i < 25; i++ {
+		assert.Equal(t, "OK", c.do("SET", fmt.Sprintf("user:%02d", i), "v"))
+	}
+	assert.Equal(t, "OK", c.do("SET", "other", "v"))
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "10").([]any)
+		cursor = reply[0].(string)
+		for _, key := range reply[1].([]any) {
+			keys = append(keys, key.(string))
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 25, len(keys))
+	assert.Equal(t, "user:00", keys[0])
+	assert.Equal(t, "user:24", keys[24])
+
+	reply := c.do("SCAN", "0", "MATCH", "user:1?").([]any)
+	assert.Equal(t, 10, len(reply[1].([]any)))
+
+	// the cursor resumes from a key, the keys deleted before it do not shift the iteration.
+	reply = c.do("SCAN", "0", "COUNT", "5").([]any)
+	cursor = reply[0].(string)
+	assert.Equal(t, int64(1), c.do("DEL", "other"))
+	reply = c.do("SCAN", cursor, "COUNT", "1").([]any)
+	assert.Equal(t, []any{"user:04"}, reply[1])
+	assert.IsType(t, testError(""), c.do("SCAN", "abc"))
+}
+
+func TestServer_Multi(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "a", "1"))
+	assert.Equal(t, "QUEUED", c.do("SET", "b", "2"))
+	assert.Equal(t, "QUEUED", c.do("GET", "a"))
+	assert.Equal(t, "QUEUED", c.do("DEL", "b"))
+	assert.Equal(t, []any{"OK", "OK", "1", int64(1)}, c.do("EXEC"))
+	assert.Equal(t, "1", c.do("GET", "a"))
+	assert.Nil(t, c.do("GET", "b"))
+
+	// an error when queuing discards the transaction.
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "a", "2"))
+	assert.IsType(t, testError(""), c.do("SCAN", "0"))
+	assert.IsType(t, testError(""), c.do("EXEC"))
+	assert.Equal(t, "1", c.do("GET", "a"))
+
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "a", "3"))
+	assert.Equal(t, "OK", c.do("DISCARD"))
+	assert.Equal(t, "1", c.do("GET", "a"))
+	assert.IsType(t, testError(""), c.do("EXEC"))
+}
+
+func TestServer_Pipeline(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	var buf string
+	for i := 0; i < 100; i++ {
+		buf += fmt.Sprintf("*3\r\n$3\r\nSET\r\n$%d\r\nkey-%d\r\n$1\r\nv\r\n", len(fmt.Sprintf("key-%d", i)), i)
+	}
+	buf += "*2\r\n$6\r\nEXISTS\r\n$5\r\nkey-0\r\n"
+	_, err := c.conn.Write([]byte(buf))
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "OK", c.read())
+	}
+	assert.Equal(t, int64(1), c.read())
+}
+
+func TestRespReader_Bulk(t *testing.T) {
+	value := strings.Repeat("v", readChunkSize*2+10)
+	r := newRespReader(strings.NewReader(fmt.Sprintf("*2\r\n$3\r\nGET\r\n$%d\r\n%s\r\n", len(value), value)))
+	args, err := r.readCommand()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("GET"), []byte(value)}, args)
+
+	// the size claimed by the client is not allocated before the bytes are received.
+	r = newRespReader(strings.NewReader(fmt.Sprintf("*%d\r\n$%d\r\nabc", maxArrayLen, maxBulkSize)))
+	_, err = r.readCommand()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestServer_RESP3(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	c := dial(t, addr)
+
+	hello := c.do("HELLO", "3").([]any)
+	assert.Equal(t, "proto", hello[4])
+	assert.Equal(t, int64(3), hello[5])
+
+	// the null reply of RESP3.
+	c.send("GET", "missing")
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "_\r\n", line)
+	assert.IsType(t, testError(""), c.do("HELLO", "4"))
+}
+
+func TestServer_Subscribe(t *testing.T) {
+	_, addr, shutdown := newTestServer(t)
+	defer shutdown()
+	sub := dial(t, addr)
+	c := dial(t, addr)
+
+	assert.Equal(t, []any{"subscribe", "k1", int64(1)}, sub.do("SUBSCRIBE", "k1", "k2"))
+	assert.Equal(t, []any{"subscribe", "k2", int64(2)}, sub.read())
+	assert.IsType(t, testError(""), sub.do("GET", "k1"))
+
+	assert.Equal(t, "OK", c.do("SET", "k1", "v"))
+	assert.Equal(t, "OK", c.do("SET", "k3", "v"))
+	assert.Equal(t, []any{"message", "k1", "set"}, sub.read())
+
+	assert.Equal(t, []any{"unsubscribe", "k1", int64(1)}, sub.do("UNSUBSCRIBE", "k1"))
+	assert.Equal(t, "OK", c.do("SET", "k2", "v"))
+	assert.Equal(t, int64(1), c.do("DEL", "k1"))
+	assert.Equal(t, int64(1), c.do("DEL", "k2"))
+	assert.Equal(t, []any{"message", "k2", "set"}, sub.read())
+	assert.Equal(t, []any{"message", "k2", "del"}, sub.read())
+
+	// each connection has its own subscription, so both subscribers receive the message.
+	sub2 := dial(t, addr)
+	assert.Equal(t, []any{"subscribe", "k2", int64(1)}, sub2.do("SUBSCRIBE", "k2"))
+	assert.Equal(t, "OK", c.do("SET", "k2", "v"))
+	assert.Equal(t, []any{"message", "k2", "set"}, sub.read())
+	assert.Equal(t, []any{"message", "k2", "set"}, sub2.read())
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	s, addr, shutdown := newTestServer(t)
+	c := dial(t, addr)
+	assert.Equal(t, "OK", c.do("SET", "k", "v"))
+
+	shutdown()
+	// the idle connection is closed.
+	assert.Equal(t, io.EOF, c.read())
+	_, err := net.Dial("tcp", addr)
+	assert.Error(t, err)
+	assert.Equal(t, ErrServerClosed, s.ListenAndServe("127.0.0.1:0"))
+}
@@ -0,0 +1,463 @@
+package rosedb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/rosedblabs/wal"
+)
+
+// setCursor iterates the members of a set in order by seeking the index,
+// so the set algebra can walk several sets together without loading them into memory.
+// The members are only read from the keys of the index, since the member records of a set have no values.
+type setCursor struct {
+	b       *Batch
+	prefix  []byte
+	pending []*LogRecord // the pending writes of the members in the batch, sorted by key
+	member  []byte       // the current member, nil if the cursor is exhausted
+}
+
+func (b *Batch) newSetCursor(key []byte) (*setCursor, error) {
+	meta, err := b.getMeta(key, DataTypeSet)
+	if err != nil {
+		return nil, err
+	}
+	c := &setCursor{b: b, prefix: encodeMemberPrefix(key)}
+	if meta.count == 0 {
+		return c, nil
+	}
+
+	// the batch is not written during the set algebra, so the pending writes are sorted only once.
+	b.mu.RLock()
+	for _, record := range b.pendingWrites {
+		if bytes.HasPrefix(record.Key, c.prefix) {
+			c.pending = append(c.pending, record)
+		}
+	}
+	b.mu.RUnlock()
+	sort.Slice(c.pending, func(i, j int) bool {
+		return bytes.Compare(c.pending[i].Key, c.pending[j].Key) < 0
+	})
+	return c, c.seek(nil)
+}
+
+// seek moves the cursor to the first member which is greater than or equal to target.
+func (c *setCursor) seek(target []byte) error {
+	if c.b.db.closed {
+		return ErrDBClosed
+	}
+	startKey := append(bytes.Clone(c.prefix), target...)
+	searchPending := func(k []byte) int {
+		return sort.Search(len(c.pending), func(i int) bool {
+			return bytes.Compare(c.pending[i].Key, k) >= 0
+		})
+	}
+
+	// the first member in the index, the ones written in the batch are skipped.
+	var indexKey []byte
+	c.b.db.index.AscendGreaterOrEqual(startKey, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, c.prefix) {
+			return false, nil
+		}
+		if i := searchPending(k); i < len(c.pending) && bytes.Equal(c.pending[i].Key, k) {
+			return true, nil
+		}
+		indexKey = k
+		return false, nil
+	})
+	// the first member written in the batch.
+	var pendingKey []byte
+	for i := searchPending(startKey); i < len(c.pending); i++ {
+		if c.pending[i].Type != LogRecordDeleted {
+			pendingKey = c.pending[i].Key
+			break
+		}
+	}
+
+	key := indexKey
+	if key == nil || (pendingKey != nil && bytes.Compare(pendingKey, key) < 0) {
+		key = pendingKey
+	}
+	c.member = nil
+	if key != nil {
+		c.member = bytes.Clone(key[len(c.prefix):])
+	}
+	return nil
+}
+
+// next moves the cursor to the member after the current one.
+func (c *setCursor) next() error {
+	return c.seek(append(c.member, 0))
+}
+
+func (c *setCursor) valid() bool {
+	return c.member != nil
+}
+
+// SAdd adds the members to the set, and returns the number of the members added.
+func (b *Batch) SAdd(key []byte, members ...[]byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeSet)
+	if err != nil {
+		return 0, err
+	}
+	var added int
+	for _, member := range members {
+		if len(member) == 0 {
+			return 0, ErrKeyIsEmpty
+		}
+		_, err = b.getMember(key, member)
+		if err == nil {
+			continue
+		}
+		if err != ErrKeyNotFound {
+			return 0, err
+		}
+		if err = b.putMember(key, member, nil); err != nil {
+			return 0, err
+		}
+		added++
+		meta.count++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, b.putMeta(key, meta)
+}
+
+// SRem removes the members from the set, and returns the number of the members removed.
+func (b *Batch) SRem(key []byte, members ...[]byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeSet)
+	if err != nil || meta.count == 0 {
+		return 0, err
+	}
+	var removed int
+	for _, member := range members {
+		_, err = b.getMember(key, member)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = b.deleteMember(key, member); err != nil {
+			return 0, err
+		}
+		removed++
+		meta.count--
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, b.putMeta(key, meta)
+}
+
+// SIsMember returns whether the member is in the set.
+func (b *Batch) SIsMember(key, member []byte) (bool, error) {
+	if _, err := b.getMeta(key, DataTypeSet); err != nil {
+		return false, err
+	}
+	_, err := b.getMember(key, member)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SCard returns the number of the members of the set.
+func (b *Batch) SCard(key []byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeSet)
+	if err != nil {
+		return 0, err
+	}
+	return int(meta.count), nil
+}
+
+// SMembers returns all the members of the set in order.
+func (b *Batch) SMembers(key []byte) ([][]byte, error) {
+	members, _, err := b.SScan(key, nil, 0)
+	return members, err
+}
+
+// SScan returns at most count members of the set in order, starting from the member cursor,
+// and the cursor of the next scan, which is nil if all the members are returned.
+// A nil cursor starts from the first member, and 0 count means no limit.
+func (b *Batch) SScan(key, cursor []byte, count int) ([][]byte, []byte, error) {
+	if _, err := b.getMeta(key, DataTypeSet); err != nil {
+		return nil, nil, err
+	}
+	var members [][]byte
+	var next []byte
+	err := b.scanMembers(key, cursor, false, func(member, _ []byte) (bool, error) {
+		if count > 0 && len(members) == count {
+			next = bytes.Clone(member)
+			return false, nil
+		}
+		members = append(members, bytes.Clone(member))
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return members, next, nil
+}
+
+func (b *Batch) newSetCursors(keys [][]byte) ([]*setCursor, error) {
+	cursors := make([]*setCursor, 0, len(keys))
+	for _, key := range keys {
+		c, err := b.newSetCursor(key)
+		if err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, nil
+}
+
+// setInter calls handleFn for each member of the intersection of the sets in order.
+// The cursors leapfrog each other, each one seeks to the greatest member of the others until they all agree.
+func (b *Batch) setInter(keys [][]byte, handleFn func(member []byte) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	cursors, err := b.newSetCursors(keys)
+	if err != nil {
+		return err
+	}
+	for {
+		var target []byte
+		for _, c := range cursors {
+			if !c.valid() {
+				return nil
+			}
+			if target == nil || bytes.Compare(c.member, target) > 0 {
+				target = c.member
+			}
+		}
+		matched := true
+		for _, c := range cursors {
+			if bytes.Equal(c.member, target) {
+				continue
+			}
+			matched = false
+			if err = c.seek(target); err != nil {
+				return err
+			}
+		}
+		if !matched {
+			continue
+		}
+		if err = handleFn(target); err != nil {
+			return err
+		}
+		for _, c := range cursors {
+			if err = c.next(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setUnion calls handleFn for each member of the union of the sets in order.
+func (b *Batch) setUnion(keys [][]byte, handleFn func(member []byte) error) error {
+	cursors, err := b.newSetCursors(keys)
+	if err != nil {
+		return err
+	}
+	for {
+		var smallest []byte
+		for _, c := range cursors {
+			if c.valid() && (smallest == nil || bytes.Compare(c.member, smallest) < 0) {
+				smallest = c.member
+			}
+		}
+		if smallest == nil {
+			return nil
+		}
+		if err = handleFn(smallest); err != nil {
+			return err
+		}
+		for _, c := range cursors {
+			if c.valid() && bytes.Equal(c.member, smallest) {
+				if err = c.next(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// setDiff calls handleFn for each member of the first set which is not in the other sets in order.
+func (b *Batch) setDiff(keys [][]byte, handleFn func(member []byte) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	cursors, err := b.newSetCursors(keys)
+	if err != nil {
+		return err
+	}
+	first, others := cursors[0], cursors[1:]
+	for first.valid() {
+		found := false
+		for _, c := range others {
+			if c.valid() && bytes.Compare(c.member, first.member) < 0 {
+				if err = c.seek(first.member); err != nil {
+					return err
+				}
+			}
+			if c.valid() && bytes.Equal(c.member, first.member) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if err = handleFn(first.member); err != nil {
+				return err
+			}
+		}
+		if err = first.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectMembers runs the set operation and returns the members in order.
+func collectMembers(opFn func(handleFn func(member []byte) error) error) ([][]byte, error) {
+	var members [][]byte
+	err := opFn(func(member []byte) error {
+		members = append(members, member)
+		return nil
+	})
+	return members, err
+}
+
+// SInter returns the members of the intersection of the sets in order,
+// the keys which do not exist are treated as empty sets.
+func (b *Batch) SInter(keys ...[]byte) ([][]byte, error) {
+	return collectMembers(func(handleFn func(member []byte) error) error {
+		return b.setInter(keys, handleFn)
+	})
+}
+
+// SUnion returns the members of the union of the sets in order.
+func (b *Batch) SUnion(keys ...[]byte) ([][]byte, error) {
+	return collectMembers(func(handleFn func(member []byte) error) error {
+		return b.setUnion(keys, handleFn)
+	})
+}
+
+// SDiff returns the members of the first set which are not in the other sets in order.
+func (b *Batch) SDiff(keys ...[]byte) ([][]byte, error) {
+	return collectMembers(func(handleFn func(member []byte) error) error {
+		return b.setDiff(keys, handleFn)
+	})
+}
+
+// SInterStore stores the intersection of the sets in the set dest, which is replaced if it exists even of another data type,
+// and returns the number of the members of dest.
+func (b *Batch) SInterStore(dest []byte, keys ...[]byte) (int, error) {
+	if len(dest) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	// dest may be one of the sets, so it is only replaced after the intersection is computed.
+	members, err := b.SInter(keys...)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = b.deleteData(dest); err != nil {
+		return 0, err
+	}
+	return b.SAdd(dest, members...)
+}
+
+// SAdd adds the members to the set atomically, and returns the number of the members added.
+func (db *DB) SAdd(key []byte, members ...[]byte) (added int, err error) {
+	err = db.update(func(batch *Batch) error {
+		added, err = batch.SAdd(key, members...)
+		return err
+	})
+	return
+}
+
+// SRem removes the members from the set atomically, and returns the number of the members removed.
+func (db *DB) SRem(key []byte, members ...[]byte) (removed int, err error) {
+	err = db.update(func(batch *Batch) error {
+		removed, err = batch.SRem(key, members...)
+		return err
+	})
+	return
+}
+
+// SIsMember returns whether the member is in the set.
+func (db *DB) SIsMember(key, member []byte) (ok bool, err error) {
+	err = db.view(func(batch *Batch) error {
+		ok, err = batch.SIsMember(key, member)
+		return err
+	})
+	return
+}
+
+// SCard returns the number of the members of the set.
+func (db *DB) SCard(key []byte) (n int, err error) {
+	err = db.view(func(batch *Batch) error {
+		n, err = batch.SCard(key)
+		return err
+	})
+	return
+}
+
+// SMembers returns all the members of the set in order.
+func (db *DB) SMembers(key []byte) (members [][]byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		members, err = batch.SMembers(key)
+		return err
+	})
+	return
+}
+
+// SScan returns at most count members of the set in order, starting from the member cursor,
+// and the cursor of the next scan, which is nil if all the members are returned.
+func (db *DB) SScan(key, cursor []byte, count int) (members [][]byte, next []byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		members, next, err = batch.SScan(key, cursor, count)
+		return err
+	})
+	return
+}
+
+// SInter returns the members of the intersection of the sets in order.
+func (db *DB) SInter(keys ...[]byte) (members [][]byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		members, err = batch.SInter(keys...)
+		return err
+	})
+	return
+}
+
+// SUnion returns the members of the union of the sets in order.
+func (db *DB) SUnion(keys ...[]byte) (members [][]byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		members, err = batch.SUnion(keys...)
+		return err
+	})
+	return
+}
+
+// SDiff returns the members of the first set which are not in the other sets in order.
+func (db *DB) SDiff(keys ...[]byte) (members [][]byte, err error) {
+	err = db.view(func(batch *Batch) error {
+		members, err = batch.SDiff(keys...)
+		return err
+	})
+	return
+}
+
+// SInterStore stores the intersection of the sets in the set dest atomically,
+// and returns the number of the members of dest.
+func (db *DB) SInterStore(dest []byte, keys ...[]byte) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.SInterStore(dest, keys...)
+		return err
+	})
+	return
+}
@@ -0,0 +1,128 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_Set(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("tags")
+	added, err := db.SAdd(key, []byte("go"), []byte("db"), []byte("go"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = db.SAdd(key, []byte("kv"), []byte("db"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	ok, err := db.SIsMember(key, []byte("db"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = db.SIsMember(key, []byte("sql"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	n, err := db.SCard(key)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	members, err := db.SMembers(key)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("db"), []byte("go"), []byte("kv")}, members)
+	members, next, err := db.SScan(key, nil, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("db"), []byte("go")}, members)
+	members, next, err = db.SScan(key, next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("kv")}, members)
+	assert.Nil(t, next)
+
+	removed, err := db.SRem(key, []byte("go"), []byte("sql"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	removed, err = db.SRem(key, []byte("db"), []byte("kv"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	_, err = db.DataType(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = db.RPush([]byte("list"), []byte("v"))
+	require.NoError(t, err)
+	_, err = db.SAdd([]byte("list"), []byte("v"))
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.SInter(key, []byte("list"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestDB_SetAlgebra(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	// multiples of 2, 3 and 5 below 60.
+	for _, m := range []int{2, 3, 5} {
+		for i := 0; i < 60; i += m {
+			_, err = db.SAdd([]byte(fmt.Sprintf("m%d", m)), []byte(fmt.Sprintf("%02d", i)))
+			require.NoError(t, err)
+		}
+	}
+	m2, m3, m5 := []byte("m2"), []byte("m3"), []byte("m5")
+
+	members, err := db.SInter(m2, m3, m5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"00", "30"}, setMembers(members))
+	members, err = db.SInter(m2, m3, []byte("missing"))
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	members, err = db.SUnion(m3, m5)
+	require.NoError(t, err)
+	assert.Len(t, members, 20+12-4)
+	assert.Equal(t, []string{"00", "03", "05", "06", "09", "10"}, setMembers(members[:6]))
+
+	members, err = db.SDiff(m3, m2, m5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"03", "09", "21", "27", "33", "39", "51", "57"}, setMembers(members))
+	members, err = db.SDiff(m5, []byte("missing"))
+	require.NoError(t, err)
+	assert.Len(t, members, 12)
+
+	// the destination can be one of the sources.
+	n, err := db.SInterStore(m2, m2, m3)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	members, err = db.SMembers(m2)
+	require.NoError(t, err)
+	assert.Equal(t, "54", string(members[9]))
+	n, err = db.SInterStore([]byte("none"), m2, []byte("missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.DataType([]byte("none"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the members written in the batch take part in the algebra.
+	batch := db.NewBatch(DefaultBatchOptions)
+	_, err = batch.SAdd(m5, []byte("03"))
+	require.NoError(t, err)
+	_, err = batch.SRem(m3, []byte("00"))
+	require.NoError(t, err)
+	members, err = batch.SInter(m3, m5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"03", "15", "30", "45"}, setMembers(members))
+	require.NoError(t, batch.Rollback())
+}
+
+func setMembers(members [][]byte) []string {
+	result := make([]string, 0, len(members))
+	for _, member := range members {
+		result = append(result, string(member))
+	}
+	return result
+}
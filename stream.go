@@ -0,0 +1,531 @@
+package rosedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The stream keeps its entries in the order of their ids, and the state of its consumer groups:
+//
+//	'e' | id                      -> fields
+//	'g' | group                   -> last delivered id
+//	'p' | uvarint(len(group)) | group | id -> consumer | delivery time | deliveries
+//
+// The head and tail of the meta record are the milliseconds and the sequence of the last id,
+// and the count is the number of the entries.
+// The meta record is kept when all the entries are trimmed, so the ids never go back.
+const (
+	streamEntryTag   = 'e'
+	streamGroupTag   = 'g'
+	streamPendingTag = 'p'
+)
+
+// StreamID is the id of a stream entry, the milliseconds of the time it is added and a sequence in the millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is greater than or equal to all the stream ids.
+var MaxStreamID = StreamID{Ms: 1<<64 - 1, Seq: 1<<64 - 1}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Compare returns -1, 0 or 1 if id is less than, equal to or greater than other.
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq):
+		return -1
+	case id == other:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// next returns the smallest id greater than id.
+func (id StreamID) next() StreamID {
+	if id.Seq == 1<<64-1 {
+		return StreamID{Ms: id.Ms + 1}
+	}
+	return StreamID{Ms: id.Ms, Seq: id.Seq + 1}
+}
+
+func (id StreamID) encode() []byte {
+	buf := binary.BigEndian.AppendUint64(make([]byte, 0, 16), id.Ms)
+	return binary.BigEndian.AppendUint64(buf, id.Seq)
+}
+
+func decodeStreamID(buf []byte) StreamID {
+	return StreamID{Ms: binary.BigEndian.Uint64(buf), Seq: binary.BigEndian.Uint64(buf[8:])}
+}
+
+// StreamEntry is an entry of a stream.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []FieldValue
+}
+
+// StreamPending is an entry delivered to a consumer of a group but not acknowledged yet.
+type StreamPending struct {
+	ID          StreamID
+	Consumer    []byte
+	DeliveredAt time.Time
+	Deliveries  int
+}
+
+func encodeStreamFields(fields []FieldValue) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(fields)))
+	for _, fv := range fields {
+		buf = binary.AppendUvarint(buf, uint64(len(fv.Field)))
+		buf = append(buf, fv.Field...)
+		buf = binary.AppendUvarint(buf, uint64(len(fv.Value)))
+		buf = append(buf, fv.Value...)
+	}
+	return buf
+}
+
+func decodeStreamFields(buf []byte) []FieldValue {
+	count, n := binary.Uvarint(buf)
+	buf = buf[n:]
+	fields := make([]FieldValue, 0, count)
+	readBytes := func() []byte {
+		size, n := binary.Uvarint(buf)
+		b := bytes.Clone(buf[n : n+int(size)])
+		buf = buf[n+int(size):]
+		return b
+	}
+	for i := uint64(0); i < count; i++ {
+		field := readBytes()
+		fields = append(fields, FieldValue{Field: field, Value: readBytes()})
+	}
+	return fields
+}
+
+func encodeStreamEntry(id StreamID) []byte {
+	return append([]byte{streamEntryTag}, id.encode()...)
+}
+
+func encodeStreamGroup(group []byte) []byte {
+	return append([]byte{streamGroupTag}, group...)
+}
+
+func encodeStreamPendingPrefix(group []byte) []byte {
+	buf := binary.AppendUvarint([]byte{streamPendingTag}, uint64(len(group)))
+	return append(buf, group...)
+}
+
+func encodeStreamPending(group []byte, id StreamID) []byte {
+	return append(encodeStreamPendingPrefix(group), id.encode()...)
+}
+
+func encodeStreamPendingValue(p *StreamPending) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(p.Consumer)))
+	buf = append(buf, p.Consumer...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(p.DeliveredAt.UnixNano()))
+	return binary.AppendUvarint(buf, uint64(p.Deliveries))
+}
+
+func decodeStreamPendingValue(id StreamID, buf []byte) StreamPending {
+	size, n := binary.Uvarint(buf)
+	p := StreamPending{ID: id, Consumer: bytes.Clone(buf[n : n+int(size)])}
+	buf = buf[n+int(size):]
+	p.DeliveredAt = time.Unix(0, int64(binary.BigEndian.Uint64(buf)))
+	deliveries, _ := binary.Uvarint(buf[8:])
+	p.Deliveries = int(deliveries)
+	return p
+}
+
+// putStreamMeta writes the meta record of the stream, which is kept even if the stream has no entries.
+func (b *Batch) putStreamMeta(key []byte, meta *dataMeta) error {
+	return b.putRecord(encodeMetaKey(key), meta.encode(), meta.expire)
+}
+
+// getStreamMeta returns the meta record of the stream, ErrKeyNotFound is returned if the stream does not exist.
+func (b *Batch) getStreamMeta(key []byte) (*dataMeta, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	record, err := b.getRecord(encodeMetaKey(key))
+	if err != nil {
+		return nil, err
+	}
+	meta := decodeMeta(record.Value, record.Expire)
+	if meta.dataType != DataTypeStream {
+		return nil, ErrWrongType
+	}
+	return meta, nil
+}
+
+// scanStream calls handleFn for each entry of the stream with the id in [start, end] in order.
+func (b *Batch) scanStream(key []byte, start, end StreamID, handleFn func(entry StreamEntry) (bool, error)) error {
+	endMember := encodeStreamEntry(end)
+	return b.scanMembers(key, encodeStreamEntry(start), false, func(member, value []byte) (bool, error) {
+		if member[0] != streamEntryTag || bytes.Compare(member, endMember) > 0 {
+			return false, nil
+		}
+		return handleFn(StreamEntry{ID: decodeStreamID(member[1:]), Fields: decodeStreamFields(value)})
+	})
+}
+
+// XAdd appends an entry with the fields to the stream, and returns its id,
+// which is made of the current time, and is always greater than the ids of the existing entries.
+func (b *Batch) XAdd(key []byte, fields ...FieldValue) (StreamID, error) {
+	meta, err := b.getMeta(key, DataTypeStream)
+	if err != nil {
+		return StreamID{}, err
+	}
+	id := StreamID{Ms: uint64(time.Now().UnixMilli())}
+	if last := (StreamID{Ms: meta.head, Seq: meta.tail}); id.Compare(last) <= 0 {
+		id = last.next()
+	}
+	if err = b.putMember(key, encodeStreamEntry(id), encodeStreamFields(fields)); err != nil {
+		return StreamID{}, err
+	}
+	meta.head, meta.tail = id.Ms, id.Seq
+	meta.count++
+	return id, b.putStreamMeta(key, meta)
+}
+
+// XLen returns the number of the entries of the stream.
+func (b *Batch) XLen(key []byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeStream)
+	if err != nil {
+		return 0, err
+	}
+	return int(meta.count), nil
+}
+
+// XRange returns at most count entries of the stream with the id in [start, end] in order, 0 count means no limit.
+func (b *Batch) XRange(key []byte, start, end StreamID, count int) ([]StreamEntry, error) {
+	if _, err := b.getMeta(key, DataTypeStream); err != nil {
+		return nil, err
+	}
+	var entries []StreamEntry
+	err := b.scanStream(key, start, end, func(entry StreamEntry) (bool, error) {
+		entries = append(entries, entry)
+		return count <= 0 || len(entries) < count, nil
+	})
+	return entries, err
+}
+
+// trimStream deletes the entries of the stream in order while trimFn returns true, and returns the number deleted.
+func (b *Batch) trimStream(key []byte, trimFn func(id StreamID, remain uint64) bool) (int, error) {
+	meta, err := b.getStreamMeta(key)
+	if err == ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var ids []StreamID
+	remain := meta.count
+	err = b.scanStream(key, StreamID{}, MaxStreamID, func(entry StreamEntry) (bool, error) {
+		if !trimFn(entry.ID, remain) {
+			return false, nil
+		}
+		ids = append(ids, entry.ID)
+		remain--
+		return true, nil
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err = b.deleteMember(key, encodeStreamEntry(id)); err != nil {
+			return 0, err
+		}
+	}
+	meta.count = remain
+	return len(ids), b.putStreamMeta(key, meta)
+}
+
+// XTrimMaxLen deletes the oldest entries of the stream until it has at most maxLen entries,
+// and returns the number of the entries deleted.
+func (b *Batch) XTrimMaxLen(key []byte, maxLen int) (int, error) {
+	return b.trimStream(key, func(_ StreamID, remain uint64) bool {
+		return remain > uint64(max(maxLen, 0))
+	})
+}
+
+// XTrimMaxAge deletes the entries of the stream added more than maxAge ago,
+// and returns the number of the entries deleted.
+func (b *Batch) XTrimMaxAge(key []byte, maxAge time.Duration) (int, error) {
+	// the cutoff is before the epoch if maxAge is very large, and no entry is older than it.
+	minMs := uint64(max(time.Now().Add(-maxAge).UnixMilli(), 0))
+	return b.trimStream(key, func(id StreamID, _ uint64) bool {
+		return id.Ms < minMs
+	})
+}
+
+// XGroupCreate creates the consumer group of the stream,
+// which delivers the entries after the id start, a zero id delivers all the entries,
+// and MaxStreamID delivers only the entries added after the group is created.
+// The stream is created if it does not exist.
+func (b *Batch) XGroupCreate(key, group []byte, start StreamID) error {
+	if len(group) == 0 {
+		return ErrKeyIsEmpty
+	}
+	meta, err := b.getMeta(key, DataTypeStream)
+	if err != nil {
+		return err
+	}
+	if _, err = b.getMember(key, encodeStreamGroup(group)); err == nil {
+		return ErrStreamGroupExists
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+	if start == MaxStreamID {
+		start = StreamID{Ms: meta.head, Seq: meta.tail}
+	}
+	if err = b.putMember(key, encodeStreamGroup(group), start.encode()); err != nil {
+		return err
+	}
+	return b.putStreamMeta(key, meta)
+}
+
+// XReadGroup delivers at most count entries which are not delivered to the group yet to the consumer,
+// and adds them to the pending entries of the group until they are acknowledged by XAck, 0 count means no limit.
+func (b *Batch) XReadGroup(key, group, consumer []byte, count int) ([]StreamEntry, error) {
+	_, err := b.getStreamMeta(key)
+	if err == ErrKeyNotFound {
+		return nil, ErrStreamGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err := b.getMember(key, encodeStreamGroup(group))
+	if err == ErrKeyNotFound {
+		return nil, ErrStreamGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := b.XRange(key, decodeStreamID(value).next(), MaxStreamID, count)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		p := &StreamPending{ID: entry.ID, Consumer: consumer, DeliveredAt: now, Deliveries: 1}
+		if err = b.putMember(key, encodeStreamPending(group, entry.ID), encodeStreamPendingValue(p)); err != nil {
+			return nil, err
+		}
+	}
+	last := entries[len(entries)-1].ID
+	return entries, b.putMember(key, encodeStreamGroup(group), last.encode())
+}
+
+// XClaim delivers the pending entries of the group which have not been acknowledged for at least minIdle
+// to the consumer again, and returns them, so the entries of a failed consumer can be taken over.
+// The deliveries of the entries claimed are increased, the ids which are not pending
+// or delivered less than minIdle ago are skipped, and the pending entries already trimmed are removed.
+func (b *Batch) XClaim(key, group, consumer []byte, minIdle time.Duration, ids ...StreamID) ([]StreamEntry, error) {
+	_, err := b.getStreamMeta(key)
+	if err == ErrKeyNotFound {
+		return nil, ErrStreamGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = b.getMember(key, encodeStreamGroup(group)); err == ErrKeyNotFound {
+		return nil, ErrStreamGroupNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var entries []StreamEntry
+	for _, id := range ids {
+		value, err := b.getMember(key, encodeStreamPending(group, id))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := decodeStreamPendingValue(id, value)
+		if now.Sub(p.DeliveredAt) < minIdle {
+			continue
+		}
+		fields, err := b.getMember(key, encodeStreamEntry(id))
+		if err == ErrKeyNotFound {
+			if err = b.deleteMember(key, encodeStreamPending(group, id)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Consumer, p.DeliveredAt = consumer, now
+		p.Deliveries++
+		if err = b.putMember(key, encodeStreamPending(group, id), encodeStreamPendingValue(&p)); err != nil {
+			return nil, err
+		}
+		entries = append(entries, StreamEntry{ID: id, Fields: decodeStreamFields(fields)})
+	}
+	return entries, nil
+}
+
+// XAck acknowledges the entries delivered to the group, and returns the number of the pending entries removed.
+func (b *Batch) XAck(key, group []byte, ids ...StreamID) (int, error) {
+	if _, err := b.getMeta(key, DataTypeStream); err != nil {
+		return 0, err
+	}
+	var acked int
+	for _, id := range ids {
+		_, err := b.getMember(key, encodeStreamPending(group, id))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = b.deleteMember(key, encodeStreamPending(group, id)); err != nil {
+			return 0, err
+		}
+		acked++
+	}
+	return acked, nil
+}
+
+// XPending returns the entries delivered to the group but not acknowledged yet in the order of the ids.
+func (b *Batch) XPending(key, group []byte) ([]StreamPending, error) {
+	if _, err := b.getMeta(key, DataTypeStream); err != nil {
+		return nil, err
+	}
+	prefix := encodeStreamPendingPrefix(group)
+	var pending []StreamPending
+	err := b.scanMembers(key, prefix, false, func(member, value []byte) (bool, error) {
+		if !bytes.HasPrefix(member, prefix) {
+			return false, nil
+		}
+		pending = append(pending, decodeStreamPendingValue(decodeStreamID(member[len(prefix):]), value))
+		return true, nil
+	})
+	return pending, err
+}
+
+// XAdd appends an entry with the fields to the stream atomically, and returns its id.
+func (db *DB) XAdd(key []byte, fields ...FieldValue) (id StreamID, err error) {
+	err = db.update(func(batch *Batch) error {
+		id, err = batch.XAdd(key, fields...)
+		return err
+	})
+	return
+}
+
+// XLen returns the number of the entries of the stream.
+func (db *DB) XLen(key []byte) (n int, err error) {
+	err = db.view(func(batch *Batch) error {
+		n, err = batch.XLen(key)
+		return err
+	})
+	return
+}
+
+// XRange returns at most count entries of the stream with the id in [start, end] in order, 0 count means no limit.
+func (db *DB) XRange(key []byte, start, end StreamID, count int) (entries []StreamEntry, err error) {
+	err = db.view(func(batch *Batch) error {
+		entries, err = batch.XRange(key, start, end, count)
+		return err
+	})
+	return
+}
+
+// XRead returns at most count entries of the stream after the id in order,
+// it blocks until an entry is added if there is none, or ctx is done.
+// MaxStreamID waits for the entries added after the call.
+func (db *DB) XRead(ctx context.Context, key []byte, after StreamID, count int) ([]StreamEntry, error) {
+	if after == MaxStreamID {
+		err := db.view(func(batch *Batch) error {
+			meta, err := batch.getMeta(key, DataTypeStream)
+			if err != nil {
+				return err
+			}
+			after = StreamID{Ms: meta.head, Seq: meta.tail}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return waitData(ctx, db, key, func() ([]StreamEntry, bool, error) {
+		entries, err := db.XRange(key, after.next(), MaxStreamID, count)
+		return entries, len(entries) > 0, err
+	})
+}
+
+// XTrimMaxLen deletes the oldest entries of the stream until it has at most maxLen entries,
+// and returns the number of the entries deleted.
+func (db *DB) XTrimMaxLen(key []byte, maxLen int) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.XTrimMaxLen(key, maxLen)
+		return err
+	})
+	return
+}
+
+// XTrimMaxAge deletes the entries of the stream added more than maxAge ago,
+// and returns the number of the entries deleted.
+func (db *DB) XTrimMaxAge(key []byte, maxAge time.Duration) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.XTrimMaxAge(key, maxAge)
+		return err
+	})
+	return
+}
+
+// XGroupCreate creates the consumer group of the stream, which delivers the entries after the id start.
+func (db *DB) XGroupCreate(key, group []byte, start StreamID) error {
+	return db.update(func(batch *Batch) error {
+		return batch.XGroupCreate(key, group, start)
+	})
+}
+
+// XReadGroup delivers at most count entries which are not delivered to the group yet to the consumer,
+// it blocks until an entry is added if there is none, or ctx is done.
+func (db *DB) XReadGroup(ctx context.Context, key, group, consumer []byte, count int) ([]StreamEntry, error) {
+	return waitData(ctx, db, key, func() (entries []StreamEntry, done bool, err error) {
+		err = db.update(func(batch *Batch) error {
+			entries, err = batch.XReadGroup(key, group, consumer, count)
+			return err
+		})
+		return entries, len(entries) > 0, err
+	})
+}
+
+// XClaim delivers the pending entries of the group which have not been acknowledged for at least minIdle
+// to the consumer again atomically, and returns them.
+func (db *DB) XClaim(key, group, consumer []byte, minIdle time.Duration, ids ...StreamID) (entries []StreamEntry, err error) {
+	err = db.update(func(batch *Batch) error {
+		entries, err = batch.XClaim(key, group, consumer, minIdle, ids...)
+		return err
+	})
+	return
+}
+
+// XAck acknowledges the entries delivered to the group atomically,
+// and returns the number of the pending entries removed.
+func (db *DB) XAck(key, group []byte, ids ...StreamID) (n int, err error) {
+	err = db.update(func(batch *Batch) error {
+		n, err = batch.XAck(key, group, ids...)
+		return err
+	})
+	return
+}
+
+// XPending returns the entries delivered to the group but not acknowledged yet in the order of the ids.
+func (db *DB) XPending(key, group []byte) (pending []StreamPending, err error) {
+	err = db.view(func(batch *Batch) error {
+		pending, err = batch.XPending(key, group)
+		return err
+	})
+	return
+}
@@ -0,0 +1,186 @@
+package rosedb
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_Stream(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("events")
+	var ids []StreamID
+	for _, name := range []string{"created", "paid", "shipped"} {
+		id, err := db.XAdd(key, FieldValue{Field: []byte("type"), Value: []byte(name)})
+		require.NoError(t, err)
+		if len(ids) > 0 {
+			assert.Equal(t, 1, id.Compare(ids[len(ids)-1]))
+		}
+		ids = append(ids, id)
+	}
+	n, err := db.XLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	entries, err := db.XRange(key, StreamID{}, MaxStreamID, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, ids[0], entries[0].ID)
+	assert.Equal(t, []FieldValue{{Field: []byte("type"), Value: []byte("created")}}, entries[0].Fields)
+	entries, err = db.XRange(key, ids[1], MaxStreamID, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ids[1], entries[0].ID)
+
+	// the ids keep growing after the entries are trimmed and the db is reopened.
+	deleted, err := db.XTrimMaxLen(key, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	deleted, err = db.XTrimMaxAge(key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = db.XTrimMaxLen(key, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	n, err = db.XLen(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	id, err := db.XAdd(key, FieldValue{Field: []byte("type"), Value: []byte("delivered")})
+	require.NoError(t, err)
+	assert.Equal(t, 1, id.Compare(ids[2]))
+
+	// a max age before the epoch trims nothing.
+	deleted, err = db.XTrimMaxAge(key, time.Duration(math.MaxInt64))
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	time.Sleep(5 * time.Millisecond)
+	deleted, err = db.XTrimMaxAge(key, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+func TestDB_XRead(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("events")
+	first, err := db.XAdd(key, FieldValue{Field: []byte("n"), Value: []byte("1")})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entries, err := db.XRead(ctx, key, StreamID{}, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, first, entries[0].ID)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = db.XAdd(key, FieldValue{Field: []byte("n"), Value: []byte("2")})
+	}()
+	entries, err = db.XRead(ctx, key, MaxStreamID, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []byte("2"), entries[0].Fields[0].Value)
+
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	_, err = db.XRead(timeout, key, entries[0].ID, 0)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDB_StreamGroup(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key, group := []byte("orders"), []byte("billing")
+	for i := 0; i < 3; i++ {
+		_, err = db.XAdd(key, FieldValue{Field: []byte("n"), Value: []byte{byte('0' + i)}})
+		require.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = db.XReadGroup(ctx, key, group, []byte("c1"), 0)
+	assert.Equal(t, ErrStreamGroupNotFound, err)
+	require.NoError(t, db.XGroupCreate(key, group, StreamID{}))
+	assert.Equal(t, ErrStreamGroupExists, db.XGroupCreate(key, group, StreamID{}))
+
+	// the entries are delivered to the consumers of the group once.
+	entries1, err := db.XReadGroup(ctx, key, group, []byte("c1"), 2)
+	require.NoError(t, err)
+	require.Len(t, entries1, 2)
+	entries2, err := db.XReadGroup(ctx, key, group, []byte("c2"), 0)
+	require.NoError(t, err)
+	require.Len(t, entries2, 1)
+	assert.Equal(t, []byte("2"), entries2[0].Fields[0].Value)
+
+	pending, err := db.XPending(key, group)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	assert.Equal(t, []byte("c1"), pending[0].Consumer)
+	assert.Equal(t, []byte("c2"), pending[2].Consumer)
+	assert.Equal(t, 1, pending[2].Deliveries)
+
+	// the entries of a failed consumer are claimed by another one after they are idle long enough.
+	claimed, err := db.XClaim(key, group, []byte("c2"), time.Hour, entries1[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	time.Sleep(5 * time.Millisecond)
+	claimed, err = db.XClaim(key, group, []byte("c2"), time.Millisecond, entries1[0].ID, StreamID{Ms: 1})
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, entries1[0], claimed[0])
+	pending, err = db.XPending(key, group)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("c2"), pending[0].Consumer)
+	assert.Equal(t, 2, pending[0].Deliveries)
+	_, err = db.XClaim(key, []byte("unknown"), []byte("c2"), 0, entries1[0].ID)
+	assert.Equal(t, ErrStreamGroupNotFound, err)
+
+	acked, err := db.XAck(key, group, entries1[0].ID, entries1[1].ID, entries1[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, acked)
+
+	// the pending entries and the position of the group survive a restart.
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	pending, err = db.XPending(key, group)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, entries2[0].ID, pending[0].ID)
+
+	// a blocked consumer is woken up by a new entry, and the new group only sees the new entries.
+	require.NoError(t, db.XGroupCreate(key, []byte("audit"), MaxStreamID))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = db.XAdd(key, FieldValue{Field: []byte("n"), Value: []byte("3")})
+	}()
+	entries, err := db.XReadGroup(ctx, key, group, []byte("c1"), 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []byte("3"), entries[0].Fields[0].Value)
+	entries, err = db.XReadGroup(ctx, key, []byte("audit"), []byte("c1"), 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []byte("3"), entries[0].Fields[0].Value)
+}
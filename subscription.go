@@ -0,0 +1,285 @@
+package rosedb
+
+import (
+	"bytes"
+	"sync"
+)
+
+// OverflowPolicy decides what a subscription does when its buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowDropOldest drops the oldest event in the buffer to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowBlock blocks the writer until there is room in the buffer,
+	// so a slow consumer slows down all the writes of the database.
+	OverflowBlock
+	// OverflowClose closes the subscription, and Err returns ErrSubscriptionOverflow.
+	OverflowClose
+)
+
+// SubscribeOptions specifies the events received by a subscription and how they are buffered.
+type SubscribeOptions struct {
+	// Prefix only receives the events of the keys with the prefix, nil means all the keys.
+	Prefix []byte
+	// StartKey and EndKey only receive the events of the keys in [StartKey, EndKey),
+	// nil means the range is unbounded on that side.
+	StartKey []byte
+	EndKey   []byte
+	// Actions only receives the events of the actions, empty means all the actions.
+	Actions []WatchActionType
+	// BufferSize is the max number of the events buffered for the consumer, default is 1024.
+	BufferSize int
+	// Overflow is what to do when the buffer is full, default is OverflowDropOldest.
+	Overflow OverflowPolicy
+	// GroupBatches delivers the events of a batch together as a BatchEvent by Batches instead of Events,
+	// and the buffer is counted in batches then.
+	GroupBatches bool
+}
+
+// Subscription receives the events of the database which match its options.
+// Each subscription has its own buffer, so the subscriptions never steal events from each other.
+type Subscription struct {
+	db      *DB
+	options SubscribeOptions
+	ch      chan *Event
+	batchCh chan *BatchEvent
+
+	mu        sync.Mutex
+	closed    bool
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe creates a subscription which receives the events committed after it,
+// it works no matter whether Options.WatchQueueSize is set.
+// The subscription must be closed by Close when it is no longer used.
+func (db *DB) Subscribe(options SubscribeOptions) (*Subscription, error) {
+	if options.BufferSize <= 0 {
+		options.BufferSize = 1024
+	}
+	s := &Subscription{
+		db:      db,
+		options: options,
+		done:    make(chan struct{}),
+	}
+	if options.GroupBatches {
+		s.batchCh = make(chan *BatchEvent, options.BufferSize)
+	} else {
+		s.ch = make(chan *Event, options.BufferSize)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	db.subMu.Lock()
+	db.subscriptions[s] = struct{}{}
+	db.subMu.Unlock()
+	return s, nil
+}
+
+// Events returns the channel of the events, it is closed when the subscription is closed.
+// It is nil if SubscribeOptions.GroupBatches is set.
+func (s *Subscription) Events() <-chan *Event {
+	return s.ch
+}
+
+// Batches returns the channel of the batches, it is closed when the subscription is closed.
+// It is nil unless SubscribeOptions.GroupBatches is set.
+func (s *Subscription) Batches() <-chan *BatchEvent {
+	return s.batchCh
+}
+
+// Err returns why the subscription is closed,
+// it is nil if the subscription is open or closed by Close,
+// ErrSubscriptionOverflow if the buffer is overflow, and ErrDBClosed if the database is closed.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close closes the subscription, the events in the buffer can still be received from Events.
+func (s *Subscription) Close() error {
+	s.close(nil)
+	s.db.subMu.Lock()
+	delete(s.db.subscriptions, s)
+	s.db.subMu.Unlock()
+	return nil
+}
+
+// close closes the channel of the events,
+// the writer blocked by OverflowBlock is released first, because it holds the lock of the subscription.
+func (s *Subscription) close(err error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked(err)
+}
+
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	if s.ch != nil {
+		close(s.ch)
+	} else {
+		close(s.batchCh)
+	}
+}
+
+func (s *Subscription) match(e *Event) bool {
+	if s.options.Prefix != nil && !bytes.HasPrefix(e.Key, s.options.Prefix) {
+		return false
+	}
+	if s.options.StartKey != nil && bytes.Compare(e.Key, s.options.StartKey) < 0 {
+		return false
+	}
+	if s.options.EndKey != nil && bytes.Compare(e.Key, s.options.EndKey) >= 0 {
+		return false
+	}
+	if len(s.options.Actions) == 0 {
+		return true
+	}
+	for _, action := range s.options.Actions {
+		if action == e.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// publish sends the events of a batch which match the subscription,
+// and returns false if the subscription is closed.
+func (s *Subscription) publish(events []*Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	var matched []*Event
+	for _, e := range events {
+		if s.match(e) {
+			matched = append(matched, e)
+		}
+	}
+	if len(matched) == 0 {
+		return true
+	}
+	if s.options.GroupBatches {
+		batch := &BatchEvent{BatchId: matched[0].BatchId, CommitTime: matched[0].CommitTime, Events: matched}
+		return send(s, s.batchCh, batch)
+	}
+	for _, e := range matched {
+		if !send(s, s.ch, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// send sends the item to the channel of the subscription by the overflow policy,
+// and returns false if the subscription is closed.
+func send[T any](s *Subscription, ch chan T, item T) bool {
+	switch s.options.Overflow {
+	case OverflowBlock:
+		select {
+		case ch <- item:
+		case <-s.done:
+		}
+	case OverflowClose:
+		select {
+		case ch <- item:
+		default:
+			s.closeLocked(ErrSubscriptionOverflow)
+		}
+	default:
+		// the writers are serialized by the lock of the database,
+		// but the consumer may receive concurrently.
+		for {
+			select {
+			case ch <- item:
+				return true
+			default:
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+	return !s.closed
+}
+
+// watching returns whether any one is watching the events, to avoid creating the events for nobody.
+func (db *DB) watching() bool {
+	if db.options.WatchQueueSize > 0 {
+		return true
+	}
+	db.subMu.RLock()
+	defer db.subMu.RUnlock()
+	return len(db.subscriptions) > 0
+}
+
+// publishEvents sends the events of a batch to the watcher and the subscriptions.
+// The caller must hold the lock of the database.
+func (db *DB) publishEvents(events []*Event) {
+	if db.options.WatchQueueSize > 0 {
+		for _, e := range events {
+			if e.Action != WatchActionExpire {
+				db.watcher.putEvent(e)
+			}
+		}
+	}
+
+	var closed []*Subscription
+	db.subMu.RLock()
+	for s := range db.subscriptions {
+		if !s.publish(events) {
+			closed = append(closed, s)
+		}
+	}
+	db.subMu.RUnlock()
+
+	if len(closed) > 0 {
+		db.subMu.Lock()
+		for _, s := range closed {
+			delete(db.subscriptions, s)
+		}
+		db.subMu.Unlock()
+	}
+}
+
+// closeSubscriptions closes all the subscriptions when the database is closed.
+// releaseSubscriptions releases the writers blocked by the subscriptions with OverflowBlock,
+// which hold the lock of the database, so it must be called before taking the lock to close the database.
+// The subscriptions are closed by closeSubscriptions later.
+func (db *DB) releaseSubscriptions() {
+	db.subMu.RLock()
+	defer db.subMu.RUnlock()
+	for s := range db.subscriptions {
+		s.closeOnce.Do(func() {
+			close(s.done)
+		})
+	}
+}
+
+func (db *DB) closeSubscriptions() {
+	db.subMu.Lock()
+	defer db.subMu.Unlock()
+	for s := range db.subscriptions {
+		s.close(ErrDBClosed)
+		delete(db.subscriptions, s)
+	}
+}
@@ -0,0 +1,214 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvents(s *Subscription, n int) []*Event {
+	var events []*Event
+	for i := 0; i < n; i++ {
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		case <-time.After(time.Second):
+			return events
+		}
+	}
+	return events
+}
+
+func TestDB_Subscribe(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	all, err := db.Subscribe(SubscribeOptions{})
+	require.NoError(t, err)
+	users, err := db.Subscribe(SubscribeOptions{Prefix: []byte("user:")})
+	require.NoError(t, err)
+	ranged, err := db.Subscribe(SubscribeOptions{StartKey: []byte("b"), EndKey: []byte("d")})
+	require.NoError(t, err)
+	deletes, err := db.Subscribe(SubscribeOptions{Actions: []WatchActionType{WatchActionDelete, WatchActionExpire}})
+	require.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c", "d", "user:1"} {
+		require.NoError(t, db.Put([]byte(key), []byte("value-"+key)))
+	}
+	require.NoError(t, db.Delete([]byte("user:1")))
+	require.NoError(t, db.PutWithTTL([]byte("ttl"), []byte("v"), time.Millisecond))
+	time.Sleep(time.Millisecond * 5)
+	require.NoError(t, db.DeleteExpiredKeys(time.Second))
+
+	// every subscription receives the events on its own.
+	events := receiveEvents(all, 8)
+	require.Len(t, events, 8)
+	assert.Equal(t, []byte("a"), events[0].Key)
+	assert.Equal(t, []byte("value-a"), events[0].Value)
+	assert.Equal(t, WatchActionExpire, events[7].Action)
+
+	events = receiveEvents(users, 2)
+	require.Len(t, events, 2)
+	assert.Equal(t, WatchActionPut, events[0].Action)
+	assert.Equal(t, WatchActionDelete, events[1].Action)
+
+	events = receiveEvents(ranged, 2)
+	require.Len(t, events, 2)
+	assert.Equal(t, []byte("b"), events[0].Key)
+	assert.Equal(t, []byte("c"), events[1].Key)
+
+	events = receiveEvents(deletes, 2)
+	require.Len(t, events, 2)
+	assert.Equal(t, []byte("user:1"), events[0].Key)
+	assert.Equal(t, []byte("ttl"), events[1].Key)
+	assert.Equal(t, WatchActionExpire, events[1].Action)
+
+	// the channel is closed after Close.
+	require.NoError(t, users.Close())
+	_, ok := <-users.Events()
+	assert.False(t, ok)
+	assert.NoError(t, users.Err())
+	require.NoError(t, db.Put([]byte("user:2"), []byte("v")))
+
+	// the subscriptions are closed with the database.
+	require.NoError(t, db.Close())
+	assert.Len(t, receiveEvents(all, 10), 1)
+	assert.Equal(t, ErrDBClosed, all.Err())
+	_, err = db.Subscribe(SubscribeOptions{})
+	assert.Equal(t, ErrDBClosed, err)
+	db, err = Open(options)
+	require.NoError(t, err)
+}
+
+func TestSubscription_Overflow(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	dropOldest, err := db.Subscribe(SubscribeOptions{BufferSize: 2})
+	require.NoError(t, err)
+	closeOnFull, err := db.Subscribe(SubscribeOptions{BufferSize: 2, Overflow: OverflowClose})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("v")))
+	}
+
+	events := receiveEvents(dropOldest, 5)
+	require.Len(t, events, 2)
+	assert.Equal(t, []byte("key-3"), events[0].Key)
+	assert.Equal(t, []byte("key-4"), events[1].Key)
+
+	// the buffered events are still received before the channel is closed.
+	assert.Len(t, receiveEvents(closeOnFull, 5), 2)
+	assert.Equal(t, ErrSubscriptionOverflow, closeOnFull.Err())
+	require.NoError(t, dropOldest.Close())
+
+	// the writer is blocked until the consumer receives the events.
+	block, err := db.Subscribe(SubscribeOptions{BufferSize: 1, Overflow: OverflowBlock})
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			_ = db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("v"))
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("the writer is not blocked")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.Len(t, receiveEvents(block, 3), 3)
+	<-done
+
+	// the blocked writer is released by Close.
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			_ = db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("v"))
+		}
+	}()
+	time.Sleep(time.Millisecond * 50)
+	require.NoError(t, block.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the writer is still blocked")
+	}
+
+	// the database can be closed while a writer is blocked.
+	_, err = db.Subscribe(SubscribeOptions{BufferSize: 1, Overflow: OverflowBlock})
+	require.NoError(t, err)
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			_ = db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("v"))
+		}
+	}()
+	time.Sleep(time.Millisecond * 50)
+	closed := make(chan error)
+	go func() {
+		closed <- db.Close()
+	}()
+	select {
+	case err = <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the database can not be closed")
+	}
+	<-done
+}
+
+func TestSubscription_GroupBatches(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	s, err := db.Subscribe(SubscribeOptions{Prefix: []byte("key-"), GroupBatches: true})
+	require.NoError(t, err)
+	assert.Nil(t, s.Events())
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, batch.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("v")))
+	}
+	require.NoError(t, batch.Put([]byte("other"), []byte("v")))
+	require.NoError(t, batch.Commit())
+	require.NoError(t, db.Delete([]byte("key-0")))
+
+	select {
+	case b := <-s.Batches():
+		require.Len(t, b.Events, 10)
+		assert.True(t, b.CommitTime > 0)
+		for _, e := range b.Events {
+			assert.Equal(t, b.BatchId, e.BatchId)
+			assert.Equal(t, b.CommitTime, e.CommitTime)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no batch is received")
+	}
+	select {
+	case b := <-s.Batches():
+		require.Len(t, b.Events, 1)
+		assert.Equal(t, WatchActionDelete, b.Events[0].Action)
+	case <-time.After(time.Second):
+		t.Fatal("no batch is received")
+	}
+	require.NoError(t, s.Close())
+	_, ok := <-s.Batches()
+	assert.False(t, ok)
+}
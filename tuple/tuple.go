@@ -0,0 +1,246 @@
+// Package tuple packs typed tuples into byte keys whose byte order matches the order of the tuples,
+// so composite keys can be scanned by the range APIs of rosedb, such as DB.AscendRange and IteratorOptions.Prefix.
+//
+//	key, err := tuple.Pack(tuple.Tuple{"order", int64(42), time.Now()})
+//	start, end, err := tuple.PrefixRange(tuple.Tuple{"order"})
+//	db.AscendRange(start, end, handleFn)
+//
+// The tuples are compared element by element, and a tuple is before the longer tuples it is a prefix of.
+// The elements of different types are ordered by their type codes first,
+// so an int64 is never equal to a uint64 or a float64 of the same value.
+//
+// The supported elements and the types they are unpacked to are:
+//
+//	[]byte                                 -> []byte
+//	string                                 -> string
+//	int, int8, int16, int32, int64         -> int64
+//	uint, uint8, uint16, uint32, uint64    -> uint64
+//	float32, float64                       -> float64
+//	bool                                   -> bool
+//	time.Time                              -> time.Time, in UTC with nanosecond precision
+package tuple
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The type codes of the elements, which decide the order of the elements of different types.
+const (
+	bytesCode  = 0x01
+	stringCode = 0x02
+	intCode    = 0x10
+	uintCode   = 0x11
+	floatCode  = 0x20
+	falseCode  = 0x26
+	trueCode   = 0x27
+	timeCode   = 0x30
+)
+
+// ErrInvalidTuple is returned when the bytes are not a packed tuple.
+var ErrInvalidTuple = errors.New("the bytes are not a valid packed tuple")
+
+// Tuple is an ordered list of the elements.
+type Tuple []any
+
+// Pack packs the tuple into a key.
+func (t Tuple) Pack() ([]byte, error) {
+	return Append(nil, t...)
+}
+
+// Pack packs the tuple into a key, it is the same as t.Pack().
+func Pack(t Tuple) ([]byte, error) {
+	return t.Pack()
+}
+
+// Append appends the packed elements to the buf, so a packed tuple can be extended with more elements.
+func Append(buf []byte, elems ...any) ([]byte, error) {
+	for i, elem := range elems {
+		switch v := elem.(type) {
+		case []byte:
+			buf = appendEscaped(append(buf, bytesCode), v)
+		case string:
+			buf = appendEscaped(append(buf, stringCode), []byte(v))
+		case int:
+			buf = appendInt(buf, int64(v))
+		case int8:
+			buf = appendInt(buf, int64(v))
+		case int16:
+			buf = appendInt(buf, int64(v))
+		case int32:
+			buf = appendInt(buf, int64(v))
+		case int64:
+			buf = appendInt(buf, v)
+		case uint:
+			buf = appendUint(buf, uint64(v))
+		case uint8:
+			buf = appendUint(buf, uint64(v))
+		case uint16:
+			buf = appendUint(buf, uint64(v))
+		case uint32:
+			buf = appendUint(buf, uint64(v))
+		case uint64:
+			buf = appendUint(buf, v)
+		case float32:
+			buf = appendFloat(buf, float64(v))
+		case float64:
+			buf = appendFloat(buf, v)
+		case bool:
+			if v {
+				buf = append(buf, trueCode)
+			} else {
+				buf = append(buf, falseCode)
+			}
+		case time.Time:
+			buf = append(buf, timeCode)
+			buf = binary.BigEndian.AppendUint64(buf, uint64(v.UnixNano())^(1<<63))
+		default:
+			return nil, fmt.Errorf("tuple: unsupported element %d of type %T", i, elem)
+		}
+	}
+	return buf, nil
+}
+
+// appendEscaped appends the bytes with the byte 0x00 escaped as 0x00 0xff, and terminated by 0x00.
+func appendEscaped(buf, b []byte) []byte {
+	for _, c := range b {
+		if c == 0x00 {
+			buf = append(buf, 0x00, 0xff)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, 0x00)
+}
+
+// appendInt appends the integer with the sign bit flipped, so the negative integers are before the positive ones.
+func appendInt(buf []byte, v int64) []byte {
+	buf = append(buf, intCode)
+	return binary.BigEndian.AppendUint64(buf, uint64(v)^(1<<63))
+}
+
+func appendUint(buf []byte, v uint64) []byte {
+	buf = append(buf, uintCode)
+	return binary.BigEndian.AppendUint64(buf, v)
+}
+
+// appendFloat appends the float with the sign bit of a positive float flipped,
+// and all the bits of a negative float flipped, so the byte order is the same as the order of the floats.
+func appendFloat(buf []byte, v float64) []byte {
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	buf = append(buf, floatCode)
+	return binary.BigEndian.AppendUint64(buf, bits)
+}
+
+// Unpack unpacks the key packed by Pack into a tuple.
+func Unpack(key []byte) (Tuple, error) {
+	var t Tuple
+	for len(key) > 0 {
+		code := key[0]
+		key = key[1:]
+		switch code {
+		case bytesCode, stringCode:
+			b, n, err := readEscaped(key)
+			if err != nil {
+				return nil, err
+			}
+			key = key[n:]
+			if code == bytesCode {
+				t = append(t, b)
+			} else {
+				t = append(t, string(b))
+			}
+		case falseCode:
+			t = append(t, false)
+		case trueCode:
+			t = append(t, true)
+		case intCode, uintCode, floatCode, timeCode:
+			if len(key) < 8 {
+				return nil, ErrInvalidTuple
+			}
+			bits := binary.BigEndian.Uint64(key)
+			key = key[8:]
+			switch code {
+			case intCode:
+				t = append(t, int64(bits^(1<<63)))
+			case uintCode:
+				t = append(t, bits)
+			case floatCode:
+				if bits&(1<<63) != 0 {
+					bits &^= 1 << 63
+				} else {
+					bits = ^bits
+				}
+				t = append(t, math.Float64frombits(bits))
+			default:
+				t = append(t, time.Unix(0, int64(bits^(1<<63))).UTC())
+			}
+		default:
+			return nil, ErrInvalidTuple
+		}
+	}
+	return t, nil
+}
+
+// readEscaped reads the escaped bytes terminated by 0x00, and returns them and the number of the bytes read.
+func readEscaped(buf []byte) ([]byte, int, error) {
+	b := make([]byte, 0, len(buf))
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != 0x00 {
+			b = append(b, buf[i])
+			continue
+		}
+		if i+1 < len(buf) && buf[i+1] == 0xff {
+			b = append(b, 0x00)
+			i++
+			continue
+		}
+		return b, i + 1, nil
+	}
+	return nil, 0, ErrInvalidTuple
+}
+
+// PrefixRange returns the range [start, end) of the keys of the tuples which start with the prefix,
+// including the prefix itself, which can be passed to DB.AscendRange as AscendRange(start, end, handleFn).
+// DB.DescendRange takes the greater key first and iterates (end, start],
+// so DescendRange(end, start, handleFn) visits the same keys in reverse, except the exact prefix key itself.
+// The packed prefix itself can also be used as IteratorOptions.Prefix.
+func PrefixRange(prefix Tuple) ([]byte, []byte, error) {
+	start, err := prefix.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return start, PrefixEnd(start), nil
+}
+
+// Range returns the range [start, end) of the keys of the tuples between the tuples start and end,
+// which can be passed to DB.AscendRange as AscendRange(start, end, handleFn).
+// The tuples which start with end are not in the range, use PrefixEnd of the end key to include them.
+// DB.DescendRange(end, start, handleFn) iterates (start, end] instead, so the end tuple is included
+// and the start tuple is not.
+func Range(start, end Tuple) ([]byte, []byte, error) {
+	startKey, err := start.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	endKey, err := end.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return startKey, endKey, nil
+}
+
+// PrefixEnd returns a key which is greater than all the packed tuples starting with the packed tuple key,
+// and less than all the others after key, so it can be used as the exclusive end of a range.
+// No element starts with 0xff, so the key followed by 0xff is after all the tuples with the prefix.
+func PrefixEnd(key []byte) []byte {
+	return append(append(make([]byte, 0, len(key)+1), key...), 0xff)
+}
@@ -0,0 +1,155 @@
+package tuple
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackUnpack(t *testing.T) {
+	now := time.Unix(1700000000, 123456789).UTC()
+	tuple := Tuple{[]byte{0, 1, 0}, "rose\x00db", int64(-42), uint64(42), 3.5, true, false, now}
+	key, err := tuple.Pack()
+	require.NoError(t, err)
+	unpacked, err := Unpack(key)
+	require.NoError(t, err)
+	assert.Equal(t, tuple, unpacked)
+
+	// the small integer types are widened.
+	key, err = Pack(Tuple{int8(-1), uint16(7), float32(0.5), 3})
+	require.NoError(t, err)
+	unpacked, err = Unpack(key)
+	require.NoError(t, err)
+	assert.Equal(t, Tuple{int64(-1), uint64(7), 0.5, int64(3)}, unpacked)
+
+	_, err = Pack(Tuple{struct{}{}})
+	assert.Error(t, err)
+	_, err = Unpack([]byte{intCode, 1, 2})
+	assert.Equal(t, ErrInvalidTuple, err)
+	_, err = Unpack([]byte{stringCode, 'a'})
+	assert.Equal(t, ErrInvalidTuple, err)
+	_, err = Unpack([]byte{0xff})
+	assert.Equal(t, ErrInvalidTuple, err)
+}
+
+func TestPack_Order(t *testing.T) {
+	// the tuples in order.
+	tuples := []Tuple{
+		{[]byte("a")},
+		{[]byte("a"), "x"},
+		{[]byte("a\x00")},
+		{""},
+		{"a"},
+		{"a", int64(1)},
+		{"a\x00"},
+		{"ab"},
+		{int64(math.MinInt64)},
+		{int64(-1)},
+		{int64(0)},
+		{int64(1), "a"},
+		{int64(math.MaxInt64)},
+		{uint64(0)},
+		{uint64(math.MaxUint64)},
+		{math.Inf(-1)},
+		{-2.5},
+		{0.0},
+		{1e-300},
+		{2.5},
+		{math.Inf(1)},
+		{false},
+		{true},
+		{time.Unix(-1, 0)},
+		{time.Unix(0, 0)},
+		{time.Unix(1700000000, 0)},
+	}
+	var prev []byte
+	for _, tuple := range tuples {
+		key, err := tuple.Pack()
+		require.NoError(t, err)
+		if prev != nil {
+			assert.Equal(t, -1, bytes.Compare(prev, key), "%v", tuple)
+		}
+		prev = key
+	}
+}
+
+func TestPrefixRange(t *testing.T) {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	for _, tuple := range []Tuple{
+		{"order", int64(-1)},
+		{"order", int64(2), "item"},
+		{"order", int64(10)},
+		{"orders", int64(1)},
+		{"user", int64(1)},
+	} {
+		key, err := tuple.Pack()
+		require.NoError(t, err)
+		require.NoError(t, db.Put(key, []byte("v")))
+	}
+
+	collect := func(start, end []byte) []Tuple {
+		var tuples []Tuple
+		db.AscendRange(start, end, func(k, v []byte) (bool, error) {
+			tuple, err := Unpack(k)
+			require.NoError(t, err)
+			tuples = append(tuples, tuple)
+			return true, nil
+		})
+		return tuples
+	}
+
+	start, end, err := PrefixRange(Tuple{"order"})
+	require.NoError(t, err)
+	assert.Equal(t, []Tuple{
+		{"order", int64(-1)},
+		{"order", int64(2), "item"},
+		{"order", int64(10)},
+	}, collect(start, end))
+
+	start, end, err = Range(Tuple{"order", int64(0)}, Tuple{"order", int64(10)})
+	require.NoError(t, err)
+	assert.Equal(t, []Tuple{{"order", int64(2), "item"}}, collect(start, end))
+	assert.Len(t, collect(start, PrefixEnd(end)), 2)
+
+	// DescendRange takes the greater key first, and excludes the exact prefix key.
+	start, end, err = PrefixRange(Tuple{"order"})
+	require.NoError(t, err)
+	require.NoError(t, db.Put(start, []byte("v")))
+	var descended []Tuple
+	db.DescendRange(end, start, func(k, v []byte) (bool, error) {
+		tuple, err := Unpack(k)
+		require.NoError(t, err)
+		descended = append(descended, tuple)
+		return true, nil
+	})
+	assert.Equal(t, []Tuple{
+		{"order", int64(10)},
+		{"order", int64(2), "item"},
+		{"order", int64(-1)},
+	}, descended)
+	assert.Len(t, collect(start, end), 4)
+
+	// the packed prefix works as the prefix of the iterator.
+	prefix, err := Pack(Tuple{"order", int64(2)})
+	require.NoError(t, err)
+	it := db.NewIterator(rosedb.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+	require.True(t, it.Valid())
+	tuple, err := Unpack(it.Item().Key)
+	require.NoError(t, err)
+	assert.Equal(t, Tuple{"order", int64(2), "item"}, tuple)
+	it.Next()
+	assert.False(t, it.Valid())
+}
@@ -0,0 +1,123 @@
+package typed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidEncoding is returned when the bytes can not be decoded by a codec.
+var ErrInvalidEncoding = errors.New("the bytes are not a valid encoding of the codec")
+
+// Codec encodes the values of type T to bytes and decodes them back.
+//
+// The codecs used for the keys of a Store should preserve the order,
+// which means the byte order of the encoded values is the same as the order of the values,
+// so the range scans over the typed keys return them in order.
+// StringCodec, BytesCodec, Int64Codec and Uint64Codec preserve the order,
+// JSONCodec and GobCodec do not, and BinaryCodec only does for the unsigned integers.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes the values in JSON by encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes the values by encoding/gob, each value is encoded with its type information.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// BinaryCodec encodes the fixed-size values in big endian by encoding/binary,
+// T must be a fixed-size value or a struct or an array of them, see binary.Write.
+type BinaryCodec[T any] struct{}
+
+func (BinaryCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (BinaryCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := binary.Read(bytes.NewReader(data), binary.BigEndian, &v)
+	return v, err
+}
+
+// StringCodec encodes the strings as their bytes.
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// BytesCodec keeps the bytes as they are.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return bytes.Clone(data), nil
+}
+
+// Uint64Codec encodes the integers in 8 bytes big endian.
+type Uint64Codec struct{}
+
+func (Uint64Codec) Encode(v uint64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, v), nil
+}
+
+func (Uint64Codec) Decode(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, ErrInvalidEncoding
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// Int64Codec encodes the integers in 8 bytes big endian with the sign bit flipped,
+// so the negative integers are before the positive ones.
+type Int64Codec struct{}
+
+func (Int64Codec) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)^(1<<63)), nil
+}
+
+func (Int64Codec) Decode(data []byte) (int64, error) {
+	if len(data) != 8 {
+		return 0, ErrInvalidEncoding
+	}
+	return int64(binary.BigEndian.Uint64(data) ^ (1 << 63)), nil
+}
@@ -0,0 +1,277 @@
+// Package typed provides a generic typed store on top of rosedb,
+// which encodes the keys and values by codecs instead of handling the raw bytes.
+//
+//	users := typed.New[uint64, User](db, []byte("user:"), typed.Uint64Codec{}, typed.JSONCodec[User]{})
+//	err := users.Put(1, User{Name: "rose"})
+//	user, err := users.Get(1)
+//
+// The keys of a store are prefixed by its prefix, so several stores can share a database.
+// The key codec should preserve the order, so the typed keys are iterated in order, see Codec.
+package typed
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+)
+
+// Store is a typed view of the key-value pairs with the prefix in the database.
+type Store[K, V any] struct {
+	db     *rosedb.DB
+	prefix []byte
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// New returns the store of the key-value pairs with the prefix in the database.
+// The prefix should not be empty unless the store owns the whole database,
+// because the iteration decodes all the keys with the prefix.
+func New[K, V any](db *rosedb.DB, prefix []byte, keys Codec[K], values Codec[V]) *Store[K, V] {
+	return &Store[K, V]{db: db, prefix: bytes.Clone(prefix), keys: keys, values: values}
+}
+
+func (s *Store[K, V]) encodeKey(k K) ([]byte, error) {
+	key, err := s.keys.Encode(k)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(s.prefix)+len(key))
+	buf = append(buf, s.prefix...)
+	return append(buf, key...), nil
+}
+
+func (s *Store[K, V]) decode(key, value []byte) (K, V, error) {
+	var v V
+	k, err := s.keys.Decode(key[len(s.prefix):])
+	if err != nil {
+		return k, v, err
+	}
+	v, err = s.values.Decode(value)
+	return k, v, err
+}
+
+// encodePair encodes the key and the value, it is shared by the store and its batches.
+func (s *Store[K, V]) encodePair(k K, v V) ([]byte, []byte, error) {
+	key, err := s.encodeKey(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := s.values.Encode(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// Get returns the value of the key, rosedb.ErrKeyNotFound is returned if the key does not exist.
+func (s *Store[K, V]) Get(k K) (V, error) {
+	var v V
+	key, err := s.encodeKey(k)
+	if err != nil {
+		return v, err
+	}
+	value, err := s.db.Get(key)
+	if err != nil {
+		return v, err
+	}
+	return s.values.Decode(value)
+}
+
+// Put sets the value of the key.
+func (s *Store[K, V]) Put(k K, v V) error {
+	key, value, err := s.encodePair(k, v)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(key, value)
+}
+
+// PutWithTTL sets the value of the key with a ttl.
+func (s *Store[K, V]) PutWithTTL(k K, v V, ttl time.Duration) error {
+	key, value, err := s.encodePair(k, v)
+	if err != nil {
+		return err
+	}
+	return s.db.PutWithTTL(key, value, ttl)
+}
+
+// Delete deletes the key.
+func (s *Store[K, V]) Delete(k K) error {
+	key, err := s.encodeKey(k)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(key)
+}
+
+// Exist returns whether the key exists.
+func (s *Store[K, V]) Exist(k K) (bool, error) {
+	key, err := s.encodeKey(k)
+	if err != nil {
+		return false, err
+	}
+	return s.db.Exist(key)
+}
+
+// Iterate calls handleFn for each key-value pair of the store in the order of the encoded keys,
+// or in the reverse order if reverse is true. It stops at the first error of decoding or handleFn.
+func (s *Store[K, V]) Iterate(reverse bool, handleFn func(k K, v V) (bool, error)) error {
+	it := s.NewIterator(reverse)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		k, v, err := it.Item()
+		if err != nil {
+			return err
+		}
+		next, err := handleFn(k, v)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// AscendRange calls handleFn for each key-value pair of the store with the key in [start, end) in ascending order.
+func (s *Store[K, V]) AscendRange(start, end K, handleFn func(k K, v V) (bool, error)) error {
+	startKey, err := s.encodeKey(start)
+	if err != nil {
+		return err
+	}
+	endKey, err := s.encodeKey(end)
+	if err != nil {
+		return err
+	}
+	var handleErr error
+	s.db.AscendRange(startKey, endKey, func(key, value []byte) (bool, error) {
+		k, v, err := s.decode(key, value)
+		if err != nil {
+			handleErr = err
+			return false, nil
+		}
+		next, err := handleFn(k, v)
+		if err != nil {
+			handleErr = err
+			return false, nil
+		}
+		return next, nil
+	})
+	return handleErr
+}
+
+// NewIterator returns an iterator of the key-value pairs of the store,
+// in the order of the encoded keys, or in the reverse order if reverse is true.
+// The iterator must be closed by Close when it is no longer used.
+func (s *Store[K, V]) NewIterator(reverse bool) *Iterator[K, V] {
+	it := s.db.NewIterator(rosedb.IteratorOptions{Prefix: s.prefix, Reverse: reverse})
+	return &Iterator[K, V]{store: s, it: it}
+}
+
+// WithBatch returns a typed view of the store in the batch,
+// the writes are committed or rolled back with the batch.
+func (s *Store[K, V]) WithBatch(batch *rosedb.Batch) *Batch[K, V] {
+	return &Batch[K, V]{store: s, batch: batch}
+}
+
+// Batch is a typed view of a store in a rosedb.Batch.
+type Batch[K, V any] struct {
+	store *Store[K, V]
+	batch *rosedb.Batch
+}
+
+// Get returns the value of the key in the batch, rosedb.ErrKeyNotFound is returned if the key does not exist.
+func (b *Batch[K, V]) Get(k K) (V, error) {
+	var v V
+	key, err := b.store.encodeKey(k)
+	if err != nil {
+		return v, err
+	}
+	value, err := b.batch.Get(key)
+	if err != nil {
+		return v, err
+	}
+	return b.store.values.Decode(value)
+}
+
+// Put sets the value of the key in the batch.
+func (b *Batch[K, V]) Put(k K, v V) error {
+	key, value, err := b.store.encodePair(k, v)
+	if err != nil {
+		return err
+	}
+	return b.batch.Put(key, value)
+}
+
+// PutWithTTL sets the value of the key with a ttl in the batch.
+func (b *Batch[K, V]) PutWithTTL(k K, v V, ttl time.Duration) error {
+	key, value, err := b.store.encodePair(k, v)
+	if err != nil {
+		return err
+	}
+	return b.batch.PutWithTTL(key, value, ttl)
+}
+
+// Delete deletes the key in the batch.
+func (b *Batch[K, V]) Delete(k K) error {
+	key, err := b.store.encodeKey(k)
+	if err != nil {
+		return err
+	}
+	return b.batch.Delete(key)
+}
+
+// Iterator is a typed iterator of the key-value pairs of a store.
+type Iterator[K, V any] struct {
+	store *Store[K, V]
+	it    *rosedb.Iterator
+	err   error // the error of encoding the key to seek
+}
+
+// Rewind repositions the iterator to the first key-value pair in the iteration order.
+func (it *Iterator[K, V]) Rewind() {
+	it.err = nil
+	it.it.Rewind()
+}
+
+// Seek positions the iterator at the key, or the next key in the iteration order if it does not exist.
+func (it *Iterator[K, V]) Seek(k K) {
+	key, err := it.store.encodeKey(k)
+	if it.err = err; err != nil {
+		return
+	}
+	it.it.Seek(key)
+}
+
+// Next advances the iterator to the next key-value pair.
+func (it *Iterator[K, V]) Next() {
+	it.it.Next()
+}
+
+// Valid returns whether the iterator is positioned at a key-value pair.
+func (it *Iterator[K, V]) Valid() bool {
+	return it.err == nil && it.it.Valid()
+}
+
+// Item returns the decoded key-value pair at the position of the iterator.
+func (it *Iterator[K, V]) Item() (K, V, error) {
+	item := it.it.Item()
+	if item == nil {
+		var k K
+		var v V
+		return k, v, rosedb.ErrKeyNotFound
+	}
+	return it.store.decode(item.Key, item.Value)
+}
+
+// Err returns the error of the iteration.
+func (it *Iterator[K, V]) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.it.Err()
+}
+
+// Close releases the resources of the iterator.
+func (it *Iterator[K, V]) Close() {
+	it.it.Close()
+}
@@ -0,0 +1,156 @@
+package typed
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+type point struct {
+	X, Y uint32
+}
+
+func openTestDB(t *testing.T) *rosedb.DB {
+	options := rosedb.DefaultOptions
+	options.DirPath = t.TempDir()
+	db, err := rosedb.Open(options)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestCodecs(t *testing.T) {
+	u := user{Name: "rose", Age: 18}
+	data, err := JSONCodec[user]{}.Encode(u)
+	require.NoError(t, err)
+	decoded, err := JSONCodec[user]{}.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, u, decoded)
+
+	data, err = GobCodec[user]{}.Encode(u)
+	require.NoError(t, err)
+	decoded, err = GobCodec[user]{}.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, u, decoded)
+
+	data, err = BinaryCodec[point]{}.Encode(point{X: 1, Y: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 1, 0, 0, 0, 2}, data)
+	p, err := BinaryCodec[point]{}.Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, point{X: 1, Y: 2}, p)
+	_, err = BinaryCodec[user]{}.Encode(u)
+	assert.Error(t, err)
+
+	// the integer codecs preserve the order.
+	ints := []int64{math.MinInt64, -100, -1, 0, 1, 100, math.MaxInt64}
+	for i, n := range ints {
+		data, err = Int64Codec{}.Encode(n)
+		require.NoError(t, err)
+		m, err := Int64Codec{}.Decode(data)
+		require.NoError(t, err)
+		assert.Equal(t, n, m)
+		if i > 0 {
+			prev, _ := Int64Codec{}.Encode(ints[i-1])
+			assert.Less(t, string(prev), string(data))
+		}
+	}
+	_, err = Uint64Codec{}.Decode([]byte{1})
+	assert.Equal(t, ErrInvalidEncoding, err)
+}
+
+func TestStore(t *testing.T) {
+	db := openTestDB(t)
+	users := New[int64, user](db, []byte("user:"), Int64Codec{}, JSONCodec[user]{})
+	names := New[string, string](db, []byte("name:"), StringCodec{}, StringCodec{})
+
+	_, err := users.Get(1)
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+	for _, id := range []int64{3, -2, 10, 1} {
+		require.NoError(t, users.Put(id, user{Name: "u", Age: int(id)}))
+	}
+	require.NoError(t, names.Put("rose", "lily"))
+
+	u, err := users.Get(-2)
+	require.NoError(t, err)
+	assert.Equal(t, -2, u.Age)
+	ok, err := users.Exist(10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, users.Delete(10))
+	ok, err = users.Exist(10)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the keys of the other store are not iterated, and the negative keys come first.
+	var ids []int64
+	err = users.Iterate(false, func(k int64, v user) (bool, error) {
+		ids = append(ids, k)
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-2, 1, 3}, ids)
+	ids = ids[:0]
+	err = users.Iterate(true, func(k int64, v user) (bool, error) {
+		ids = append(ids, k)
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 1, -2}, ids)
+
+	ids = ids[:0]
+	err = users.AscendRange(-5, 3, func(k int64, v user) (bool, error) {
+		ids = append(ids, k)
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-2, 1}, ids)
+
+	it := users.NewIterator(false)
+	it.Seek(0)
+	require.True(t, it.Valid())
+	k, v, err := it.Item()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), k)
+	assert.Equal(t, 1, v.Age)
+	it.Next()
+	k, _, err = it.Item()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), k)
+	it.Next()
+	assert.False(t, it.Valid())
+	it.Close()
+}
+
+func TestStore_Batch(t *testing.T) {
+	db := openTestDB(t)
+	points := New[uint64, point](db, []byte("point:"), Uint64Codec{}, BinaryCodec[point]{})
+	require.NoError(t, points.Put(1, point{X: 1, Y: 1}))
+
+	batch := db.NewBatch(rosedb.DefaultBatchOptions)
+	tb := points.WithBatch(batch)
+	require.NoError(t, tb.Put(2, point{X: 2, Y: 2}))
+	require.NoError(t, tb.Delete(1))
+	p, err := tb.Get(2)
+	require.NoError(t, err)
+	assert.Equal(t, point{X: 2, Y: 2}, p)
+	_, err = tb.Get(1)
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+	require.NoError(t, batch.Commit())
+
+	p, err = points.Get(2)
+	require.NoError(t, err)
+	assert.Equal(t, point{X: 2, Y: 2}, p)
+	_, err = points.Get(1)
+	assert.Equal(t, rosedb.ErrKeyNotFound, err)
+}
@@ -10,6 +10,8 @@ type WatchActionType = byte
 const (
 	WatchActionPut WatchActionType = iota
 	WatchActionDelete
+	// WatchActionExpire is only sent to the subscriptions, when DeleteExpiredKeys removes an expired key.
+	WatchActionExpire
 )
 
 // Event is the event that occurs when the database is modified.
@@ -19,6 +21,45 @@ type Event struct {
 	Key     []byte
 	Value   []byte
 	BatchId uint64
+	// CommitTime is the commit time of the batch in nanoseconds,
+	// it is 0 for the merged records and the expire events.
+	CommitTime int64
+	// Expire is the expiration time of the key in nanoseconds, 0 means the key never expires.
+	Expire int64
+}
+
+// TTL returns the time to live of the key from now, 0 means the key never expires,
+// and a negative value means the key has expired.
+func (e *Event) TTL() time.Duration {
+	if e.Expire == 0 {
+		return 0
+	}
+	if ttl := time.Until(time.Unix(0, e.Expire)); ttl > 0 {
+		return ttl
+	}
+	return -1
+}
+
+// BatchEvent is all the events of a batch, which are committed atomically.
+type BatchEvent struct {
+	BatchId    uint64
+	CommitTime int64
+	Events     []*Event
+}
+
+func newEvent(record *LogRecord, commitTime int64) *Event {
+	e := &Event{
+		Action:     WatchActionPut,
+		Key:        record.Key,
+		Value:      record.Value,
+		BatchId:    record.BatchId,
+		CommitTime: commitTime,
+		Expire:     record.Expire,
+	}
+	if record.Type == LogRecordDeleted {
+		e.Action = WatchActionDelete
+	}
+	return e
 }
 
 // Watcher temporarily stores event information,
@@ -27,9 +68,10 @@ type Event struct {
 // If the event is overflow, It will remove the oldest data,
 // even if event hasn't been read yet.
 type Watcher struct {
-	queue eventQueue
-	mu    sync.Mutex
-	done  chan struct{}
+	queue  eventQueue
+	mu     sync.Mutex
+	notify chan struct{} // signals the sender goroutine that there are new events
+	done   chan struct{}
 }
 
 func NewWatcher(capacity uint64) *Watcher {
@@ -38,7 +80,8 @@ func NewWatcher(capacity uint64) *Watcher {
 			Events:   make([]*Event, capacity),
 			Capacity: capacity,
 		},
-		done: make(chan struct{}),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
 	}
 }
 
@@ -49,6 +92,12 @@ func (w *Watcher) putEvent(e *Event) {
 		w.queue.frontTakeAStep()
 	}
 	w.mu.Unlock()
+
+	// the signal is pending if the sender is busy, it will check the queue again.
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
 }
 
 // getEvent if queue is empty, it will return nil.
@@ -71,7 +120,12 @@ func (w *Watcher) sendEvent(c chan *Event) {
 		default:
 			event := w.getEvent()
 			if event == nil {
-				time.Sleep(100 * time.Millisecond)
+				// wait until a new event is put.
+				select {
+				case <-w.notify:
+				case <-w.done:
+					return
+				}
 				continue
 			}
 			select {
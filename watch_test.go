@@ -3,6 +3,7 @@ package rosedb
 import (
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/rosedblabs/rosedb/v2/utils"
 	"github.com/stretchr/testify/assert"
@@ -146,3 +147,29 @@ func TestWatch_Batch_Put_Watch(t *testing.T) {
 		assert.Equal(t, batchId, event.BatchId)
 	}
 }
+
+func TestWatch_Latency(t *testing.T) {
+	options := DefaultOptions
+	options.WatchQueueSize = 10
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	w, err := db.Watch()
+	require.NoError(t, err)
+	// the events are delivered as soon as they are put, even after the watcher is idle.
+	time.Sleep(time.Millisecond * 50)
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		require.NoError(t, db.PutWithTTL([]byte("key"), []byte("value"), time.Hour))
+		select {
+		case event := <-w:
+			assert.True(t, time.Since(start) < time.Millisecond*50)
+			assert.True(t, event.CommitTime >= start.UnixNano())
+			assert.True(t, event.Expire > time.Now().UnixNano())
+			assert.True(t, event.TTL() > time.Minute*59)
+		case <-time.After(time.Second):
+			t.Fatal("no event is received")
+		}
+	}
+}
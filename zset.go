@@ -0,0 +1,406 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// The sorted set keeps two members for each of its members,
+// one by member to look up the score, and one by score to iterate the members in the order of the scores:
+//
+//	'm' | member                -> score
+//	's' | score | member        -> nil
+//
+// The score is encoded so that the byte order of the encoded scores is the same as the order of the scores.
+const (
+	zsetMemberTag = 'm'
+	zsetScoreTag  = 's'
+)
+
+// ScoreMember is a member and its score in a sorted set.
+type ScoreMember struct {
+	Score  float64
+	Member []byte
+}
+
+// encodeScore encodes the score in 8 bytes in the order of the scores,
+// the sign bit of a positive score is flipped, and all the bits of a negative score are flipped.
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return binary.BigEndian.AppendUint64(nil, bits)
+}
+
+func decodeScore(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+func encodeZSetMember(member []byte) []byte {
+	buf := make([]byte, 0, len(member)+1)
+	buf = append(buf, zsetMemberTag)
+	return append(buf, member...)
+}
+
+func encodeZSetScore(score float64, member []byte) []byte {
+	buf := make([]byte, 0, len(member)+9)
+	buf = append(buf, zsetScoreTag)
+	buf = append(buf, encodeScore(score)...)
+	return append(buf, member...)
+}
+
+// zscore returns the score of the member of the sorted set.
+func (b *Batch) zscore(key, member []byte) (float64, error) {
+	value, err := b.getMember(key, encodeZSetMember(member))
+	if err != nil {
+		return 0, err
+	}
+	return decodeScore(value), nil
+}
+
+// zset sets the score of the member, and returns whether the member is added.
+func (b *Batch) zset(key []byte, meta *dataMeta, member []byte, score float64) (bool, error) {
+	if len(member) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if math.IsNaN(score) {
+		return false, ErrScoreIsNaN
+	}
+	old, err := b.zscore(key, member)
+	if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+	added := err == ErrKeyNotFound
+	if !added {
+		if old == score {
+			return false, nil
+		}
+		if err = b.deleteMember(key, encodeZSetScore(old, member)); err != nil {
+			return false, err
+		}
+	}
+	if err = b.putMember(key, encodeZSetMember(member), encodeScore(score)); err != nil {
+		return false, err
+	}
+	if err = b.putMember(key, encodeZSetScore(score, member), nil); err != nil {
+		return false, err
+	}
+	if added {
+		meta.count++
+	}
+	return added, nil
+}
+
+// zrem removes the member with its score from the sorted set.
+func (b *Batch) zrem(key []byte, meta *dataMeta, member []byte, score float64) error {
+	if err := b.deleteMember(key, encodeZSetMember(member)); err != nil {
+		return err
+	}
+	if err := b.deleteMember(key, encodeZSetScore(score, member)); err != nil {
+		return err
+	}
+	meta.count--
+	return nil
+}
+
+// scanScores calls handleFn for each member of the sorted set in the order of the scores,
+// starting from the score member start, or ending at it if reverse is true.
+func (b *Batch) scanScores(key, start []byte, reverse bool, handleFn func(member []byte, score float64) (bool, error)) error {
+	return b.scanMembers(key, start, reverse, func(m, _ []byte) (bool, error) {
+		if len(m) == 0 || m[0] != zsetScoreTag {
+			return false, nil
+		}
+		return handleFn(m[9:], decodeScore(m[1:9]))
+	})
+}
+
+// ZAdd sets the scores of the members of the sorted set, and returns the number of the members added.
+func (b *Batch) ZAdd(key []byte, scoreMembers ...ScoreMember) (int, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil {
+		return 0, err
+	}
+	var added int
+	for _, sm := range scoreMembers {
+		ok, err := b.zset(key, meta, sm.Member, sm.Score)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, b.putMeta(key, meta)
+}
+
+// ZRem removes the members of the sorted set, and returns the number of the members removed.
+func (b *Batch) ZRem(key []byte, members ...[]byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil || meta.count == 0 {
+		return 0, err
+	}
+	var removed int
+	for _, member := range members {
+		score, err := b.zscore(key, member)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = b.zrem(key, meta, member, score); err != nil {
+			return 0, err
+		}
+		removed++
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, b.putMeta(key, meta)
+}
+
+// ZScore returns the score of the member of the sorted set,
+// ErrKeyNotFound is returned if the member does not exist.
+func (b *Batch) ZScore(key, member []byte) (float64, error) {
+	if _, err := b.getMeta(key, DataTypeZSet); err != nil {
+		return 0, err
+	}
+	return b.zscore(key, member)
+}
+
+// ZCard returns the number of the members of the sorted set.
+func (b *Batch) ZCard(key []byte) (int, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil {
+		return 0, err
+	}
+	return int(meta.count), nil
+}
+
+// ZRank returns the rank of the member in the sorted set, the member with the lowest score has rank 0,
+// ErrKeyNotFound is returned if the member does not exist.
+func (b *Batch) ZRank(key, member []byte) (int, error) {
+	score, err := b.ZScore(key, member)
+	if err != nil {
+		return 0, err
+	}
+	var rank int
+	err = b.scanScores(key, []byte{zsetScoreTag}, false, func(m []byte, s float64) (bool, error) {
+		if s == score && bytes.Equal(m, member) {
+			return false, nil
+		}
+		rank++
+		return true, nil
+	})
+	return rank, err
+}
+
+// ZIncrBy increments the score of the member of the sorted set by delta, and returns the new score.
+// The member is added with the score delta if it does not exist.
+func (b *Batch) ZIncrBy(key, member []byte, delta float64) (float64, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil {
+		return 0, err
+	}
+	score, err := b.zscore(key, member)
+	if err != nil && err != ErrKeyNotFound {
+		return 0, err
+	}
+	score += delta
+	if _, err = b.zset(key, meta, member, score); err != nil {
+		return 0, err
+	}
+	return score, b.putMeta(key, meta)
+}
+
+// ZAscendRange calls handleFn for each member of the sorted set with the score in [min, max]
+// in the ascending order of the scores, the members with the same score are in the order of the members.
+func (b *Batch) ZAscendRange(key []byte, min, max float64, handleFn func(member []byte, score float64) (bool, error)) error {
+	if _, err := b.getMeta(key, DataTypeZSet); err != nil {
+		return err
+	}
+	start := append([]byte{zsetScoreTag}, encodeScore(min)...)
+	return b.scanScores(key, start, false, func(member []byte, score float64) (bool, error) {
+		if score > max {
+			return false, nil
+		}
+		return handleFn(member, score)
+	})
+}
+
+// ZDescendRange calls handleFn for each member of the sorted set with the score in [min, max]
+// in the descending order of the scores, the members with the same score are in the reverse order of the members.
+func (b *Batch) ZDescendRange(key []byte, max, min float64, handleFn func(member []byte, score float64) (bool, error)) error {
+	if _, err := b.getMeta(key, DataTypeZSet); err != nil {
+		return err
+	}
+	// the members are never empty, so the end of the prefix is after all the members with the score max.
+	start := prefixEnd(append([]byte{zsetScoreTag}, encodeScore(max)...))
+	return b.scanScores(key, start, true, func(member []byte, score float64) (bool, error) {
+		if score < min {
+			return false, nil
+		}
+		return handleFn(member, score)
+	})
+}
+
+// ZRangeByScore returns at most count members of the sorted set with the score in [min, max]
+// in the ascending order of the scores, 0 count means no limit.
+func (b *Batch) ZRangeByScore(key []byte, min, max float64, count int) ([]ScoreMember, error) {
+	var scoreMembers []ScoreMember
+	err := b.ZAscendRange(key, min, max, func(member []byte, score float64) (bool, error) {
+		scoreMembers = append(scoreMembers, ScoreMember{Score: score, Member: bytes.Clone(member)})
+		return count <= 0 || len(scoreMembers) < count, nil
+	})
+	return scoreMembers, err
+}
+
+// ZRangeByRank returns the members of the sorted set with the rank from start to stop, both inclusive,
+// the negative ranks count from the highest score, and -1 is the member with the highest score.
+func (b *Batch) ZRangeByRank(key []byte, start, stop int64) ([]ScoreMember, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	from, to := indexRange(meta.count, start, stop)
+	if from == to {
+		return nil, nil
+	}
+	scoreMembers := make([]ScoreMember, 0, to-from)
+	var rank uint64
+	err = b.scanScores(key, []byte{zsetScoreTag}, false, func(member []byte, score float64) (bool, error) {
+		if rank >= from {
+			scoreMembers = append(scoreMembers, ScoreMember{Score: score, Member: bytes.Clone(member)})
+		}
+		rank++
+		return rank < to, nil
+	})
+	return scoreMembers, err
+}
+
+// ZPopMin removes and returns at most count members with the lowest scores of the sorted set.
+func (b *Batch) ZPopMin(key []byte, count int) ([]ScoreMember, error) {
+	meta, err := b.getMeta(key, DataTypeZSet)
+	if err != nil || meta.count == 0 || count <= 0 {
+		return nil, err
+	}
+	scoreMembers, err := b.ZRangeByRank(key, 0, int64(count)-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, sm := range scoreMembers {
+		if err = b.zrem(key, meta, sm.Member, sm.Score); err != nil {
+			return nil, err
+		}
+	}
+	return scoreMembers, b.putMeta(key, meta)
+}
+
+// ZAdd sets the scores of the members of the sorted set atomically, and returns the number of the members added.
+func (db *DB) ZAdd(key []byte, scoreMembers ...ScoreMember) (added int, err error) {
+	err = db.update(func(batch *Batch) error {
+		added, err = batch.ZAdd(key, scoreMembers...)
+		return err
+	})
+	return
+}
+
+// ZRem removes the members of the sorted set atomically, and returns the number of the members removed.
+func (db *DB) ZRem(key []byte, members ...[]byte) (removed int, err error) {
+	err = db.update(func(batch *Batch) error {
+		removed, err = batch.ZRem(key, members...)
+		return err
+	})
+	return
+}
+
+// ZScore returns the score of the member of the sorted set,
+// ErrKeyNotFound is returned if the member does not exist.
+func (db *DB) ZScore(key, member []byte) (score float64, err error) {
+	err = db.view(func(batch *Batch) error {
+		score, err = batch.ZScore(key, member)
+		return err
+	})
+	return
+}
+
+// ZCard returns the number of the members of the sorted set.
+func (db *DB) ZCard(key []byte) (n int, err error) {
+	err = db.view(func(batch *Batch) error {
+		n, err = batch.ZCard(key)
+		return err
+	})
+	return
+}
+
+// ZRank returns the rank of the member in the sorted set, the member with the lowest score has rank 0.
+func (db *DB) ZRank(key, member []byte) (rank int, err error) {
+	err = db.view(func(batch *Batch) error {
+		rank, err = batch.ZRank(key, member)
+		return err
+	})
+	return
+}
+
+// ZIncrBy increments the score of the member of the sorted set by delta, and returns the new score.
+func (db *DB) ZIncrBy(key, member []byte, delta float64) (score float64, err error) {
+	err = db.update(func(batch *Batch) error {
+		score, err = batch.ZIncrBy(key, member, delta)
+		return err
+	})
+	return
+}
+
+// ZAscendRange calls handleFn for each member of the sorted set with the score in [min, max]
+// in the ascending order of the scores, handleFn must not write the database.
+func (db *DB) ZAscendRange(key []byte, min, max float64, handleFn func(member []byte, score float64) (bool, error)) error {
+	return db.view(func(batch *Batch) error {
+		return batch.ZAscendRange(key, min, max, handleFn)
+	})
+}
+
+// ZDescendRange calls handleFn for each member of the sorted set with the score in [min, max]
+// in the descending order of the scores, handleFn must not write the database.
+func (db *DB) ZDescendRange(key []byte, max, min float64, handleFn func(member []byte, score float64) (bool, error)) error {
+	return db.view(func(batch *Batch) error {
+		return batch.ZDescendRange(key, max, min, handleFn)
+	})
+}
+
+// ZRangeByScore returns at most count members of the sorted set with the score in [min, max]
+// in the ascending order of the scores, 0 count means no limit.
+func (db *DB) ZRangeByScore(key []byte, min, max float64, count int) (scoreMembers []ScoreMember, err error) {
+	err = db.view(func(batch *Batch) error {
+		scoreMembers, err = batch.ZRangeByScore(key, min, max, count)
+		return err
+	})
+	return
+}
+
+// ZRangeByRank returns the members of the sorted set with the rank from start to stop, both inclusive.
+func (db *DB) ZRangeByRank(key []byte, start, stop int64) (scoreMembers []ScoreMember, err error) {
+	err = db.view(func(batch *Batch) error {
+		scoreMembers, err = batch.ZRangeByRank(key, start, stop)
+		return err
+	})
+	return
+}
+
+// ZPopMin removes and returns at most count members with the lowest scores of the sorted set atomically.
+func (db *DB) ZPopMin(key []byte, count int) (scoreMembers []ScoreMember, err error) {
+	err = db.update(func(batch *Batch) error {
+		scoreMembers, err = batch.ZPopMin(key, count)
+		return err
+	})
+	return
+}
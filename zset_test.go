@@ -0,0 +1,162 @@
+package rosedb
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeScore(t *testing.T) {
+	scores := []float64{math.Inf(-1), -1e10, -2.5, -1, -math.SmallestNonzeroFloat64, 0,
+		math.SmallestNonzeroFloat64, 1, 2.5, 1e10, math.Inf(1)}
+	for i, score := range scores {
+		assert.Equal(t, score, decodeScore(encodeScore(score)))
+		if i > 0 {
+			assert.Less(t, string(encodeScore(scores[i-1])), string(encodeScore(score)))
+		}
+	}
+}
+
+func TestDB_ZSet(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer destroyDB(db)
+
+	key := []byte("leaderboard")
+	added, err := db.ZAdd(key,
+		ScoreMember{Score: 30, Member: []byte("carol")},
+		ScoreMember{Score: -5, Member: []byte("alice")},
+		ScoreMember{Score: 12.5, Member: []byte("bob")},
+		ScoreMember{Score: 12.5, Member: []byte("dave")},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 4, added)
+	added, err = db.ZAdd(key, ScoreMember{Score: 40, Member: []byte("alice")})
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+	_, err = db.ZAdd(key, ScoreMember{Score: math.NaN(), Member: []byte("eve")})
+	assert.Equal(t, ErrScoreIsNaN, err)
+
+	score, err := db.ZScore(key, []byte("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, float64(40), score)
+	_, err = db.ZScore(key, []byte("eve"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	n, err := db.ZCard(key)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	// the old score of alice is removed from the score order.
+	members, err := db.ZRangeByRank(key, 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []ScoreMember{
+		{Score: 12.5, Member: []byte("bob")},
+		{Score: 12.5, Member: []byte("dave")},
+		{Score: 30, Member: []byte("carol")},
+		{Score: 40, Member: []byte("alice")},
+	}, members)
+	rank, err := db.ZRank(key, []byte("carol"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, rank)
+	_, err = db.ZRank(key, []byte("eve"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	members, err = db.ZRangeByScore(key, 12.5, 30, 0)
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+	assert.Equal(t, []byte("carol"), members[2].Member)
+	members, err = db.ZRangeByScore(key, 0, 100, 2)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	var descending []string
+	err = db.ZDescendRange(key, 30, 0, func(member []byte, score float64) (bool, error) {
+		descending = append(descending, string(member))
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol", "dave", "bob"}, descending)
+
+	score, err = db.ZIncrBy(key, []byte("bob"), -20)
+	require.NoError(t, err)
+	assert.Equal(t, -7.5, score)
+	score, err = db.ZIncrBy(key, []byte("eve"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), score)
+
+	popped, err := db.ZPopMin(key, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []ScoreMember{
+		{Score: -7.5, Member: []byte("bob")},
+		{Score: 1, Member: []byte("eve")},
+	}, popped)
+	removed, err := db.ZRem(key, []byte("dave"), []byte("nobody"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	members, err = db.ZRangeByRank(key, 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []ScoreMember{
+		{Score: 30, Member: []byte("carol")},
+		{Score: 40, Member: []byte("alice")},
+	}, members)
+}
+
+func TestBatch_ZSet(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	require.NoError(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("delay")
+	_, err = db.ZAdd(key, ScoreMember{Score: 1, Member: []byte("a")}, ScoreMember{Score: 3, Member: []byte("c")})
+	require.NoError(t, err)
+
+	// the scores changed in the batch are visible to the batch, and both entries are written by the commit.
+	batch := db.NewBatch(DefaultBatchOptions)
+	_, err = batch.ZAdd(key, ScoreMember{Score: 2, Member: []byte("b")}, ScoreMember{Score: 4, Member: []byte("a")})
+	require.NoError(t, err)
+	members, err := batch.ZRangeByRank(key, 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "a"}, zsetMembers(members))
+	require.NoError(t, batch.Commit())
+
+	require.NoError(t, db.Close())
+	db, err = Open(options)
+	require.NoError(t, err)
+	members, err = db.ZRangeByScore(key, math.Inf(-1), math.Inf(1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "a"}, zsetMembers(members))
+	score, err := db.ZScore(key, []byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, float64(4), score)
+
+	// the scores stay sorted with many members.
+	var scores []float64
+	for i := 0; i < 200; i++ {
+		score := float64((i*7919)%200) - 100.5
+		scores = append(scores, score)
+		_, err = db.ZAdd([]byte("many"), ScoreMember{Score: score, Member: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+	sort.Float64s(scores)
+	members, err = db.ZRangeByRank([]byte("many"), 0, -1)
+	require.NoError(t, err)
+	require.Len(t, members, 200)
+	for i, sm := range members {
+		assert.Equal(t, scores[i], sm.Score)
+	}
+}
+
+func zsetMembers(scoreMembers []ScoreMember) []string {
+	members := make([]string, 0, len(scoreMembers))
+	for _, sm := range scoreMembers {
+		members = append(members, string(sm.Member))
+	}
+	return members
+}